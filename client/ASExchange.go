@@ -3,12 +3,19 @@ package client
 import (
 	"errors"
 	"fmt"
+	"github.com/jcmturner/gokrb5/credentials"
 	"github.com/jcmturner/gokrb5/crypto"
 	"github.com/jcmturner/gokrb5/iana/errorcode"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/msgtype"
+	"github.com/jcmturner/gokrb5/iana/nametype"
 	"github.com/jcmturner/gokrb5/iana/patype"
 	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/pkinit"
+	"github.com/jcmturner/gokrb5/spake"
 	"github.com/jcmturner/gokrb5/types"
 	"sort"
+	"time"
 )
 
 // Login the client with the KDC via an AS exchange.
@@ -16,79 +23,350 @@ func (cl *Client) Login() error {
 	return cl.ASExchange()
 }
 
+// Login the client with the KDC via an AS exchange, requesting a TGT with the ticket options provided rather than
+// the defaults from the configuration.
+func (cl *Client) LoginWithOptions(o messages.TicketOptions) error {
+	return cl.ASExchangeWithOptions(o)
+}
+
 // Perform an AS exchange for the client to retrieve a TGT.
+// If the client has a certificate PKINIT pre-authentication is used.
+// If the client is anonymous anonymous PKINIT is used to get an anonymous TGT.
+// Otherwise, if the KDC offers them, OTP or encrypted challenge is used within FAST or SPAKE pre-authentication,
+// falling back to encrypted timestamp.
+// If the client has a FAST armor ticket the exchange is protected with FAST.
 func (cl *Client) ASExchange() error {
-	if !cl.IsConfigured() {
-		return errors.New("Client is not configured correctly.")
+	return cl.ASExchangeWithOptions(messages.TicketOptions{})
+}
+
+// Perform an AS exchange for the client to retrieve a TGT with the ticket options provided.
+func (cl *Client) ASExchangeWithOptions(o messages.TicketOptions) error {
+	// The password prompted for is also used to change it if it has expired
+	creds := cl.asCredentials()
+	spn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"krbtgt", cl.clientRealm(creds)},
 	}
-	a := messages.NewASReq(cl.Config, cl.Credentials.Username)
-	b, err := a.Marshal()
-	if err != nil {
-		return fmt.Errorf("Error marshalling AS_REQ: %v", err)
+	s, err := cl.asExchange(spn, o, creds)
+	if isKeyExpired(err) && cl.changePasswordPrompter() != nil {
+		err = cl.changeExpiredPasswd(creds)
+		if err != nil {
+			return err
+		}
+		cl.observe(Event{Type: EventRetry, MsgType: msgtype.KRB_AS_REQ, Text: "password expired and has been changed"})
+		s, err = cl.asExchange(spn, o, cl.Credentials)
 	}
-	rb, err := cl.SendToKDC(b)
 	if err != nil {
-		return fmt.Errorf("Error sending AS_REQ to KDC: %v", err)
+		return err
 	}
-	var ar messages.ASRep
-	err = ar.Unmarshal(rb)
-	if err != nil {
-		//A KRBError may have been returned instead.
-		var krberr messages.KRBError
-		err = krberr.Unmarshal(rb)
+	cl.Session = s
+	cl.warnExpiry(s.LastReq)
+	return nil
+}
+
+// Perform an AS exchange for a ticket to the service principal, returning it as a session.
+// This is used directly, rather than via the TGT, for services that require an initial ticket.
+// If the KDC rejects the request due to clock skew and kdc_timesync is enabled the exchange is retried once using
+// the KDC's time.
+// The credentials provided, which are those of the client or a copy with a prompting key provider, supply the client's
+// long term key.
+func (cl *Client) asExchange(spn types.PrincipalName, o messages.TicketOptions, creds *credentials.Credentials) (*Session, error) {
+	s, err := cl.doASExchange(spn, o, creds)
+	if cl.syncKDCTime(err) {
+		cl.observe(Event{Type: EventRetry, MsgType: msgtype.KRB_AS_REQ, Text: "clock skew too great, using the KDC's time"})
+		s, err = cl.doASExchange(spn, o, creds)
+	}
+	return s, err
+}
+
+func (cl *Client) doASExchange(spn types.PrincipalName, o messages.TicketOptions, creds *credentials.Credentials) (*Session, error) {
+	if !cl.IsConfigured() {
+		return nil, errors.New("Client is not configured correctly.")
+	}
+	var a messages.ASReq
+	var pk *pkinit.Request
+	var sp *spake.Request
+	var ecKey *types.EncryptionKey
+	var otpUsed bool
+	if creds.IsAnonymous() {
+		a = messages.NewAnonymousASReq(cl.Config, cl.clientRealm(creds))
+	} else {
+		a = messages.NewASReq(cl.Config, creds.Username)
+		// The credentials' principal name carries the name type and their realm may not be the default
+		a.ReqBody.CName = creds.CName
+		a.ReqBody.Realm = cl.clientRealm(creds)
+	}
+	o.Apply(&a.ReqBody, cl.Config)
+	// The PKINIT request is bound to the request body so the service principal must be set first
+	a.ReqBody.SName = spn
+	if cl.PACRequest != nil {
+		err := a.SetPACRequest(*cl.PACRequest)
 		if err != nil {
-			return fmt.Errorf("Could not unmarshal data returned from KDC: %v", err)
+			return nil, err
 		}
-		if krberr.ErrorCode == errorcode.KDC_ERR_PREAUTH_REQUIRED {
-			paTSb, err := types.GetPAEncTSEncAsnMarshalled()
-			if err != nil {
-				return fmt.Errorf("Error creating PAEncTSEnc for Pre-Authentication: %v", err)
+	}
+	cl.observe(Event{
+		Type:      EventRequest,
+		MsgType:   msgtype.KRB_AS_REQ,
+		Realm:     a.ReqBody.Realm,
+		Principal: principalString(a.ReqBody.CName.NameString, a.ReqBody.Realm),
+		Service:   principalString(spn.NameString, a.ReqBody.Realm),
+		ETypes:    a.ReqBody.EType,
+	})
+	switch {
+	case creds.IsAnonymous():
+		// Anonymous PKINIT uses an unsigned AuthPack
+		var err error
+		pk, err = pkinit.NewRequest(cl.Config, a, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating anonymous PKINIT pre-authentication data: %v", err)
+		}
+		a.PAData = append(a.PAData, pk.PAData)
+		cl.observe(Event{Type: EventPreAuth, Realm: a.ReqBody.Realm, PAType: pk.PAData.PADataType})
+	case creds.HasCertificate():
+		var err error
+		pk, err = pkinit.NewRequest(cl.Config, a, creds.Certificate, creds.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating PKINIT pre-authentication data: %v", err)
+		}
+		a.PAData = append(a.PAData, pk.PAData)
+		cl.observe(Event{Type: EventPreAuth, Realm: a.ReqBody.Realm, PAType: pk.PAData.PADataType})
+	}
+	sent, sentb, ar, err := cl.sendASReq(a)
+	if krberr, ok := err.(messages.KRBError); ok && pk != nil && krberr.ErrorCode == errorcode.KDC_ERR_DH_KEY_PARAMETERS_NOT_ACCEPTED {
+		// The e-data of the error lists the key agreement groups the KDC accepts
+		cl.observe(Event{Type: EventRetry, MsgType: msgtype.KRB_AS_REQ, Text: "PKINIT key agreement group not accepted by the KDC, using one it offers"})
+		pk, err = pkinit.NewRequestWithKDCParameters(cl.Config, a, creds.Certificate, creds.PrivateKey, krberr.EData)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating PKINIT pre-authentication data: %v", err)
+		}
+		a.PAData[len(a.PAData)-1] = pk.PAData
+		sent, sentb, ar, err = cl.sendASReq(a)
+	}
+	if err != nil {
+		krberr, ok := err.(messages.KRBError)
+		if !ok || krberr.ErrorCode != errorcode.KDC_ERR_PREAUTH_REQUIRED {
+			return nil, err
+		}
+		if pk != nil {
+			// The KDC did not accept PKINIT. Fall back to the client's long term key if there is one.
+			if !creds.HasKey() {
+				return nil, err
 			}
-			sort.Sort(sort.Reverse(sort.IntSlice(cl.Config.LibDefaults.Default_tkt_enctype_ids)))
-			etype, err := crypto.GetEtype(cl.Config.LibDefaults.Default_tkt_enctype_ids[0])
+			pk = nil
+			a.PAData = a.PAData[:len(a.PAData)-1]
+			cl.observe(Event{Type: EventRetry, MsgType: msgtype.KRB_AS_REQ, Text: "PKINIT not accepted by the KDC, using the long term key"})
+		}
+		// The e-data of the error contains METHOD-DATA hinting at the pre-authentication required
+		var pas types.PADataSequence
+		if len(krberr.EData) > 0 {
+			err = pas.Unmarshal(krberr.EData)
 			if err != nil {
-				return fmt.Errorf("Error creating etype: %v", err)
+				return nil, fmt.Errorf("Error unmarshalling METHOD-DATA from KDC_ERR_PREAUTH_REQUIRED: %v", err)
 			}
-			//paEncTS, err := crypto.GetEncryptedData(paTSb, etype, cl.Config.LibDefaults.Default_realm, cl.Credentials.Username, cl.Credentials.Keytab, 1)
-			key, err := cl.Credentials.Keytab.GetEncryptionKey(cl.Credentials.Username, cl.Config.LibDefaults.Default_realm, 1, etype.GetETypeID())
-			paEncTS, err := crypto.GetEncryptedData(paTSb, key, 0, 1)
+		}
+		switch {
+		case cl.FASTArmor != nil && cl.otpPrompter() != nil && offered(pas, patype.PA_OTP_CHALLENGE):
+			cl.observe(Event{Type: EventPreAuth, Realm: a.ReqBody.Realm, PAType: patype.PA_OTP_REQUEST})
+			sent, sentb, ar, err = cl.otpExchange(a, pas)
 			if err != nil {
-				return fmt.Errorf("Error encrypting pre-authentication timestamp: %v", err)
+				return nil, err
 			}
-			pa := types.PAData{
-				PADataType:  patype.PA_ENC_TIMESTAMP,
-				PADataValue: paEncTS.Cipher,
+			otpUsed = true
+		case cl.FASTArmor != nil && offered(pas, patype.PA_ENCRYPTED_CHALLENGE):
+			// Encrypted challenge is preferred within a FAST tunnel as it also authenticates the KDC
+			cl.observe(Event{Type: EventPreAuth, Realm: a.ReqBody.Realm, PAType: patype.PA_ENCRYPTED_CHALLENGE})
+			sent, sentb, ar, ecKey, err = cl.encChallengeExchange(a, pas, creds)
+			if err != nil {
+				return nil, err
 			}
-			a.PAData = append(a.PAData, pa)
-			b, err := a.Marshal()
+		case offered(pas, patype.PA_SPAKE):
+			// SPAKE is preferred over encrypted timestamp as it does not expose password derived data to offline dictionary attack
+			cl.observe(Event{Type: EventPreAuth, Realm: a.ReqBody.Realm, PAType: patype.PA_SPAKE})
+			sent, sentb, ar, sp, err = cl.spakeExchange(a, pas, creds)
 			if err != nil {
-				return fmt.Errorf("Error marshalling AS_REQ: %v", err)
+				return nil, err
 			}
-			rb, err := cl.SendToKDC(b)
+		default:
+			cl.observe(Event{Type: EventPreAuth, Realm: a.ReqBody.Realm, PAType: patype.PA_ENC_TIMESTAMP})
+			pa, err := cl.encTimestampPAData(pas, creds)
 			if err != nil {
-				return fmt.Errorf("Error sending AS_REQ to KDC: %v", err)
+				return nil, err
 			}
-			err = ar.Unmarshal(rb)
+			a.PAData = append(a.PAData, pa)
+			a.PAData = append(a.PAData, fxCookies(pas)...)
+			sent, sentb, ar, err = cl.sendASReq(a)
 			if err != nil {
-				return fmt.Errorf("Could not unmarshal data returned from KDC: %v", err)
+				return nil, err
 			}
 		}
-		return krberr
 	}
-	err = ar.DecryptEncPart(cl.Credentials)
+	switch {
+	case pk != nil:
+		err = decryptPKINITEncPart(&ar, sent, sentb, pk)
+	case sp != nil:
+		err = decryptSPAKEEncPart(&ar, sent, sp)
+	case ecKey != nil:
+		err = cl.decryptEncChallengeEncPart(&ar, sent, *ecKey)
+	case otpUsed:
+		err = decryptOTPEncPart(&ar, sent)
+	case sent.FASTArmor != nil:
+		err = ar.DecryptEncPartWithFAST(creds, sent)
+	default:
+		err = ar.DecryptEncPart(creds)
+	}
 	if err != nil {
-		return fmt.Errorf("Error decrypting EncPart of AS_REP: %v", err)
+		return nil, fmt.Errorf("Error decrypting EncPart of AS_REP: %v", err)
+	}
+	if ok, err := ar.IsValid(cl.Config, sent); !ok {
+		return nil, fmt.Errorf("AS_REP is not valid: %v", err)
 	}
-	if ok, err := ar.IsValid(cl.Config, a); !ok {
-		return fmt.Errorf("AS_REP is not valid: %v", err)
+	if err := ar.VerifyEncPARep(sentb); err != nil {
+		return nil, fmt.Errorf("AS_REP is not valid: %v", err)
 	}
-	cl.Session = &Session{
+	// The reply is authenticated and valid so the KDC's clock can be learnt from the auth time of the new ticket
+	cl.Config.SetKDCTime(ar.DecryptedEncPart.AuthTime)
+	return &Session{
+		CRealm:               ar.CRealm,
+		CName:                ar.CName,
 		AuthTime:             ar.DecryptedEncPart.AuthTime,
+		StartTime:            ar.DecryptedEncPart.StartTime,
 		EndTime:              ar.DecryptedEncPart.EndTime,
 		RenewTill:            ar.DecryptedEncPart.RenewTill,
 		TGT:                  ar.Ticket,
 		SessionKey:           ar.DecryptedEncPart.Key,
 		SessionKeyExpiration: ar.DecryptedEncPart.KeyExpiration,
+		Flags:                ar.DecryptedEncPart.Flags,
+		LastReq:              ar.DecryptedEncPart.LastReqInfo(),
+	}, nil
+}
+
+// Send the AS_REQ to the KDC, armoring it with FAST if the client has a FAST armor ticket.
+// The AS_REQ and the exact bytes sent are returned along with the AS_REP.
+// If the KDC returns a KRB_ERROR it is returned as the error. Under FAST this is the error from the FAST response.
+func (cl *Client) sendASReq(a messages.ASReq) (messages.ASReq, []byte, messages.ASRep, error) {
+	var ar messages.ASRep
+	if cl.FASTArmor != nil {
+		// Pre-authentication data may already be bound to the armor of the request
+		if a.FASTArmor == nil {
+			armor, err := cl.newFASTArmor()
+			if err != nil {
+				return a, nil, ar, err
+			}
+			a.FASTArmor = &armor
+		}
+		err := a.ArmorWithFAST(*a.FASTArmor)
+		if err != nil {
+			return a, nil, ar, err
+		}
 	}
-	return nil
+	b, err := a.Marshal()
+	if err != nil {
+		return a, nil, ar, fmt.Errorf("Error marshalling AS_REQ: %v", err)
+	}
+	rb, err := cl.SendToRealmKDC(a.ReqBody.Realm, b)
+	if err != nil {
+		return a, b, ar, fmt.Errorf("Error sending AS_REQ to KDC: %v", err)
+	}
+	err = ar.Unmarshal(rb)
+	if err != nil {
+		//A KRBError may have been returned instead.
+		var krberr messages.KRBError
+		err = krberr.Unmarshal(rb)
+		if err != nil {
+			return a, b, ar, fmt.Errorf("Could not unmarshal data returned from KDC: %v", err)
+		}
+		if a.FASTArmor != nil {
+			krberr, err = krberr.UnwrapFAST(*a.FASTArmor, a.ReqBody.Nonce)
+			if err != nil {
+				return a, b, ar, err
+			}
+		}
+		cl.observe(Event{Type: EventKRBError, MsgType: msgtype.KRB_AS_REQ, Realm: krberr.Realm, ErrorCode: krberr.ErrorCode, Text: krberr.EText})
+		return a, b, ar, krberr
+	}
+	return a, b, ar, nil
+}
+
+// Record the KDC's time from a KRB_AP_ERR_SKEW error if kdc_timesync is enabled.
+// Returns true if the time was recorded and the request should be retried.
+func (cl *Client) syncKDCTime(err error) bool {
+	krberr, ok := err.(messages.KRBError)
+	if !ok || krberr.ErrorCode != errorcode.KRB_AP_ERR_SKEW {
+		return false
+	}
+	return cl.Config.SetKDCTime(krberr.STime.Add(time.Duration(krberr.Susec) * time.Microsecond))
+}
+
+// Query if the KDC offered the pre-authentication type in the METHOD-DATA.
+func offered(pas types.PADataSequence, patype int) bool {
+	for _, pa := range pas {
+		if pa.PADataType == patype {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the PA-FX-COOKIE padata from the KDC. The cookie must be returned to the KDC unchanged.
+func fxCookies(pas types.PADataSequence) types.PADataSequence {
+	var cookies types.PADataSequence
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_FX_COOKIE {
+			cookies = append(cookies, pa)
+		}
+	}
+	return cookies
+}
+
+// Get the PA-ENC-TIMESTAMP pre-authentication data.
+// The METHOD-DATA returned by the KDC is used to determine the encryption type and salt.
+func (cl *Client) encTimestampPAData(pas types.PADataSequence, creds *credentials.Credentials) (types.PAData, error) {
+	var pa types.PAData
+	paTSb, err := types.GetPAEncTSEncAsnMarshalledAt(cl.Config.Now())
+	if err != nil {
+		return pa, fmt.Errorf("Error creating PAEncTSEnc for Pre-Authentication: %v", err)
+	}
+	key, err := cl.preAuthKey(pas, creds)
+	if err != nil {
+		return pa, err
+	}
+	paEncTS, err := crypto.GetEncryptedData(paTSb, key, keyusage.AS_REQ_PA_ENC_TIMESTAMP, 1)
+	if err != nil {
+		return pa, fmt.Errorf("Error encrypting pre-authentication timestamp: %v", err)
+	}
+	b, err := paEncTS.Marshal()
+	if err != nil {
+		return pa, fmt.Errorf("Error marshalling pre-authentication timestamp: %v", err)
+	}
+	pa = types.PAData{
+		PADataType:  patype.PA_ENC_TIMESTAMP,
+		PADataValue: b,
+	}
+	return pa, nil
+}
+
+// Get the client's long term key to use for pre-authentication.
+// The encryption type from any PA-ETYPE-INFO2 provided by the KDC is used, otherwise the most preferred default.
+func (cl *Client) preAuthKey(pas types.PADataSequence, creds *credentials.Credentials) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	sort.Sort(sort.Reverse(sort.IntSlice(cl.Config.LibDefaults.Default_tkt_enctype_ids)))
+	etypeID := cl.Config.LibDefaults.Default_tkt_enctype_ids[0]
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_ETYPE_INFO2 {
+			var et2 types.ETypeInfo2
+			if err := et2.Unmarshal(pa.PADataValue); err == nil && len(et2) > 0 {
+				etypeID = et2[0].EType
+			}
+		}
+	}
+	etype, err := crypto.GetEtype(etypeID)
+	if err != nil {
+		return key, fmt.Errorf("Error creating etype: %v", err)
+	}
+	key, err = creds.GetKey(creds.CName, cl.clientRealm(creds), etype.GetETypeID(), 0, pas)
+	if err != nil {
+		return key, fmt.Errorf("Error getting key for pre-authentication: %v", err)
+	}
+	return key, nil
 }
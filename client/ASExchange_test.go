@@ -0,0 +1,112 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/errorcode"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestClient_Login_otherRealm(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	c.Realms = append(c.Realms, config.Realm{Realm: "OTHER.GOKRB5", Kdc: []string{"10.80.99.99:88"}})
+	cl := NewClientWithPassword("testuser1/admin@OTHER.GOKRB5", "", "passwordvalue")
+	cl.WithConfig(c)
+	assert.NotEqual(t, "OTHER.GOKRB5", c.LibDefaults.Default_realm, "Credentials' realm should not be the default")
+	tgtKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	cl.WithTransport(TransportFunc(func(realm, addr string, b []byte) ([]byte, error) {
+		if realm != "OTHER.GOKRB5" || addr != "10.80.99.99:88" {
+			return nil, fmt.Errorf("AS_REQ not sent to a KDC of the credentials' realm: %s %s", realm, addr)
+		}
+		var asReq messages.ASReq
+		if err := asReq.Unmarshal(b); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling AS_REQ: %v", err)
+		}
+		if asReq.ReqBody.Realm != "OTHER.GOKRB5" {
+			return nil, fmt.Errorf("AS_REQ realm not as expected: %s", asReq.ReqBody.Realm)
+		}
+		if asReq.ReqBody.SName.PrincipalNameString() != "krbtgt/OTHER.GOKRB5" {
+			return nil, fmt.Errorf("AS_REQ service not as expected: %s", asReq.ReqBody.SName.PrincipalNameString())
+		}
+		var ed types.EncryptedData
+		for _, pa := range asReq.PAData {
+			if pa.PADataType == patype.PA_ENC_TIMESTAMP {
+				if err := ed.Unmarshal(pa.PADataValue); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if len(ed.Cipher) < 1 {
+			return testKRBError(errorcode.KDC_ERR_PREAUTH_REQUIRED, realm, asReq.ReqBody.SName)
+		}
+		// The pre-authentication key is salted with the credentials' realm
+		key, _, err := crypto.GetKeyFromPassword("passwordvalue", asReq.ReqBody.CName, "OTHER.GOKRB5", ed.EType, types.PADataSequence{})
+		if err != nil {
+			return nil, err
+		}
+		et, _ := crypto.GetEtype(ed.EType)
+		if _, err := crypto.DecryptEncPart(key.KeyValue, ed, et, keyusage.AS_REQ_PA_ENC_TIMESTAMP); err != nil {
+			return nil, errors.New("Pre-authentication timestamp not encrypted in the key for the credentials' realm")
+		}
+		return testASRep(asReq, "passwordvalue", tgtKey, time.Now().UTC().Truncate(time.Second))
+	}))
+	err := cl.Login()
+	if err != nil {
+		t.Fatalf("Error logging in with credentials of another realm: %v", err)
+	}
+	assert.Equal(t, "OTHER.GOKRB5", cl.Session.CRealm, "Client realm of the session not as expected")
+	assert.Equal(t, tgtKey.KeyValue, cl.Session.SessionKey.KeyValue, "Session key not as expected")
+}
+
+func TestClient_Login_kdcTimesync(t *testing.T) {
+	var tests = []struct {
+		name     string
+		timesync int
+		badNonce bool
+		valid    bool
+	}{
+		{"timesync", 1, false, true},
+		{"timesync with an invalid reply", 1, true, false},
+		{"no timesync", 0, false, false},
+	}
+	for _, test := range tests {
+		c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+		c.LibDefaults.Kdc_timesync = test.timesync
+		cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+		cl.WithConfig(c)
+		tgtKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+		// The KDC's clock is an hour ahead
+		kdcTime := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+		cl.WithTransport(TransportFunc(func(realm, addr string, b []byte) ([]byte, error) {
+			var asReq messages.ASReq
+			if err := asReq.Unmarshal(b); err != nil {
+				return nil, err
+			}
+			if test.badNonce {
+				asReq.ReqBody.Nonce++
+			}
+			return testASRep(asReq, "passwordvalue", tgtKey, kdcTime)
+		}))
+		err := cl.Login()
+		if !test.valid {
+			assert.Error(t, err, "Login should fail: %s", test.name)
+			assert.Equal(t, time.Duration(0), c.KDCTimeOffset(), "KDC clock offset should not be recorded from a reply that is not valid: %s", test.name)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Error logging in: %s: %v", test.name, err)
+		}
+		offset := c.KDCTimeOffset()
+		assert.True(t, offset > 59*time.Minute && offset < 61*time.Minute, "KDC clock offset not recorded: %s", test.name)
+	}
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"errors"
 	"fmt"
+	"github.com/jcmturner/gokrb5/iana/msgtype"
 	"github.com/jcmturner/gokrb5/iana/nametype"
 	"github.com/jcmturner/gokrb5/messages"
 	"github.com/jcmturner/gokrb5/types"
@@ -11,49 +12,161 @@ import (
 
 // Perform a TGS exchange to retrieve a ticket to the specified SPN.
 // The ticket retrieved is added to the client's cache.
+// If the client has a FAST armor ticket the exchange is protected with FAST using implicit TGS armor.
+// If the KDC rejects the request due to clock skew and kdc_timesync is enabled the exchange is retried once using
+// the KDC's time.
 func (cl *Client) TGSExchange(spn types.PrincipalName, renewal bool) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
+	return cl.TGSExchangeWithOptions(spn, renewal, messages.TicketOptions{})
+}
+
+// Perform a TGS exchange to retrieve a ticket to the specified SPN with the ticket options provided rather than the
+// defaults from the configuration.
+func (cl *Client) TGSExchangeWithOptions(spn types.PrincipalName, renewal bool, o messages.TicketOptions) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
+	tgsReq, tgsRep, err = cl.tgsExchange(spn, renewal, o)
+	if cl.syncKDCTime(err) {
+		cl.observe(Event{Type: EventRetry, MsgType: msgtype.KRB_TGS_REQ, Text: "clock skew too great, using the KDC's time"})
+		tgsReq, tgsRep, err = cl.tgsExchange(spn, renewal, o)
+	}
+	return tgsReq, tgsRep, err
+}
+
+func (cl *Client) tgsExchange(spn types.PrincipalName, renewal bool, o messages.TicketOptions) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
 	if cl.Session == nil {
 		return tgsReq, tgsRep, errors.New("Error client does not have a session. Client needs to login first")
 	}
-	tgsReq, err = messages.NewTGSReq(cl.Credentials.Username, cl.Config, cl.Session.TGT, cl.Session.SessionKey, spn, renewal)
+	if cl.Session.IsInvalid() && !o.Validate {
+		return tgsReq, tgsRep, errors.New("Error client's TGT is postdated and must be validated before use")
+	}
+	return cl.tgsExchangeWithTicket(cl.Session.TGT, cl.Session.SessionKey, spn, renewal, o)
+}
+
+// Perform a TGS exchange authenticated with the ticket and session key provided. This is the client's TGT other than
+// when validating a postdated service ticket.
+func (cl *Client) tgsExchangeWithTicket(tkt types.Ticket, sessionKey types.EncryptionKey, spn types.PrincipalName, renewal bool, o messages.TicketOptions) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
+	if cl.FASTArmor != nil {
+		tgsReq, err = messages.NewFASTTGSReqWithPrincipal(cl.Credentials.CName, cl.Session.CRealm, cl.Config, tkt, sessionKey, spn, renewal, o)
+	} else {
+		tgsReq, err = messages.NewTGSReqWithPrincipal(cl.Credentials.CName, cl.Session.CRealm, cl.Config, tkt, sessionKey, spn, renewal, o)
+	}
 	if err != nil {
 		return tgsReq, tgsRep, fmt.Errorf("Error generating New TGS_REQ: %v", err)
 	}
+	if cl.PACOptions != nil {
+		err = tgsReq.SetPACOptions(*cl.PACOptions)
+		if err != nil {
+			return tgsReq, tgsRep, err
+		}
+	}
+	cl.observe(Event{
+		Type:      EventRequest,
+		MsgType:   msgtype.KRB_TGS_REQ,
+		Realm:     tgsReq.ReqBody.Realm,
+		Principal: principalString(cl.Session.CName.NameString, cl.Session.CRealm),
+		Service:   principalString(spn.NameString, tgsReq.ReqBody.Realm),
+		ETypes:    tgsReq.ReqBody.EType,
+	})
+	tgsRep, err = cl.sendTGSReq(tgsReq, tkt.Realm, sessionKey)
+	return tgsReq, tgsRep, err
+}
+
+// Send the TGS_REQ to a KDC of the realm provided and process the TGS_REP returned.
+// The realm and session key are those of the ticket in the TGS_REQ's authentication header.
+func (cl *Client) sendTGSReq(tgsReq messages.TGSReq, realm string, sessionKey types.EncryptionKey) (tgsRep messages.TGSRep, err error) {
 	b, err := tgsReq.Marshal()
 	if err != nil {
-		return tgsReq, tgsRep, fmt.Errorf("Error marshalling TGS_REQ: %v", err)
+		return tgsRep, fmt.Errorf("Error marshalling TGS_REQ: %v", err)
 	}
-	r, err := cl.SendToKDC(b)
+	r, err := cl.SendToRealmKDC(realm, b)
 	if err != nil {
-		return tgsReq, tgsRep, fmt.Errorf("Error sending TGS_REQ to KDC: %v", err)
+		return tgsRep, fmt.Errorf("Error sending TGS_REQ to KDC: %v", err)
 	}
 	err = tgsRep.Unmarshal(r)
 	if err != nil {
-		return tgsReq, tgsRep, fmt.Errorf("Error unmarshalling TGS_REP: %v", err)
+		//A KRBError may have been returned instead.
+		var krberr messages.KRBError
+		if e := krberr.Unmarshal(r); e != nil {
+			return tgsRep, fmt.Errorf("Error unmarshalling TGS_REP: %v", err)
+		}
+		if tgsReq.FASTArmor != nil {
+			krberr, err = krberr.UnwrapFAST(*tgsReq.FASTArmor, tgsReq.ReqBody.Nonce)
+			if err != nil {
+				return tgsRep, err
+			}
+		}
+		cl.observe(Event{Type: EventKRBError, MsgType: msgtype.KRB_TGS_REQ, Realm: krberr.Realm, ErrorCode: krberr.ErrorCode, Text: krberr.EText})
+		return tgsRep, krberr
+	}
+	switch {
+	case tgsReq.FASTArmor != nil:
+		err = tgsRep.DecryptEncPartWithFAST(tgsReq, sessionKey)
+	case len(tgsReq.SubKey.KeyValue) > 0:
+		err = tgsRep.DecryptEncPartWithSubKey(tgsReq.SubKey)
+	default:
+		err = tgsRep.DecryptEncPart(sessionKey)
 	}
-	err = tgsRep.DecryptEncPart(cl.Session.SessionKey)
 	if err != nil {
-		return tgsReq, tgsRep, fmt.Errorf("Error decrypting EncPart of TGS_REP: %v", err)
+		return tgsRep, fmt.Errorf("Error decrypting EncPart of TGS_REP: %v", err)
 	}
 	if ok, err := tgsRep.IsValid(cl.Config, tgsReq); !ok {
-		return tgsReq, tgsRep, fmt.Errorf("TGS_REP is not valid: %v", err)
+		return tgsRep, fmt.Errorf("TGS_REP is not valid: %v", err)
 	}
-	return tgsReq, tgsRep, nil
+	return tgsRep, nil
 }
 
 // Make a request to get a service ticket for the SPN specified
 // SPN format: <SERVICE>/<FQDN> Eg. HTTP/www.example.com
 // The ticket will be added to the client's ticket cache
 func (cl *Client) GetServiceTicket(spn string) error {
+	return cl.GetServiceTicketWithOptions(spn, messages.TicketOptions{})
+}
+
+// Make a request to get a service ticket for the SPN specified with the ticket options provided rather than the
+// defaults from the configuration. For example a short lived ticket that is not forwardable.
+// The ticket will be added to the client's ticket cache
+func (cl *Client) GetServiceTicketWithOptions(spn string, o messages.TicketOptions) error {
 	s := strings.Split(spn, "/")
 	princ := types.PrincipalName{
 		NameType:   nametype.KRB_NT_PRINCIPAL,
 		NameString: s,
 	}
-	_, tgsRep, err := cl.TGSExchange(princ, false)
+	_, tgsRep, err := cl.TGSExchangeWithOptions(princ, false, o)
 	if err != nil {
 		return err
 	}
-	cl.Cache.AddEntry(tgsRep.Ticket, tgsRep.DecryptedEncPart.AuthTime, tgsRep.DecryptedEncPart.EndTime, tgsRep.DecryptedEncPart.RenewTill)
+	if types.IsFlagSet(&tgsRep.DecryptedEncPart.Flags, types.Invalid) {
+		cl.Cache.AddInvalidEntry(tgsRep.Ticket, tgsRep.DecryptedEncPart.AuthTime, tgsRep.DecryptedEncPart.StartTime, tgsRep.DecryptedEncPart.EndTime, tgsRep.DecryptedEncPart.RenewTill, tgsRep.DecryptedEncPart.Key)
+		return nil
+	}
+	cl.Cache.AddEntryWithSessionKey(tgsRep.Ticket, tgsRep.DecryptedEncPart.AuthTime, tgsRep.DecryptedEncPart.EndTime, tgsRep.DecryptedEncPart.RenewTill, tgsRep.DecryptedEncPart.Key)
+	return nil
+}
+
+// Validate a postdated service ticket held in the cache for the SPN specified once its start time has been reached.
+// The invalid ticket is sent to the KDC and the valid ticket returned replaces it in the cache.
+// Ref: RFC 4120 Section 2.3
+func (cl *Client) ValidateServiceTicket(spn string) error {
+	if cl.Session == nil {
+		return errors.New("Error client does not have a session. Client needs to login first")
+	}
+	e, ok := cl.Cache.GetEntry(spn)
+	if !ok || !e.Invalid {
+		return fmt.Errorf("No postdated ticket in the cache for %s", spn)
+	}
+	if cl.Config.Now().Before(e.StartTime) {
+		return fmt.Errorf("Postdated ticket for %s cannot be validated before its start time of %v", spn, e.StartTime)
+	}
+	o := messages.TicketOptions{Validate: true}
+	_, tgsRep, err := cl.tgsExchangeWithTicket(e.Ticket, e.SessionKey, e.Ticket.SName, false, o)
+	if cl.syncKDCTime(err) {
+		cl.observe(Event{Type: EventRetry, MsgType: msgtype.KRB_TGS_REQ, Text: "clock skew too great, using the KDC's time"})
+		_, tgsRep, err = cl.tgsExchangeWithTicket(e.Ticket, e.SessionKey, e.Ticket.SName, false, o)
+	}
+	if err != nil {
+		return fmt.Errorf("Error validating ticket for %s: %v", spn, err)
+	}
+	if types.IsFlagSet(&tgsRep.DecryptedEncPart.Flags, types.Invalid) {
+		return fmt.Errorf("Ticket for %s returned by the KDC is still invalid", spn)
+	}
+	cl.Cache.AddEntryWithSessionKey(tgsRep.Ticket, tgsRep.DecryptedEncPart.AuthTime, tgsRep.DecryptedEncPart.EndTime, tgsRep.DecryptedEncPart.RenewTill, tgsRep.DecryptedEncPart.Key)
 	return nil
 }
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Create a client with a session for testuser1 in the TEST.GOKRB5 realm.
+func testSessionClient(t *testing.T, sessionKey types.EncryptionKey) *Client {
+	c, err := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c)
+	now := time.Now().UTC()
+	cl.Session = &Session{
+		CRealm:     "TEST.GOKRB5",
+		CName:      cl.Credentials.CName,
+		AuthTime:   now.Add(-time.Minute),
+		EndTime:    now.Add(time.Hour),
+		TGT:        types.Ticket{TktVNO: 5, Realm: "TEST.GOKRB5", SName: types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: []string{"krbtgt", "TEST.GOKRB5"}}},
+		SessionKey: sessionKey,
+		Flags:      types.NewKrbFlags(),
+	}
+	return &cl
+}
+
+func TestClient_ValidateServiceTicket(t *testing.T) {
+	tgtKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	postdatedKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	validKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	cl := testSessionClient(t, tgtKey)
+	now := time.Now().UTC()
+	tkt := types.Ticket{TktVNO: 5, Realm: "TEST.GOKRB5", SName: types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"HTTP", "host.test.gokrb5"}}}
+	cl.Cache.AddInvalidEntry(tkt, now.Add(-time.Hour), now.Add(time.Minute), now.Add(time.Hour), time.Time{}, postdatedKey)
+
+	err := cl.ValidateServiceTicket("HTTP/host.test.gokrb5")
+	assert.Error(t, err, "Ticket should not be validated before its start time")
+	cl.Cache.AddInvalidEntry(tkt, now.Add(-time.Hour), now.Add(-time.Minute), now.Add(time.Hour), time.Time{}, postdatedKey)
+
+	// The KDC decrypts the postdated ticket with its own key so the fake only needs the ticket's session key
+	var validate bool
+	cl.WithTransport(testTGS(postdatedKey, func(tgsReq messages.TGSReq, auth types.Authenticator) (types.Ticket, messages.EncKDCRepPart) {
+		validate = types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, types.Validate)
+		return tkt, messages.EncKDCRepPart{
+			Key:       validKey,
+			LastReqs:  []messages.LastReq{},
+			Flags:     types.NewKrbFlags(),
+			AuthTime:  now.Add(-time.Hour),
+			StartTime: now.Add(-time.Minute),
+			EndTime:   now.Add(time.Hour),
+		}
+	}))
+	err = cl.ValidateServiceTicket("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("Error validating ticket: %v", err)
+	}
+	assert.True(t, validate, "Validate option not set in the TGS_REQ")
+	_, key, ok := cl.Cache.GetTicketAndSessionKey("HTTP/host.test.gokrb5")
+	assert.True(t, ok, "Validated ticket not returned from the cache")
+	assert.Equal(t, validKey.KeyValue, key.KeyValue, "Session key of the validated ticket not as expected")
+
+	err = cl.ValidateServiceTicket("HTTP/host.test.gokrb5")
+	assert.Error(t, err, "A valid ticket should not be validated again")
+}
+
+func TestClient_TGSExchange_subKey(t *testing.T) {
+	tgtKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	cl := testSessionClient(t, tgtKey)
+	now := time.Now().UTC()
+	spn := types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"HTTP", "host.test.gokrb5"}}
+	var subKey types.EncryptionKey
+	cl.WithTransport(testTGS(tgtKey, func(tgsReq messages.TGSReq, auth types.Authenticator) (types.Ticket, messages.EncKDCRepPart) {
+		subKey = auth.SubKey
+		return types.Ticket{TktVNO: 5, Realm: "TEST.GOKRB5", SName: spn}, messages.EncKDCRepPart{
+			Key:      sessionKey,
+			LastReqs: []messages.LastReq{},
+			Flags:    types.NewKrbFlags(),
+			AuthTime: now.Add(-time.Minute),
+			EndTime:  now.Add(time.Hour),
+		}
+	}))
+	var tests = []struct {
+		name   string
+		subKey bool
+	}{
+		{"session key", false},
+		{"sub-session key", true},
+	}
+	for _, test := range tests {
+		tgsReq, tgsRep, err := cl.TGSExchangeWithOptions(spn, false, messages.TicketOptions{SubKey: test.subKey})
+		if err != nil {
+			t.Fatalf("Error in TGS exchange with reply encrypted in the %s: %v", test.name, err)
+		}
+		assert.Equal(t, test.subKey, len(subKey.KeyValue) > 0, "Sub-session key presence not as expected for %s", test.name)
+		assert.Equal(t, subKey.KeyValue, tgsReq.SubKey.KeyValue, "Sub-session key of the request not as expected for %s", test.name)
+		assert.Equal(t, sessionKey.KeyValue, tgsRep.DecryptedEncPart.Key.KeyValue, "Session key in the reply not as expected for %s", test.name)
+	}
+}
+
+func TestClient_TGSExchange_authenticatorPrincipal(t *testing.T) {
+	tgtKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	cl := testSessionClient(t, tgtKey)
+	// A typed multi-component principal of a realm other than the default realm
+	cname := types.PrincipalName{NameType: nametype.KRB_NT_SRV_HST, NameString: []string{"host", "client.test.gokrb5"}}
+	cl.Credentials.CName = cname
+	cl.Session.CName = cname
+	cl.Session.CRealm = "OTHER.GOKRB5"
+	now := time.Now().UTC()
+	spn := types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"HTTP", "host.test.gokrb5"}}
+	var auth types.Authenticator
+	cl.WithTransport(testTGS(tgtKey, func(tgsReq messages.TGSReq, a types.Authenticator) (types.Ticket, messages.EncKDCRepPart) {
+		auth = a
+		return types.Ticket{TktVNO: 5, Realm: "TEST.GOKRB5", SName: spn}, messages.EncKDCRepPart{
+			Key:      sessionKey,
+			LastReqs: []messages.LastReq{},
+			Flags:    types.NewKrbFlags(),
+			AuthTime: now.Add(-time.Minute),
+			EndTime:  now.Add(time.Hour),
+		}
+	}))
+	_, _, err := cl.TGSExchange(spn, false)
+	if err != nil {
+		t.Fatalf("Error in TGS exchange: %v", err)
+	}
+	assert.Equal(t, "OTHER.GOKRB5", auth.CRealm, "Authenticator CRealm should be the client realm of the session")
+	assert.Equal(t, cname, auth.CName, "Authenticator CName should be the credentials' principal")
+}
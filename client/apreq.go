@@ -0,0 +1,39 @@
+package client
+
+import (
+	"fmt"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+)
+
+// Create an AP_REQ to send to the service using the ticket in the cache for the SPN specified.
+// The authenticator carries a random sub-session key and initial sequence number for the application protocol.
+// The authenticator is returned with the AP_REQ so that these are available to the application. Once any AP_REP has
+// been received messages.NegotiatedKey gives the key to use, along with the session key returned.
+func (cl *Client) NewAPReq(spn string) (messages.APReq, types.Authenticator, types.EncryptionKey, error) {
+	tkt, key, ok := cl.Cache.getTicket(spn, cl.Config.Now())
+	if !ok {
+		return messages.APReq{}, types.Authenticator{}, key, fmt.Errorf("No valid ticket in the cache for %s", spn)
+	}
+	auth := cl.newAuthenticator()
+	err := messages.GenerateSubKeyAndSeqNumber(&auth, key.KeyType)
+	if err != nil {
+		return messages.APReq{}, auth, key, err
+	}
+	apReq, err := messages.NewAPReqWithKeyUsage(tkt, key, auth, keyusage.AP_REQ_AUTHENTICATOR)
+	return apReq, auth, key, err
+}
+
+// Create an authenticator for the client's principal at the current time.
+// The name, with its name type, is that of the credentials and the realm is that of the client's session.
+func (cl *Client) newAuthenticator() types.Authenticator {
+	realm := cl.clientRealm(cl.Credentials)
+	if cl.Session != nil {
+		realm = cl.Session.CRealm
+	}
+	auth := types.NewAuthenticator(realm, "")
+	auth.CName = cl.Credentials.CName
+	auth.SetTime(cl.Config.Now())
+	return auth
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/credentials"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestClient_NewAPReq_authenticatorPrincipal(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	cname := types.PrincipalName{NameType: nametype.KRB_NT_SRV_HST, NameString: []string{"host", "app01.test.gokrb5"}}
+	creds := credentials.NewCredentialsFromPrincipal(cname, "OTHER.GOKRB5")
+	cl := NewClientWithPassword("", "", "")
+	cl.Credentials = creds.WithPassword("passwordvalue")
+	cl.WithConfig(c)
+	cl.Session = &Session{CRealm: "OTHER.GOKRB5", CName: cname}
+
+	now := time.Now().UTC()
+	sessionKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	tkt := types.Ticket{
+		TktVNO: 5,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: []string{"HTTP", "host.test.gokrb5"}},
+	}
+	cl.Cache.AddEntryWithSessionKey(tkt, now.Add(-time.Minute), now.Add(time.Hour), now.Add(time.Hour), sessionKey)
+	_, auth, _, err := cl.NewAPReq("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("Error creating AP_REQ: %v", err)
+	}
+	assert.Equal(t, cname, auth.CName, "Authenticator CName should keep the credentials' name type")
+	assert.Equal(t, "OTHER.GOKRB5", auth.CRealm, "Authenticator CRealm should be that of the session")
+}
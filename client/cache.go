@@ -9,14 +9,19 @@ import (
 // Client ticket cache.
 type Cache struct {
 	Entries map[string]CacheEntry
+	// The clock ticket times are checked against. If nil the host's clock is used.
+	now func() time.Time
 }
 
 // Ticket cache entry.
 type CacheEntry struct {
-	Ticket    types.Ticket
-	AuthTime  time.Time
-	EndTime   time.Time
-	RenewTill time.Time
+	Ticket     types.Ticket
+	AuthTime   time.Time
+	StartTime  time.Time
+	EndTime    time.Time
+	RenewTill  time.Time
+	SessionKey types.EncryptionKey
+	Invalid    bool
 }
 
 // Create a new client ticket cache.
@@ -26,6 +31,21 @@ func NewCache() *Cache {
 	}
 }
 
+// Create a new client ticket cache whose ticket times are checked against the clock provided.
+func newCacheWithClock(now func() time.Time) *Cache {
+	c := NewCache()
+	c.now = now
+	return c
+}
+
+// Get the current time from the cache's clock.
+func (c *Cache) timeNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
 // Get a cache entry that matches the SPN.
 func (c *Cache) GetEntry(spn string) (CacheEntry, bool) {
 	e, ok := (*c).Entries[spn]
@@ -33,25 +53,61 @@ func (c *Cache) GetEntry(spn string) (CacheEntry, bool) {
 }
 
 // Get a ticket from the cache for the SPN.
-// Only a ticket that is currently valid will be returned.
+// Only a ticket that is currently valid will be returned. Invalid tickets, such as postdated tickets that have not
+// been validated, are not returned.
+// For a client's cache the current time is that of the client's configuration, which is corrected by the offset of
+// the KDC's clock if kdc_timesync is enabled.
 func (c *Cache) GetTicket(spn string) (types.Ticket, bool) {
-	if e, ok := c.GetEntry(spn); ok {
+	tkt, _, ok := c.getTicket(spn, c.timeNow())
+	return tkt, ok
+}
+
+// Get a ticket and its session key from the cache for the SPN.
+// Only a ticket that is currently valid will be returned.
+func (c *Cache) GetTicketAndSessionKey(spn string) (types.Ticket, types.EncryptionKey, bool) {
+	return c.getTicket(spn, c.timeNow())
+}
+
+// Get a ticket and its session key from the cache for the SPN that is valid at the time provided.
+func (c *Cache) getTicket(spn string, now time.Time) (types.Ticket, types.EncryptionKey, bool) {
+	if e, ok := c.GetEntry(spn); ok && !e.Invalid {
 		//If within time window of ticket return it
-		if time.Now().After(e.AuthTime) && time.Now().Before(e.EndTime) {
-			return e.Ticket, true
+		if now.After(e.AuthTime) && now.After(e.StartTime) && now.Before(e.EndTime) {
+			return e.Ticket, e.SessionKey, true
 		}
 	}
 	var tkt types.Ticket
-	return tkt, false
+	var key types.EncryptionKey
+	return tkt, key, false
 }
 
 // Add a ticket to the cache.
 func (c *Cache) AddEntry(tkt types.Ticket, authTime, endTime, renewTill time.Time) {
+	c.AddEntryWithSessionKey(tkt, authTime, endTime, renewTill, types.EncryptionKey{})
+}
+
+// Add a ticket and its session key to the cache.
+func (c *Cache) AddEntryWithSessionKey(tkt types.Ticket, authTime, endTime, renewTill time.Time, sessionKey types.EncryptionKey) {
+	(*c).Entries[strings.Join(tkt.SName.NameString, "/")] = CacheEntry{
+		Ticket:     tkt,
+		AuthTime:   authTime,
+		EndTime:    endTime,
+		RenewTill:  renewTill,
+		SessionKey: sessionKey,
+	}
+}
+
+// Add a ticket to the cache that is not valid until validated by the KDC, such as a postdated ticket.
+// The entry is kept until it is replaced by the validated ticket.
+func (c *Cache) AddInvalidEntry(tkt types.Ticket, authTime, startTime, endTime, renewTill time.Time, sessionKey types.EncryptionKey) {
 	(*c).Entries[strings.Join(tkt.SName.NameString, "/")] = CacheEntry{
-		Ticket:    tkt,
-		AuthTime:  authTime,
-		EndTime:   endTime,
-		RenewTill: renewTill,
+		Ticket:     tkt,
+		AuthTime:   authTime,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		RenewTill:  renewTill,
+		SessionKey: sessionKey,
+		Invalid:    true,
 	}
 }
 
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCache_AddInvalidEntry(t *testing.T) {
+	c := NewCache()
+	tkt := types.Ticket{
+		Realm: "TEST.GOKRB5",
+		SName: types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"HTTP", "host.test.gokrb5"}},
+	}
+	now := time.Now()
+	c.AddInvalidEntry(tkt, now.Add(-time.Hour), now.Add(-time.Minute), now.Add(time.Hour), now.Add(time.Hour), types.EncryptionKey{})
+	_, ok := c.GetEntry("HTTP/host.test.gokrb5")
+	assert.True(t, ok, "Invalid ticket not kept in the cache")
+	_, ok = c.GetTicket("HTTP/host.test.gokrb5")
+	assert.False(t, ok, "Invalid ticket should not be returned")
+	c.AddEntry(tkt, now.Add(-time.Hour), now.Add(time.Hour), now.Add(time.Hour))
+	_, ok = c.GetTicket("HTTP/host.test.gokrb5")
+	assert.True(t, ok, "Validated ticket not returned")
+}
+
+func TestCache_GetTicket_kdcTimeOffset(t *testing.T) {
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	now := time.Now()
+	// The KDC's clock is two hours ahead of the host's
+	cl.Config.SetKDCTime(now.Add(2 * time.Hour))
+	valid := types.Ticket{Realm: "TEST.GOKRB5", SName: types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"HTTP", "valid.test.gokrb5"}}}
+	cl.Cache.AddEntry(valid, now.Add(time.Hour), now.Add(3*time.Hour), now.Add(3*time.Hour))
+	expired := types.Ticket{Realm: "TEST.GOKRB5", SName: types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"HTTP", "expired.test.gokrb5"}}}
+	cl.Cache.AddEntry(expired, now.Add(-time.Hour), now.Add(time.Hour), now.Add(time.Hour))
+	_, ok := cl.Cache.GetTicket("HTTP/valid.test.gokrb5")
+	assert.True(t, ok, "Ticket valid at the KDC's time not returned")
+	_, _, ok = cl.Cache.GetTicketAndSessionKey("HTTP/expired.test.gokrb5")
+	assert.False(t, ok, "Ticket expired at the KDC's time should not be returned")
+
+	// The cache follows the configuration set on the client
+	c := config.NewConfig()
+	cl.WithConfig(c)
+	_, ok = cl.Cache.GetTicket("HTTP/valid.test.gokrb5")
+	assert.False(t, ok, "Ticket not yet valid at the time of the new configuration should not be returned")
+}
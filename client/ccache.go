@@ -0,0 +1,100 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/credentials"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/types"
+	"time"
+)
+
+// Create a new client from a credentials cache, such as one populated by kinit.
+// The client's session is the TGT for the realm of the cache's default principal and the service tickets in the cache
+// are added to the client's ticket cache. The client has no keytab or password so it can be used until the TGT
+// expires, renewing it if it is renewable, but cannot login again.
+// The configuration provides the KDCs to contact. If it has no default realm the realm of the client principal is used.
+func NewClientFromCCache(c credentials.CCache, cfg *config.Config) (Client, error) {
+	if cfg == nil {
+		return Client{}, errors.New("Error a configuration is required to create a client from a credentials cache")
+	}
+	now := cfg.Now()
+	s, err := newSessionFromCCache(c, now)
+	if err != nil {
+		return Client{}, err
+	}
+	creds := credentials.NewCredentialsFromPrincipal(c.GetClientPrincipalName(), c.GetClientRealm())
+	cl := Client{
+		Credentials: &creds,
+		Config:      cfg,
+		Session:     s,
+		Cache:       newCacheWithClock(cfg.Now),
+	}
+	if cl.Config.LibDefaults.Default_realm == "" {
+		cl.Config.LibDefaults.Default_realm = c.GetClientRealm()
+	}
+	for _, cred := range c.Credentials {
+		// Skip configuration entries, TGTs and expired tickets
+		if len(cred.Server.PrincipalName.NameString) < 1 || cred.Server.PrincipalName.NameString[0] == "krbtgt" || now.After(cred.EndTime) {
+			continue
+		}
+		tkt, err := types.UnmarshalTicket(cred.Ticket)
+		if err != nil {
+			// Configuration entries do not contain a ticket
+			continue
+		}
+		if types.IsFlagSet(&cred.TicketFlags, types.Invalid) {
+			cl.Cache.AddInvalidEntry(tkt, cred.AuthTime, cred.StartTime, cred.EndTime, cred.RenewTill, cred.Key)
+			continue
+		}
+		cl.Cache.AddEntryWithSessionKey(tkt, cred.AuthTime, cred.EndTime, cred.RenewTill, cred.Key)
+	}
+	return cl, nil
+}
+
+// Create a new client from the default credentials cache and the default configuration file.
+// The cache is that named by the KRB5CCNAME environment variable, otherwise /tmp/krb5cc_<uid>. The configuration file
+// is the first listed in the KRB5_CONFIG environment variable, otherwise /etc/krb5.conf.
+func NewClientFromDefaultCCache() (Client, error) {
+	c, err := credentials.LoadDefaultCCache()
+	if err != nil {
+		return Client{}, fmt.Errorf("Error loading default credentials cache: %v", err)
+	}
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return Client{}, fmt.Errorf("Error loading default configuration: %v", err)
+	}
+	return NewClientFromCCache(c, cfg)
+}
+
+// Create a session from the TGT in the credentials cache for the realm of the cache's default principal.
+func newSessionFromCCache(c credentials.CCache, now time.Time) (*Session, error) {
+	realm := c.GetClientRealm()
+	spn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"krbtgt", realm},
+	}
+	cred, ok := c.GetEntry(spn)
+	if !ok {
+		return nil, fmt.Errorf("Credentials cache does not contain a TGT for realm %s", realm)
+	}
+	if now.After(cred.EndTime) {
+		return nil, fmt.Errorf("TGT in credentials cache for realm %s has expired", realm)
+	}
+	tkt, err := types.UnmarshalTicket(cred.Ticket)
+	if err != nil {
+		return nil, fmt.Errorf("Error unmarshalling TGT from credentials cache: %v", err)
+	}
+	return &Session{
+		CRealm:     cred.Client.Realm,
+		CName:      cred.Client.PrincipalName,
+		AuthTime:   cred.AuthTime,
+		StartTime:  cred.StartTime,
+		EndTime:    cred.EndTime,
+		RenewTill:  cred.RenewTill,
+		TGT:        tkt,
+		SessionKey: cred.Key,
+		Flags:      cred.TicketFlags,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/credentials"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Create a credentials cache credential for testuser1 to the server principal specified.
+func testCCacheCredential(t *testing.T, realm string, name []string, endTime time.Time, flags ...int) credentials.CCacheCredential {
+	princ := types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: name}
+	tkt := types.Ticket{TktVNO: 5, Realm: "TEST.GOKRB5", SName: princ}
+	b, err := tkt.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling ticket: %v", err)
+	}
+	key, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	f := types.NewKrbFlags()
+	for _, flag := range flags {
+		types.SetFlag(&f, flag)
+	}
+	return credentials.CCacheCredential{
+		Client:      credentials.CCachePrincipal{Realm: "TEST.GOKRB5", PrincipalName: types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"testuser1"}}},
+		Server:      credentials.CCachePrincipal{Realm: realm, PrincipalName: princ},
+		Key:         key,
+		AuthTime:    endTime.Add(-10 * time.Hour),
+		StartTime:   endTime.Add(-10 * time.Hour),
+		EndTime:     endTime,
+		TicketFlags: f,
+		Ticket:      b,
+	}
+}
+
+func TestNewClientFromCCache(t *testing.T) {
+	now := time.Now().UTC()
+	tgt := testCCacheCredential(t, "TEST.GOKRB5", []string{"krbtgt", "TEST.GOKRB5"}, now.Add(time.Hour), types.Forwardable)
+	valid := testCCacheCredential(t, "TEST.GOKRB5", []string{"HTTP", "valid.test.gokrb5"}, now.Add(time.Hour))
+	expired := testCCacheCredential(t, "TEST.GOKRB5", []string{"HTTP", "expired.test.gokrb5"}, now.Add(-time.Minute))
+	postdated := testCCacheCredential(t, "TEST.GOKRB5", []string{"HTTP", "postdated.test.gokrb5"}, now.Add(time.Hour), types.Invalid)
+	conf := credentials.CCacheCredential{
+		Server: credentials.CCachePrincipal{Realm: "X-CACHECONF:", PrincipalName: types.PrincipalName{NameString: []string{"krb5_ccache_conf_data", "pa_type"}}},
+		Ticket: []byte("2"),
+	}
+	c := credentials.CCache{
+		Version:          4,
+		DefaultPrincipal: credentials.CCachePrincipal{Realm: "TEST.GOKRB5", PrincipalName: types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"testuser1"}}},
+		Credentials:      []credentials.CCacheCredential{conf, tgt, valid, expired, postdated},
+	}
+
+	_, err := NewClientFromCCache(c, nil)
+	assert.Error(t, err, "Client should not be created without a configuration")
+	cfg, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	cl, err := NewClientFromCCache(c, cfg)
+	if err != nil {
+		t.Fatalf("Error creating client from credentials cache: %v", err)
+	}
+	assert.True(t, cl.Config == cfg, "Configuration provided not used")
+	assert.Equal(t, "TEST.GOKRB5", cl.Config.LibDefaults.Default_realm, "Default realm not as expected")
+	assert.Equal(t, []string{"testuser1"}, cl.Credentials.CName.NameString, "Client name not as expected")
+	assert.Equal(t, []string{"krbtgt", "TEST.GOKRB5"}, cl.Session.TGT.SName.NameString, "Session TGT not as expected")
+	assert.Equal(t, tgt.Key.KeyValue, cl.Session.SessionKey.KeyValue, "Session key not as expected")
+	assert.True(t, types.IsFlagSet(&cl.Session.Flags, types.Forwardable), "Session flags not as expected")
+
+	assert.Equal(t, 2, len(cl.Cache.Entries), "Number of cache entries not as expected")
+	_, key, ok := cl.Cache.GetTicketAndSessionKey("HTTP/valid.test.gokrb5")
+	assert.True(t, ok, "Service ticket not added to the cache")
+	assert.Equal(t, valid.Key.KeyValue, key.KeyValue, "Service ticket session key not as expected")
+	_, ok = cl.Cache.GetEntry("HTTP/expired.test.gokrb5")
+	assert.False(t, ok, "Expired service ticket should be skipped")
+	e, ok := cl.Cache.GetEntry("HTTP/postdated.test.gokrb5")
+	assert.True(t, ok && e.Invalid, "Postdated service ticket should be cached as invalid")
+	_, ok = cl.Cache.GetTicket("HTTP/postdated.test.gokrb5")
+	assert.False(t, ok, "Invalid service ticket should not be returned")
+
+	c.Credentials = []credentials.CCacheCredential{testCCacheCredential(t, "TEST.GOKRB5", []string{"krbtgt", "TEST.GOKRB5"}, now.Add(-time.Minute))}
+	_, err = NewClientFromCCache(c, cfg)
+	assert.Error(t, err, "Client should not be created from an expired TGT")
+}
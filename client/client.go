@@ -2,42 +2,103 @@
 package client
 
 import (
+	"crypto/tls"
+	"github.com/jcmturner/asn1"
 	"github.com/jcmturner/gokrb5/config"
 	"github.com/jcmturner/gokrb5/credentials"
 	"github.com/jcmturner/gokrb5/keytab"
+	"github.com/jcmturner/gokrb5/otp"
+	"github.com/jcmturner/gokrb5/prompt"
+	"github.com/jcmturner/gokrb5/spake"
+	"sync/atomic"
+	"time"
 )
 
 // Client struct.
 type Client struct {
-	Credentials *credentials.Credentials
-	Config      *config.Config
-	Session     *Session
-	Cache       *Cache
+	Credentials  *credentials.Credentials
+	Config       *config.Config
+	Session      *Session
+	Cache        *Cache
+	FASTArmor    *Session
+	SPAKEFactors []spake.SecondFactor
+	OTPPrompter  otp.Prompter
+	// TLS configuration for connections to KDC proxies. If nil the default configuration is used.
+	KDCProxyTLSConfig *tls.Config
+	// Transport used to send messages to servers. If nil the built in UDP and TCP transport is used.
+	Transport Transport
+	// The built in *NetworkTransport. It is accessed atomically as it is also used by the session renewal goroutine.
+	networkTransport atomic.Value
+	// Observer notified of events during exchanges with the KDC.
+	Observer Observer
+	// If set, PA-PAC-REQUEST is sent in AS exchanges asking for the PAC to be included or left out of the ticket.
+	PACRequest *bool
+	// If set, PA-PAC-OPTIONS with these flags is sent in TGS exchanges.
+	PACOptions *asn1.BitString
+	// Called after login if the password or account expires within the ExpiryWarningPeriod.
+	ExpiryWarning ExpiryWarningFunc
+	// Period before expiry within which the ExpiryWarning is called. If zero DefaultExpiryWarningPeriod is used.
+	ExpiryWarningPeriod time.Duration
+	// Prompter for a new password when login fails because the client's password has expired.
+	ChangePasswordPrompter ChangePasswordPrompter
+	// Prompter for secret input, such as the password, when the KDC asks for it.
+	Prompter prompt.Prompter
+}
+
+// Set whether AS exchanges should ask for the PAC to be included in the ticket issued.
+// Leaving out the PAC results in smaller tickets where the services do not need the authorization data.
+func (cl *Client) WithPACRequest(includePAC bool) *Client {
+	cl.PACRequest = &includePAC
+	return cl
+}
+
+// Set the PA-PAC-OPTIONS flags sent in TGS exchanges. The flags are set with types.SetFlag using the
+// types.PACOption constants.
+func (cl *Client) WithPACOptions(flags asn1.BitString) *Client {
+	cl.PACOptions = &flags
+	return cl
 }
 
 // Create a new client with a password credential.
 func NewClientWithPassword(username, realm, password string) Client {
 	creds := credentials.NewCredentials(username, realm)
+	cfg := config.NewConfig()
 	return Client{
 		Credentials: creds.WithPassword(password),
-		Config:      config.NewConfig(),
-		Cache:       NewCache(),
+		Config:      cfg,
+		Cache:       newCacheWithClock(cfg.Now),
 	}
 }
 
 // Create a new client with a keytab credential.
 func NewClientWithKeytab(username, realm string, kt keytab.Keytab) Client {
 	creds := credentials.NewCredentials(username, realm)
+	cfg := config.NewConfig()
 	return Client{
 		Credentials: creds.WithKeytab(kt),
-		Config:      config.NewConfig(),
-		Cache:       NewCache(),
+		Config:      cfg,
+		Cache:       newCacheWithClock(cfg.Now),
+	}
+}
+
+// Create a new client with a key provider credential. The provider supplies the client's long term key on demand.
+func NewClientWithKeyProvider(username, realm string, p credentials.KeyProvider) Client {
+	creds := credentials.NewCredentials(username, realm)
+	cfg := config.NewConfig()
+	return Client{
+		Credentials: creds.WithKeyProvider(p),
+		Config:      cfg,
+		Cache:       newCacheWithClock(cfg.Now),
 	}
 }
 
 // Set the Kerberos configuration for the client.
+// The times of tickets in the client's cache are checked against the time of the configuration.
 func (cl *Client) WithConfig(cfg *config.Config) *Client {
 	cl.Config = cfg
+	if cl.Cache != nil {
+		cl.Cache.now = cfg.Now
+	}
 	return cl
 }
 
@@ -47,17 +108,29 @@ func (cl *Client) LoadConfig(cfgPath string) (*Client, error) {
 	if err != nil {
 		return cl, err
 	}
-	cl.Config = cfg
-	return cl, nil
+	return cl.WithConfig(cfg), nil
+}
+
+// The realm of the client's principal. This is the realm of the credentials, or the default realm if they have none.
+func (cl *Client) clientRealm(creds *credentials.Credentials) string {
+	if creds.Realm != "" {
+		return creds.Realm
+	}
+	return cl.Config.LibDefaults.Default_realm
 }
 
 // Has the client got sufficient values required.
 func (cl *Client) IsConfigured() bool {
-	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeytab() {
-		return false
-	}
-	if cl.Credentials.Username == "" {
-		return false
+	// Anonymous PKINIT needs no credentials
+	if !cl.Credentials.IsAnonymous() {
+		// OTP pre-authentication is only performed within FAST
+		hasOTP := cl.OTPPrompter != nil && cl.FASTArmor != nil
+		if !cl.Credentials.HasKey() && !cl.Credentials.HasCertificate() && !hasOTP && cl.Prompter == nil {
+			return false
+		}
+		if cl.Credentials.Username == "" {
+			return false
+		}
 	}
 	if cl.Config.LibDefaults.Default_realm == "" {
 		return false
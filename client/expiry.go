@@ -0,0 +1,97 @@
+package client
+
+import (
+	"fmt"
+	"github.com/jcmturner/gokrb5/credentials"
+	"github.com/jcmturner/gokrb5/iana/errorcode"
+	"github.com/jcmturner/gokrb5/messages"
+	"time"
+)
+
+// The period before password or account expiry within which the client's ExpiryWarning is called by default.
+const DefaultExpiryWarningPeriod = 7 * 24 * time.Hour
+
+// ExpiryType indicates what is due to expire.
+type ExpiryType int
+
+const (
+	PasswordExpiry ExpiryType = iota
+	AccountExpiry
+)
+
+// String returns the name of what is due to expire.
+func (t ExpiryType) String() string {
+	if t == AccountExpiry {
+		return "account"
+	}
+	return "password"
+}
+
+// ExpiryWarningFunc is called with what is due to expire and when.
+type ExpiryWarningFunc func(t ExpiryType, expires time.Time)
+
+// ChangePasswordPrompter returns a new password for the principal when its password has expired.
+type ChangePasswordPrompter func(principal string) (string, error)
+
+// Set the function called when the client's password or account expires within the period specified.
+// If the period is zero DefaultExpiryWarningPeriod is used.
+func (cl *Client) WithExpiryWarning(period time.Duration, f ExpiryWarningFunc) *Client {
+	cl.ExpiryWarningPeriod = period
+	cl.ExpiryWarning = f
+	return cl
+}
+
+// Set the prompter for a new password used when login fails because the client's password has expired.
+// The password is changed with the kpasswd protocol and login is retried with the new password.
+// After a change the client's long term key is always derived from the new password. A keytab or KeyProvider the
+// client has is replaced by a provider of the new password as it would otherwise still provide the old key. A keytab
+// file is not updated.
+func (cl *Client) WithChangePasswordPrompter(p ChangePasswordPrompter) *Client {
+	cl.ChangePasswordPrompter = p
+	return cl
+}
+
+// Call the client's ExpiryWarning if the password or account expires within the warning period.
+func (cl *Client) warnExpiry(lr messages.LastReqInfo) {
+	if cl.ExpiryWarning == nil {
+		return
+	}
+	period := cl.ExpiryWarningPeriod
+	if period == 0 {
+		period = DefaultExpiryWarningPeriod
+	}
+	deadline := cl.Config.Now().Add(period)
+	if !lr.PasswordExpiration.IsZero() && lr.PasswordExpiration.Before(deadline) {
+		cl.ExpiryWarning(PasswordExpiry, lr.PasswordExpiration)
+	}
+	if !lr.AccountExpiration.IsZero() && lr.AccountExpiration.Before(deadline) {
+		cl.ExpiryWarning(AccountExpiry, lr.AccountExpiration)
+	}
+}
+
+// Query if the error is a KRB_ERROR indicating the client's password has expired.
+func isKeyExpired(err error) bool {
+	krberr, ok := err.(messages.KRBError)
+	return ok && krberr.ErrorCode == errorcode.KDC_ERR_KEY_EXPIRED
+}
+
+// Prompt for a new password and change the client's expired password to it.
+// The KDC issues a kadmin/changepw ticket for an expired password so the change is authenticated with the old one.
+// The change is authenticated with the credentials provided, those used for the AS exchange that found the password
+// expired. The new password is used for the client's long term key from then on, replacing any keytab or KeyProvider.
+func (cl *Client) changeExpiredPasswd(creds *credentials.Credentials) error {
+	newPasswd, err := cl.changePasswordPrompter()(cl.principal())
+	if err != nil {
+		return fmt.Errorf("Error getting new password: %v", err)
+	}
+	_, err = cl.changePasswd(newPasswd, creds)
+	if err != nil {
+		return fmt.Errorf("Error changing expired password: %v", err)
+	}
+	cl.Credentials.WithPassword(newPasswd)
+	if cl.Credentials.KeyProvider != nil || cl.Credentials.HasKeytab() {
+		// These would otherwise take precedence over the new password and still hold the old key
+		cl.Credentials.WithKeyProvider(credentials.PasswordKeyProvider(newPasswd))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/credentials"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/errorcode"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/kadmin"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestClient_warnExpiry(t *testing.T) {
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	warned := make(map[ExpiryType]time.Time)
+	cl.WithExpiryWarning(0, func(et ExpiryType, expires time.Time) {
+		warned[et] = expires
+	})
+	now := time.Now()
+	cl.warnExpiry(messages.LastReqInfo{
+		PasswordExpiration: now.Add(48 * time.Hour),
+		AccountExpiration:  now.Add(30 * 24 * time.Hour),
+	})
+	assert.Equal(t, 1, len(warned), "Only the password expiry should be warned of")
+	assert.Equal(t, now.Add(48*time.Hour), warned[PasswordExpiry], "Password expiry time not as expected")
+
+	warned = make(map[ExpiryType]time.Time)
+	cl.WithExpiryWarning(time.Hour, cl.ExpiryWarning)
+	cl.warnExpiry(messages.LastReqInfo{PasswordExpiration: now.Add(48 * time.Hour)})
+	assert.Equal(t, 0, len(warned), "Expiry outside the warning period should not be warned of")
+}
+
+func TestIsKeyExpired(t *testing.T) {
+	assert.True(t, isKeyExpired(messages.KRBError{ErrorCode: errorcode.KDC_ERR_KEY_EXPIRED}), "Key expired error not detected")
+	assert.False(t, isKeyExpired(messages.KRBError{ErrorCode: errorcode.KDC_ERR_PREAUTH_FAILED}), "Other KRB_ERROR should not be a key expired error")
+	assert.False(t, isKeyExpired(errors.New("error")), "Other error should not be a key expired error")
+}
+
+func TestClient_Login_keyExpired(t *testing.T) {
+	var tests = []struct {
+		name string
+		cl   Client
+	}{
+		{"password", NewClientWithPassword("testuser1", "TEST.GOKRB5", "oldpassword")},
+		{"key provider", NewClientWithKeyProvider("testuser1", "TEST.GOKRB5", credentials.PasswordKeyProvider("oldpassword"))},
+	}
+	for _, test := range tests {
+		cl := test.cl
+		c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+		c.Realms[0].Kpasswd_server = []string{"https://kdcproxy.test.gokrb5/KdcProxy"}
+		cl.WithConfig(c)
+		var prompted string
+		cl.WithChangePasswordPrompter(func(principal string) (string, error) {
+			prompted = principal
+			return "newpassword", nil
+		})
+
+		// The KDC rejects the old password for a TGT but issues a kadmin/changepw ticket with it
+		var requests []string
+		var changed string
+		changepwKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+		tgtKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+		cl.WithTransport(TransportFunc(func(realm, addr string, b []byte) ([]byte, error) {
+			if addr == "https://kdcproxy.test.gokrb5/KdcProxy" {
+				requests = append(requests, "kpasswd")
+				var rb []byte
+				var err error
+				changed, rb, err = testKpasswd(b, changepwKey, kadmin.KRB5_KPASSWD_SUCCESS)
+				return rb, err
+			}
+			var asReq messages.ASReq
+			if err := asReq.Unmarshal(b); err != nil {
+				return nil, fmt.Errorf("Error unmarshalling AS_REQ: %v", err)
+			}
+			now := time.Now().UTC().Truncate(time.Second)
+			switch asReq.ReqBody.SName.NameString[0] {
+			case "kadmin":
+				requests = append(requests, "kadmin/changepw")
+				return testASRep(asReq, "oldpassword", changepwKey, now)
+			case "krbtgt":
+				requests = append(requests, "krbtgt")
+				if changed == "" {
+					return testKRBError(errorcode.KDC_ERR_KEY_EXPIRED, realm, asReq.ReqBody.SName)
+				}
+				return testASRep(asReq, changed, tgtKey, now)
+			}
+			return nil, errors.New("Unexpected request")
+		}))
+		err := cl.Login()
+		if err != nil {
+			t.Fatalf("Error logging in with expired %s: %v", test.name, err)
+		}
+		assert.Equal(t, "testuser1@TEST.GOKRB5", prompted, "Principal prompted for not as expected")
+		assert.Equal(t, []string{"krbtgt", "kadmin/changepw", "kpasswd", "krbtgt"}, requests, "Requests not as expected")
+		assert.Equal(t, "newpassword", changed, "Password not changed to that prompted for")
+		assert.Equal(t, tgtKey.KeyValue, cl.Session.SessionKey.KeyValue, "Session key not that of the TGT issued after the change")
+		assert.Equal(t, "newpassword", cl.Credentials.Password, "Client's password not updated")
+		// A key provider is replaced as it would otherwise still provide the old key
+		key, err := cl.Credentials.GetKey(cl.Credentials.CName, "TEST.GOKRB5", etype.AES256_CTS_HMAC_SHA1_96, 0, types.PADataSequence{})
+		if err != nil {
+			t.Fatalf("Error getting key: %v", err)
+		}
+		newKey, _, _ := crypto.GetKeyFromPassword("newpassword", cl.Credentials.CName, "TEST.GOKRB5", etype.AES256_CTS_HMAC_SHA1_96, types.PADataSequence{})
+		assert.Equal(t, newKey.KeyValue, key.KeyValue, "Client's key not derived from the new password for %s", test.name)
+	}
+}
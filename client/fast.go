@@ -0,0 +1,97 @@
+package client
+
+import (
+	"fmt"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/credentials"
+	"github.com/jcmturner/gokrb5/keytab"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"time"
+)
+
+// Set the FAST armor ticket for the client.
+// AS exchanges will be armored with this ticket and TGS exchanges will use implicit TGS armor.
+func (cl *Client) WithFASTArmor(s *Session) *Client {
+	cl.FASTArmor = s
+	return cl
+}
+
+// Create FAST armor from the client's FAST armor ticket.
+func (cl *Client) newFASTArmor() (messages.FASTArmor, error) {
+	armor, err := messages.NewFASTArmor(cl.FASTArmor.TGT, cl.FASTArmor.SessionKey, cl.FASTArmor.CRealm, cl.FASTArmor.CName, cl.Config.Now())
+	if err != nil {
+		return armor, fmt.Errorf("Error creating FAST armor: %v", err)
+	}
+	return armor, nil
+}
+
+// Perform encrypted challenge pre-authentication within the FAST tunnel.
+// The challenge is bound to the armor key so the armor is created before the request is sent.
+// The client's long term key is returned as it is needed to verify the KDC's encrypted challenge in the reply.
+func (cl *Client) encChallengeExchange(a messages.ASReq, pas types.PADataSequence, creds *credentials.Credentials) (messages.ASReq, []byte, messages.ASRep, *types.EncryptionKey, error) {
+	var ar messages.ASRep
+	key, err := cl.preAuthKey(pas, creds)
+	if err != nil {
+		return a, nil, ar, nil, err
+	}
+	armor, err := cl.newFASTArmor()
+	if err != nil {
+		return a, nil, ar, nil, err
+	}
+	pa, err := armor.EncryptedChallengePAData(key, cl.Config.Now())
+	if err != nil {
+		return a, nil, ar, nil, err
+	}
+	a.FASTArmor = &armor
+	a.PAData = append(a.PAData, pa)
+	a.PAData = append(a.PAData, fxCookies(pas)...)
+	sent, sentb, ar, err := cl.sendASReq(a)
+	if err != nil {
+		return sent, sentb, ar, nil, err
+	}
+	return sent, sentb, ar, &key, nil
+}
+
+// Decrypt the AS_REP to an encrypted challenge pre-authenticated AS_REQ after verifying the KDC's encrypted challenge.
+func (cl *Client) decryptEncChallengeEncPart(ar *messages.ASRep, sent messages.ASReq, key types.EncryptionKey) error {
+	err := ar.ProcessFASTResponse(sent)
+	if err != nil {
+		return err
+	}
+	err = ar.VerifyEncryptedChallenge(cl.Config, sent, key)
+	if err != nil {
+		return err
+	}
+	return ar.DecryptEncPartWithKey(key)
+}
+
+// Get a TGT to use as FAST armor by logging in with the keytab provided. This is typically the host's keytab.
+func NewFASTArmorFromKeytab(username, realm string, kt keytab.Keytab, cfg *config.Config) (*Session, error) {
+	cl := NewClientWithKeytab(username, realm, kt)
+	cl.WithConfig(cfg)
+	err := cl.Login()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting FAST armor TGT: %v", err)
+	}
+	return cl.Session, nil
+}
+
+// Get an anonymous TGT to use as FAST armor with anonymous PKINIT.
+// This allows FAST to be used on hosts without a keytab. The KDC's certificate is validated against the PKINIT anchors
+// in the configuration. Ref: RFC 8062
+func NewFASTArmorAnonymous(realm string, cfg *config.Config) (*Session, error) {
+	cl := NewAnonymousClient(realm)
+	cl.WithConfig(cfg)
+	err := cl.Login()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting anonymous FAST armor TGT: %v", err)
+	}
+	return cl.Session, nil
+}
+
+// Get a TGT to use as FAST armor from a credentials cache.
+// The TGT for the realm of the cache's default principal is used.
+func NewFASTArmorFromCCache(c credentials.CCache) (*Session, error) {
+	return newSessionFromCCache(c, time.Now())
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"net"
+)
+
+// Request a forwarded TGT for use on the target host and package it in a KRB_CRED for credential delegation.
+// Unless noaddresses is set the TGT is restricted to the addresses of the target host.
+// The KRB_CRED is encrypted in the key provided, which is the session or sub-session key of the AP exchange with the
+// target, so that it can be embedded in a GSS-API or SPNEGO token. Ref: RFC 4120 Section 2.6
+func (cl *Client) ForwardTGT(host string, key types.EncryptionKey) (messages.KRBCred, error) {
+	if cl.Session == nil {
+		return messages.KRBCred{}, errors.New("Error client does not have a session. Client needs to login first")
+	}
+	if !types.IsFlagSet(&cl.Session.Flags, types.Forwardable) {
+		return messages.KRBCred{}, errors.New("Error client's TGT is not forwardable")
+	}
+	var addresses []types.HostAddress
+	if !cl.Config.LibDefaults.Noaddresses {
+		ips, err := net.LookupIP(host)
+		if err != nil {
+			return messages.KRBCred{}, fmt.Errorf("Error resolving addresses of %s: %v", host, err)
+		}
+		for _, ip := range ips {
+			a, err := types.HostAddressFromNetIP(ip)
+			if err == nil {
+				addresses = append(addresses, a)
+			}
+		}
+	}
+	spn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"krbtgt", cl.Session.TGT.Realm},
+	}
+	_, tgsRep, err := cl.TGSExchangeWithOptions(spn, false, messages.TicketOptions{Forwarded: true, Addresses: addresses})
+	if err != nil {
+		return messages.KRBCred{}, fmt.Errorf("Error getting forwarded TGT: %v", err)
+	}
+	if !types.IsFlagSet(&tgsRep.DecryptedEncPart.Flags, types.Forwarded) {
+		return messages.KRBCred{}, errors.New("TGT issued by the KDC is not forwarded")
+	}
+	info := messages.NewKrbCredInfo(tgsRep.CRealm, tgsRep.CName, tgsRep.DecryptedEncPart)
+	return messages.NewKRBCred([]types.Ticket{tgsRep.Ticket}, []messages.KrbCredInfo{info}, key, cl.Config.Now())
+}
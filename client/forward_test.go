@@ -0,0 +1,73 @@
+package client
+
+import (
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClient_ForwardTGT(t *testing.T) {
+	tgtKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	forwardedKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	credKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	cl := testSessionClient(t, tgtKey)
+	cl.Config.LibDefaults.Noaddresses = false
+	now := time.Now().UTC()
+
+	_, err := cl.ForwardTGT("127.0.0.1", credKey)
+	assert.Error(t, err, "TGT that is not forwardable should not be forwarded")
+	types.SetFlag(&cl.Session.Flags, types.Forwardable)
+
+	var forwarded bool
+	var addresses []types.HostAddress
+	cl.WithTransport(testTGS(tgtKey, func(tgsReq messages.TGSReq, auth types.Authenticator) (types.Ticket, messages.EncKDCRepPart) {
+		forwarded = types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, types.Forwarded)
+		addresses = tgsReq.ReqBody.Addresses
+		flags := types.NewKrbFlags()
+		types.SetFlag(&flags, types.Forwardable)
+		types.SetFlag(&flags, types.Forwarded)
+		return cl.Session.TGT, messages.EncKDCRepPart{
+			Key:      forwardedKey,
+			LastReqs: []messages.LastReq{},
+			Flags:    flags,
+			AuthTime: now.Add(-time.Minute),
+			EndTime:  now.Add(time.Hour),
+			CAddr:    tgsReq.ReqBody.Addresses,
+		}
+	}))
+	k, err := cl.ForwardTGT("127.0.0.1", credKey)
+	if err != nil {
+		t.Fatalf("Error forwarding TGT: %v", err)
+	}
+	assert.True(t, forwarded, "Forwarded option not set in the TGS_REQ")
+	loopback, _ := types.HostAddressFromNetIP(net.ParseIP("127.0.0.1"))
+	assert.True(t, types.HostAddressesEqual(addresses, []types.HostAddress{loopback}), "Addresses requested not those of the target host")
+
+	b, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling KRB_CRED: %v", err)
+	}
+	var cred messages.KRBCred
+	err = cred.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling KRB_CRED: %v", err)
+	}
+	err = cred.DecryptEncPart(credKey.KeyValue)
+	if err != nil {
+		t.Fatalf("Error decrypting KRB_CRED with the key provided: %v", err)
+	}
+	assert.Equal(t, 1, len(cred.Tickets), "Number of tickets not as expected")
+	assert.Len(t, cred.DecryptedEncPart.TicketInfo, 1, "Number of KrbCredInfo not as expected")
+	info := cred.DecryptedEncPart.TicketInfo[0]
+	assert.Equal(t, forwardedKey.KeyValue, info.Key.KeyValue, "Session key of the forwarded TGT not as expected")
+	assert.Equal(t, "TEST.GOKRB5", info.PRealm, "PRealm not as expected")
+	assert.Equal(t, []string{"testuser1"}, info.PName.NameString, "PName not as expected")
+	assert.Equal(t, []string{"krbtgt", "TEST.GOKRB5"}, info.SName.NameString, "SName not as expected")
+	assert.True(t, types.IsFlagSet(&info.Flags, types.Forwarded), "Forwarded flag not set")
+	assert.True(t, types.HostAddressesEqual(info.CAddr, []types.HostAddress{loopback}), "Addresses not as expected")
+}
@@ -0,0 +1,219 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/asn1tools"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana"
+	"github.com/jcmturner/gokrb5/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/msgtype"
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/kadmin"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"time"
+)
+
+type testMarshalKDCRep struct {
+	PVNO    int                  `asn1:"explicit,tag:0"`
+	MsgType int                  `asn1:"explicit,tag:1"`
+	PAData  types.PADataSequence `asn1:"explicit,optional,tag:2"`
+	CRealm  string               `asn1:"generalstring,explicit,tag:3"`
+	CName   types.PrincipalName  `asn1:"explicit,tag:4"`
+	Ticket  asn1.RawValue        `asn1:"explicit,tag:5"`
+	EncPart types.EncryptedData  `asn1:"explicit,tag:6"`
+}
+
+// The function a fake TGS uses to issue a ticket. It is given the TGS_REQ and the decrypted authenticator from its
+// PA-TGS-REQ and returns the ticket issued and the encrypted part of the reply. The nonce, service realm and name of
+// the encrypted part are set from the request.
+type testTGSIssuer func(tgsReq messages.TGSReq, auth types.Authenticator) (types.Ticket, messages.EncKDCRepPart)
+
+// A fake KDC that answers TGS_REQs authenticated with a ticket whose session key is provided.
+// The reply is encrypted in the sub-session key of the authenticator if there is one, otherwise in the session key.
+func testTGS(sessionKey types.EncryptionKey, issue testTGSIssuer) Transport {
+	return TransportFunc(func(realm, addr string, b []byte) ([]byte, error) {
+		var tgsReq messages.TGSReq
+		if err := tgsReq.Unmarshal(b); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling TGS_REQ: %v", err)
+		}
+		var apReq messages.APReq
+		for _, pa := range tgsReq.PAData {
+			if pa.PADataType == patype.PA_TGS_REQ {
+				if err := apReq.Unmarshal(pa.PADataValue); err != nil {
+					return nil, fmt.Errorf("Error unmarshalling PA-TGS-REQ: %v", err)
+				}
+			}
+		}
+		if len(apReq.Authenticator.Cipher) < 1 {
+			return nil, errors.New("TGS_REQ has no PA-TGS-REQ")
+		}
+		etype, err := crypto.GetEtype(sessionKey.KeyType)
+		if err != nil {
+			return nil, err
+		}
+		ab, err := crypto.DecryptEncPart(sessionKey.KeyValue, apReq.Authenticator, etype, keyusage.TGS_REQ_PA_TGS_REQ_AP_REQ_AUTHENTICATOR)
+		if err != nil {
+			return nil, fmt.Errorf("Error decrypting authenticator: %v", err)
+		}
+		var auth types.Authenticator
+		if err := auth.Unmarshal(ab); err != nil {
+			return nil, fmt.Errorf("Error unmarshalling authenticator: %v", err)
+		}
+		tkt, encPart := issue(tgsReq, auth)
+		encPart.Nonce = tgsReq.ReqBody.Nonce
+		encPart.SRealm = tgsReq.ReqBody.Realm
+		encPart.SName = tgsReq.ReqBody.SName
+		eb, err := asn1.Marshal(encPart)
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling encrypted part: %v", err)
+		}
+		eb = asn1tools.AddASNAppTag(eb, asnAppTag.EncTGSRepPart)
+		key, usage := sessionKey, keyusage.TGS_REP_ENCPART_SESSION_KEY
+		if len(auth.SubKey.KeyValue) > 0 {
+			key, usage = auth.SubKey, keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY
+		}
+		ed, err := crypto.GetEncryptedData(eb, key, usage, 0)
+		if err != nil {
+			return nil, fmt.Errorf("Error encrypting encrypted part: %v", err)
+		}
+		return testKDCRep(msgtype.KRB_TGS_REP, asnAppTag.TGSREP, tgsReq.ReqBody.Realm, tgsReq.ReqBody.CName, tkt, ed)
+	})
+}
+
+// Create the AS_REP the KDC would return for the AS_REQ, issuing a ticket with the session key provided.
+// The reply is encrypted in the key derived from the password.
+func testASRep(asReq messages.ASReq, password string, sessionKey types.EncryptionKey, now time.Time) ([]byte, error) {
+	replyKey, _, err := crypto.GetKeyFromPassword(password, asReq.ReqBody.CName, asReq.ReqBody.Realm, etype.AES256_CTS_HMAC_SHA1_96, types.PADataSequence{})
+	if err != nil {
+		return nil, fmt.Errorf("Error deriving reply key: %v", err)
+	}
+	encPart := messages.EncKDCRepPart{
+		Key:      sessionKey,
+		LastReqs: []messages.LastReq{},
+		Nonce:    asReq.ReqBody.Nonce,
+		Flags:    types.NewKrbFlags(),
+		AuthTime: now,
+		EndTime:  now.Add(time.Hour),
+		SRealm:   asReq.ReqBody.Realm,
+		SName:    asReq.ReqBody.SName,
+	}
+	eb, err := asn1.Marshal(encPart)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling encrypted part: %v", err)
+	}
+	eb = asn1tools.AddASNAppTag(eb, asnAppTag.EncASRepPart)
+	ed, err := crypto.GetEncryptedData(eb, replyKey, keyusage.AS_REP_ENCPART, 0)
+	if err != nil {
+		return nil, fmt.Errorf("Error encrypting encrypted part: %v", err)
+	}
+	tkt := types.Ticket{TktVNO: iana.PVNO, Realm: asReq.ReqBody.Realm, SName: asReq.ReqBody.SName}
+	return testKDCRep(msgtype.KRB_AS_REP, asnAppTag.ASREP, asReq.ReqBody.Realm, asReq.ReqBody.CName, tkt, ed)
+}
+
+func testKDCRep(msgType, tag int, realm string, cname types.PrincipalName, tkt types.Ticket, ed types.EncryptedData) ([]byte, error) {
+	tb, err := tkt.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling ticket: %v", err)
+	}
+	m := testMarshalKDCRep{
+		PVNO:    iana.PVNO,
+		MsgType: msgType,
+		CRealm:  realm,
+		CName:   cname,
+		Ticket:  asn1.RawValue{Class: 2, IsCompound: true, Tag: 5, Bytes: tb},
+		EncPart: ed,
+	}
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling KDC reply: %v", err)
+	}
+	return asn1tools.AddASNAppTag(b, tag), nil
+}
+
+// Create the KRB_ERROR the KDC would return with the error code provided.
+func testKRBError(errorCode int, realm string, sname types.PrincipalName) ([]byte, error) {
+	e := messages.KRBError{
+		PVNO:      iana.PVNO,
+		MsgType:   msgtype.KRB_ERROR,
+		STime:     time.Now().UTC().Truncate(time.Second),
+		ErrorCode: errorCode,
+		Realm:     realm,
+		SName:     sname,
+	}
+	b, err := asn1.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling KRB_ERROR: %v", err)
+	}
+	return asn1tools.AddASNAppTag(b, asnAppTag.KRBError), nil
+}
+
+// Process a kpasswd request as the kpasswd server would, returning the new password and a reply with the result code.
+// The request must be authenticated with a ticket whose session key is provided.
+func testKpasswd(b []byte, sessionKey types.EncryptionKey, resultCode int) (string, []byte, error) {
+	if len(b) < 6 || len(b) < 6+int(binary.BigEndian.Uint16(b[4:6])) {
+		return "", nil, errors.New("kpasswd request is too short")
+	}
+	al := int(binary.BigEndian.Uint16(b[4:6]))
+	var apReq messages.APReq
+	if err := apReq.Unmarshal(b[6 : 6+al]); err != nil {
+		return "", nil, fmt.Errorf("Error unmarshalling AP_REQ: %v", err)
+	}
+	apReq.DecryptedTicket.Key = sessionKey
+	if err := apReq.DecryptAuthenticator(); err != nil {
+		return "", nil, err
+	}
+	auth := apReq.DecryptedAuthenticator
+	var p messages.KRBPriv
+	if err := p.Unmarshal(b[6+al:]); err != nil {
+		return "", nil, fmt.Errorf("Error unmarshalling KRB_PRIV: %v", err)
+	}
+	pp, err := p.DecryptEncPart(auth.SubKey)
+	if err != nil {
+		return "", nil, err
+	}
+	ep := messages.EncAPRepPart{CTime: auth.CTime, Cusec: auth.Cusec, SequenceNumber: auth.SeqNumber}
+	epb, err := ep.Marshal()
+	if err != nil {
+		return "", nil, err
+	}
+	ed, err := crypto.GetEncryptedData(epb, sessionKey, keyusage.AP_REP_ENCPART, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	apRep := messages.APRep{PVNO: iana.PVNO, MsgType: msgtype.KRB_AP_REP, EncPart: ed}
+	ab, err := apRep.Marshal()
+	if err != nil {
+		return "", nil, err
+	}
+	rp := messages.EncKrbPrivPart{
+		UserData:       []byte{byte(resultCode >> 8), byte(resultCode)},
+		SequenceNumber: auth.SeqNumber,
+		SAddress:       types.NewHostAddressDirectional(false),
+	}
+	rpb, err := rp.Marshal()
+	if err != nil {
+		return "", nil, err
+	}
+	ed, err = crypto.GetEncryptedData(rpb, auth.SubKey, keyusage.KRB_PRIV_ENCPART, 0)
+	if err != nil {
+		return "", nil, err
+	}
+	rpriv := messages.KRBPriv{PVNO: iana.PVNO, MsgType: msgtype.KRB_PRIV, EncPart: ed}
+	pb, err := rpriv.Marshal()
+	if err != nil {
+		return "", nil, err
+	}
+	r := make([]byte, 6)
+	binary.BigEndian.PutUint16(r[0:2], uint16(6+len(ab)+len(pb)))
+	binary.BigEndian.PutUint16(r[2:4], kadmin.VersionChangePasswd)
+	binary.BigEndian.PutUint16(r[4:6], uint16(len(ab)))
+	r = append(r, ab...)
+	r = append(r, pb...)
+	return string(pp.UserData), r, nil
+}
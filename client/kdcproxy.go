@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/jcmturner/gokrb5/messages"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Set the TLS configuration used when connecting to a KDC proxy, for example to trust a private certificate authority.
+func (cl *Client) WithKDCProxyTLSConfig(c *tls.Config) *Client {
+	cl.KDCProxyTLSConfig = c
+	return cl
+}
+
+// Query if the server address is the URL of a KDC proxy. Ref: MS-KKDCP
+// KDC proxies are configured in the same way as other servers, for example kdc = https://kdc.example.com/KdcProxy
+func isKDCProxy(addr string) bool {
+	return strings.HasPrefix(strings.ToLower(addr), "https://")
+}
+
+// The maximum length of a response from a KDC proxy. This allows for the KDC-PROXY-MESSAGE encoding around a reply
+// of the maximum length accepted over TCP.
+const maxKDCProxyReplyLength = maxTCPReplyLength + 1024
+
+// Get the HTTP client used to send to KDC proxies. It is created once so that connections are reused.
+func (t *NetworkTransport) kdcProxyClient() *http.Client {
+	t.httpOnce.Do(func() {
+		ht := &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: t.TLSConfig,
+		}
+		if t.Dial != nil {
+			ht.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return t.Dial(network, addr)
+			}
+		}
+		t.httpClient = &http.Client{
+			Timeout:   t.timeout(10 * time.Second),
+			Transport: ht,
+		}
+	})
+	return t.httpClient
+}
+
+// Send the bytes to the KDC proxy at the URL for the realm specified.
+// The message is wrapped in a KDC-PROXY-MESSAGE and sent in the body of an HTTPS POST.
+func (t *NetworkTransport) sendKDCProxy(url, realm string, b []byte) ([]byte, error) {
+	m := messages.NewKDCProxyMessage(b, realm)
+	mb, err := m.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.kdcProxyClient().Post(url, "application/kerberos", bytes.NewReader(mb))
+	if err != nil {
+		return nil, fmt.Errorf("Error sending to KDC proxy: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("KDC proxy returned HTTP status: %s", resp.Status)
+	}
+	// The KDC-PROXY-MESSAGE wraps a reply that is limited to the same length as replies over TCP
+	rb, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxKDCProxyReplyLength+1))
+	if err != nil {
+		return nil, fmt.Errorf("Error reading response from KDC proxy: %v", err)
+	}
+	if len(rb) > maxKDCProxyReplyLength {
+		return nil, fmt.Errorf("Response from KDC proxy exceeds the maximum length of %d bytes", maxKDCProxyReplyLength)
+	}
+	var r messages.KDCProxyMessage
+	err = r.Unmarshal(rb)
+	if err != nil {
+		return nil, err
+	}
+	return r.Message()
+}
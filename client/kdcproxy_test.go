@@ -0,0 +1,67 @@
+package client
+
+import (
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNetworkTransport_KDCProxy(t *testing.T) {
+	var realm string
+	var requests int
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "POST", r.Method, "HTTP method not as expected")
+		assert.Equal(t, "application/kerberos", r.Header.Get("Content-Type"), "Content type not as expected")
+		b, _ := ioutil.ReadAll(r.Body)
+		var m messages.KDCProxyMessage
+		err := m.Unmarshal(b)
+		if err != nil {
+			t.Errorf("Error unmarshalling KDC-PROXY-MESSAGE: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		realm = m.TargetDomain
+		mb, _ := m.Message()
+		rm := messages.NewKDCProxyMessage(append([]byte("reply to "), mb...), "")
+		rb, _ := rm.Marshal()
+		w.Write(rb)
+	}))
+	defer s.Close()
+	tr := &NetworkTransport{TLSConfig: s.Client().Transport.(*http.Transport).TLSClientConfig}
+	for i := 0; i < 2; i++ {
+		rb, err := tr.Send("TEST.GOKRB5", s.URL+"/KdcProxy", []byte("request"))
+		if err != nil {
+			t.Fatalf("Error sending via KDC proxy: %v", err)
+		}
+		assert.Equal(t, []byte("reply to request"), rb, "Reply not as expected")
+	}
+	assert.Equal(t, "TEST.GOKRB5", realm, "Target domain not as expected")
+	assert.Equal(t, 2, requests, "Number of requests not as expected")
+	assert.True(t, tr.kdcProxyClient() == tr.kdcProxyClient(), "HTTP client should be reused")
+
+	// The server's certificate is not trusted without the TLS configuration
+	_, err := (&NetworkTransport{}).Send("TEST.GOKRB5", s.URL+"/KdcProxy", []byte("request"))
+	assert.Error(t, err, "KDC proxy with an untrusted certificate should not be used")
+}
+
+func TestNetworkTransport_KDCProxy_replyTooLong(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, maxKDCProxyReplyLength+1))
+	}))
+	defer s.Close()
+	tr := &NetworkTransport{TLSConfig: s.Client().Transport.(*http.Transport).TLSClientConfig}
+	_, err := tr.Send("TEST.GOKRB5", s.URL, []byte("request"))
+	assert.Error(t, err, "Reply longer than the maximum should not be accepted")
+}
+
+func TestClient_transport_reused(t *testing.T) {
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	tr := cl.transport()
+	assert.True(t, tr == cl.transport(), "Built in transport should be reused")
+	cl.Config.LibDefaults.Udp_preference_limit = 1
+	assert.False(t, tr == cl.transport(), "Built in transport should be replaced when the settings change")
+}
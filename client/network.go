@@ -1,92 +1,204 @@
 package client
 
 import (
-	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
+	"net/http"
+	"sync"
 	"time"
 )
 
-// Send bytes to the KDC.
+// Transport sends messages to Kerberos servers such as KDCs and kpasswd servers.
+// A client uses the built in NetworkTransport unless another is set, for example a fake for testing, a recorder or
+// one using a custom dialer.
+type Transport interface {
+	// Send the message to the server address for the realm specified and return the reply.
+	Send(realm, addr string, b []byte) ([]byte, error)
+}
+
+// An adapter to allow the use of a function as a Transport.
+type TransportFunc func(realm, addr string, b []byte) ([]byte, error)
+
+// Send the message by calling the function.
+func (f TransportFunc) Send(realm, addr string, b []byte) ([]byte, error) {
+	return f(realm, addr, b)
+}
+
+// The maximum length of a reply accepted over TCP. This is the limit used by MIT Kerberos and prevents a server
+// causing an excessive allocation.
+const maxTCPReplyLength = 1024 * 1024
+
+// The built in Transport using UDP and TCP, or HTTPS for KDC proxies.
+type NetworkTransport struct {
+	// Messages larger than this are sent using TCP first rather than UDP. A value of 1 means always use TCP.
+	UDPPreferenceLimit int
+	// TLS configuration for connections to KDC proxies. If nil the default configuration is used.
+	TLSConfig *tls.Config
+	// Function used to make connections, for example to use a SOCKS proxy or a particular source address.
+	// If nil a net.Dialer is used.
+	Dial func(network, addr string) (net.Conn, error)
+	// Timeout for each exchange with a server. If zero 5 seconds is used for UDP and TCP and 10 seconds for HTTPS.
+	Timeout time.Duration
+	// HTTP client for KDC proxies, created on first use so that connections are reused. Changes to TLSConfig, Dial or
+	// Timeout after the first message is sent to a KDC proxy have no effect on it.
+	httpOnce   sync.Once
+	httpClient *http.Client
+}
+
+// Set the transport used by the client to send messages to servers.
+func (cl *Client) WithTransport(t Transport) *Client {
+	cl.Transport = t
+	return cl
+}
+
+// Get the client's transport, or the built in transport configured from the client's settings if none is set.
+// The built in transport is kept so that connections to KDC proxies are reused, unless the settings change.
+// It is safe to call from multiple goroutines.
+func (cl *Client) transport() Transport {
+	if cl.Transport != nil {
+		return cl.Transport
+	}
+	t, _ := cl.networkTransport.Load().(*NetworkTransport)
+	if t == nil || t.UDPPreferenceLimit != cl.Config.LibDefaults.Udp_preference_limit || t.TLSConfig != cl.KDCProxyTLSConfig {
+		t = &NetworkTransport{
+			UDPPreferenceLimit: cl.Config.LibDefaults.Udp_preference_limit,
+			TLSConfig:          cl.KDCProxyTLSConfig,
+		}
+		cl.networkTransport.Store(t)
+	}
+	return t
+}
+
+// Send bytes to a KDC of the client's default realm.
 func (cl *Client) SendToKDC(b []byte) ([]byte, error) {
-	var rb []byte
+	return cl.SendToRealmKDC(cl.Config.LibDefaults.Default_realm, b)
+}
+
+// Send bytes to a KDC of the realm specified.
+func (cl *Client) SendToRealmKDC(realm string, b []byte) ([]byte, error) {
 	var kdcs []string
 	for _, r := range cl.Config.Realms {
-		if r.Realm == cl.Config.LibDefaults.Default_realm {
+		if r.Realm == realm {
 			kdcs = r.Kdc
 			break
 		}
 	}
 	if len(kdcs) < 1 {
-		return rb, fmt.Errorf("No KDCs defined in configuration for realm: %v", cl.Config.LibDefaults.Default_realm)
+		return nil, fmt.Errorf("No KDCs defined in configuration for realm: %v", realm)
 	}
-	var kdc string
-	if len(kdcs) > 1 {
-		//Select one of the KDCs at random
-		kdc = kdcs[rand.Intn(len(kdcs))]
-	} else {
-		kdc = kdcs[0]
+	return cl.send(realm, selectServer(kdcs), b)
+}
+
+// Send bytes to the server using the client's transport, observing the exchange.
+func (cl *Client) send(realm, addr string, b []byte) ([]byte, error) {
+	start := time.Now()
+	rb, err := cl.transport().Send(realm, addr, b)
+	cl.observe(Event{
+		Type:     EventSend,
+		MsgType:  marshalledMsgType(b),
+		Realm:    realm,
+		Server:   addr,
+		Size:     len(b),
+		Duration: time.Since(start),
+		Err:      err,
+	})
+	return rb, err
+}
+
+// Select one of the servers at random.
+func selectServer(servers []string) string {
+	if len(servers) > 1 {
+		return servers[rand.Intn(len(servers))]
 	}
+	return servers[0]
+}
 
-	if cl.Config.LibDefaults.Udp_preference_limit == 1 {
+// Send bytes to the server over UDP or TCP according to the UDP preference limit, falling back to the other.
+// If the server address is the URL of a KDC proxy the bytes are sent via the proxy to the server for the realm.
+func (t *NetworkTransport) Send(realm, addr string, b []byte) ([]byte, error) {
+	if isKDCProxy(addr) {
+		rb, err := t.sendKDCProxy(addr, realm, b)
+		if err != nil {
+			return rb, fmt.Errorf("Failed to communicate with %v via KDC proxy (%v)", addr, err)
+		}
+		return rb, nil
+	}
+	if t.UDPPreferenceLimit == 1 {
 		//1 means we should always use TCP
-		rb, errtcp := sendTCP(kdc, b)
+		rb, errtcp := t.sendTCP(addr, b)
 		if errtcp != nil {
-			return rb, fmt.Errorf("Failed to communicate with KDC %v via TDP (%v)", kdc, errtcp)
+			return rb, fmt.Errorf("Failed to communicate with %v via TCP (%v)", addr, errtcp)
 		}
 		if len(rb) < 1 {
-			return rb, fmt.Errorf("No response data from KDC %v", kdc)
+			return rb, fmt.Errorf("No response data from %v", addr)
 		}
 		return rb, nil
 	}
-	if len(b) <= cl.Config.LibDefaults.Udp_preference_limit {
+	if len(b) <= t.UDPPreferenceLimit {
 		//Try UDP first, TCP second
-		rb, errudp := sendUDP(kdc, b)
+		rb, errudp := t.sendUDP(addr, b)
 		if errudp != nil {
-			rb, errtcp := sendTCP(kdc, b)
+			var errtcp error
+			rb, errtcp = t.sendTCP(addr, b)
 			if errtcp != nil {
-				return rb, fmt.Errorf("Failed to communicate with KDC %v via UDP (%v) and then via TDP (%v)", kdc, errudp, errtcp)
+				return rb, fmt.Errorf("Failed to communicate with %v via UDP (%v) and then via TCP (%v)", addr, errudp, errtcp)
 			}
 		}
 		if len(rb) < 1 {
-			return rb, fmt.Errorf("No response data from KDC %v", kdc)
+			return rb, fmt.Errorf("No response data from %v", addr)
 		}
 		return rb, nil
 	}
 	//Try TCP first, UDP second
-	rb, errtcp := sendTCP(kdc, b)
+	rb, errtcp := t.sendTCP(addr, b)
 	if errtcp != nil {
-		rb, errudp := sendUDP(kdc, b)
+		var errudp error
+		rb, errudp = t.sendUDP(addr, b)
 		if errudp != nil {
-			return rb, fmt.Errorf("Failed to communicate with KDC %v via TCP (%v) and then via UDP (%v)", kdc, errtcp, errudp)
+			return rb, fmt.Errorf("Failed to communicate with %v via TCP (%v) and then via UDP (%v)", addr, errtcp, errudp)
 		}
 	}
 	if len(rb) < 1 {
-		return rb, fmt.Errorf("No response data from KDC %v", kdc)
+		return rb, fmt.Errorf("No response data from %v", addr)
 	}
 	return rb, nil
 }
 
-// Send the bytes to the KDC over UDP.
-func sendUDP(kdc string, b []byte) ([]byte, error) {
-	var r []byte
-	udpAddr, err := net.ResolveUDPAddr("udp", kdc)
-	if err != nil {
-		return r, fmt.Errorf("Error resolving KDC address: %v", err)
+func (t *NetworkTransport) timeout(d time.Duration) time.Duration {
+	if t.Timeout > 0 {
+		return t.Timeout
 	}
-	conn, err := net.DialUDP("udp", nil, udpAddr)
+	return d
+}
+
+func (t *NetworkTransport) dial(network, addr string) (net.Conn, error) {
+	if t.Dial != nil {
+		return t.Dial(network, addr)
+	}
+	d := net.Dialer{Timeout: t.timeout(5 * time.Second)}
+	return d.Dial(network, addr)
+}
+
+// Send the bytes to the server over UDP.
+func (t *NetworkTransport) sendUDP(addr string, b []byte) ([]byte, error) {
+	var r []byte
+	conn, err := t.dial("udp", addr)
 	if err != nil {
-		return r, fmt.Errorf("Error establishing connection to KDC: %v", err)
+		return r, fmt.Errorf("Error establishing connection: %v", err)
 	}
 	defer conn.Close()
-	conn.SetDeadline(time.Now().Add(time.Duration(5 * time.Second)))
+	conn.SetDeadline(time.Now().Add(t.timeout(5 * time.Second)))
 	_, err = conn.Write(b)
 	if err != nil {
-		return r, fmt.Errorf("Error sending to KDC: %v", err)
+		return r, fmt.Errorf("Error sending: %v", err)
 	}
 	udpbuf := make([]byte, 4096)
-	n, _, err := conn.ReadFrom(udpbuf)
+	n, err := conn.Read(udpbuf)
 	r = udpbuf[:n]
 	if err != nil {
 		return r, fmt.Errorf("Sending over UDP failed: %v", err)
@@ -94,26 +206,36 @@ func sendUDP(kdc string, b []byte) ([]byte, error) {
 	return r, nil
 }
 
-// Send the bytes to the KDC over TCP.
-func sendTCP(kdc string, b []byte) ([]byte, error) {
+// Send the bytes to the server over TCP.
+// Over TCP each message is preceded by its length as a 4 byte big-endian integer. Ref: RFC 4120 Section 7.2.2
+func (t *NetworkTransport) sendTCP(addr string, b []byte) ([]byte, error) {
 	var r []byte
-	tcpAddr, err := net.ResolveTCPAddr("tcp", kdc)
+	conn, err := t.dial("tcp", addr)
 	if err != nil {
-		return r, fmt.Errorf("Error resolving KDC address: %v", err)
+		return r, fmt.Errorf("Error establishing connection: %v", err)
 	}
-	conn, err := net.DialTCP("tcp", nil, tcpAddr)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(t.timeout(5 * time.Second)))
+	hb := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(hb, uint32(len(b)))
+	_, err = conn.Write(append(hb, b...))
 	if err != nil {
-		return r, fmt.Errorf("Error establishing connection to KDC: %v", err)
+		return r, fmt.Errorf("Error sending: %v", err)
 	}
-	defer conn.Close()
-	conn.SetDeadline(time.Now().Add(time.Duration(5 * time.Second)))
-	_, err = conn.Write(b)
+	_, err = io.ReadFull(conn, hb)
 	if err != nil {
-		return r, fmt.Errorf("Error sending to KDC: %v", err)
+		return r, fmt.Errorf("Sending over TCP failed, error reading response length: %v", err)
+	}
+	l := binary.BigEndian.Uint32(hb)
+	// The high bit is reserved
+	if l&0x80000000 != 0 {
+		return r, errors.New("Sending over TCP failed, response length has the reserved bit set")
+	}
+	if l > maxTCPReplyLength {
+		return r, fmt.Errorf("Sending over TCP failed, response length of %d bytes exceeds the maximum of %d", l, maxTCPReplyLength)
 	}
-	tcpbuf := bytes.NewBuffer(make([]byte, 4096))
-	n, err := conn.ReadFrom(tcpbuf)
-	r = tcpbuf.Bytes()[:n]
+	r = make([]byte, l)
+	_, err = io.ReadFull(conn, r)
 	if err != nil {
 		return r, fmt.Errorf("Sending over TCP failed: %v", err)
 	}
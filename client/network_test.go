@@ -0,0 +1,128 @@
+package client
+
+import (
+	"encoding/binary"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestNetworkTransport_TCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		hb := make([]byte, 4)
+		io.ReadFull(conn, hb)
+		b := make([]byte, binary.BigEndian.Uint32(hb))
+		io.ReadFull(conn, b)
+		r := append([]byte("reply to "), b...)
+		binary.BigEndian.PutUint32(hb, uint32(len(r)))
+		conn.Write(append(hb, r...))
+	}()
+	tr := &NetworkTransport{UDPPreferenceLimit: 1}
+	rb, err := tr.Send("TEST.GOKRB5", l.Addr().String(), []byte("request"))
+	if err != nil {
+		t.Fatalf("Error sending over TCP: %v", err)
+	}
+	assert.Equal(t, []byte("reply to request"), rb, "Reply not as expected")
+}
+
+func TestNetworkTransport_TCP_replyTooLong(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		hb := make([]byte, 4)
+		io.ReadFull(conn, hb)
+		io.ReadFull(conn, make([]byte, binary.BigEndian.Uint32(hb)))
+		// Claim a reply longer than the maximum without sending it
+		binary.BigEndian.PutUint32(hb, maxTCPReplyLength+1)
+		conn.Write(hb)
+	}()
+	tr := &NetworkTransport{UDPPreferenceLimit: 1}
+	_, err = tr.Send("TEST.GOKRB5", l.Addr().String(), []byte("request"))
+	assert.Error(t, err, "Reply longer than the maximum should not be accepted")
+}
+
+func TestNetworkTransport_UDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer pc.Close()
+	go func() {
+		b := make([]byte, 4096)
+		n, addr, err := pc.ReadFrom(b)
+		if err != nil {
+			return
+		}
+		pc.WriteTo(append([]byte("reply to "), b[:n]...), addr)
+	}()
+	tr := &NetworkTransport{UDPPreferenceLimit: 1465}
+	rb, err := tr.Send("TEST.GOKRB5", pc.LocalAddr().String(), []byte("request"))
+	if err != nil {
+		t.Fatalf("Error sending over UDP: %v", err)
+	}
+	assert.Equal(t, []byte("reply to request"), rb, "Reply not as expected")
+}
+
+func TestClient_SendToKDC_transport(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c)
+	var realm, addr string
+	cl.WithTransport(TransportFunc(func(r, a string, b []byte) ([]byte, error) {
+		realm, addr = r, a
+		return append([]byte("reply to "), b...), nil
+	}))
+	rb, err := cl.SendToKDC([]byte("request"))
+	if err != nil {
+		t.Fatalf("Error sending to KDC: %v", err)
+	}
+	assert.Equal(t, []byte("reply to request"), rb, "Reply not as expected")
+	assert.Equal(t, "TEST.GOKRB5", realm, "Realm not as expected")
+	var found bool
+	for _, kdc := range c.Realms[0].Kdc {
+		if kdc == addr {
+			found = true
+		}
+	}
+	assert.True(t, found, "KDC address not as expected: %s", addr)
+}
+
+func TestClient_transport_concurrent(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c)
+	done := make(chan Transport)
+	for i := 0; i < 4; i++ {
+		go func() {
+			done <- cl.transport()
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		assert.IsType(t, &NetworkTransport{}, <-done, "Built in transport not as expected")
+	}
+	tr := cl.transport()
+	assert.Equal(t, tr, cl.transport(), "Built in transport should be reused while the settings are unchanged")
+	c.LibDefaults.Udp_preference_limit = 1
+	assert.Equal(t, 1, cl.transport().(*NetworkTransport).UDPPreferenceLimit, "Built in transport not updated with the settings")
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/otp"
+	"github.com/jcmturner/gokrb5/types"
+)
+
+// Set the callback used to get a one-time password when the KDC requires OTP pre-authentication.
+// OTP pre-authentication is only performed within FAST so the client must also have FAST armor.
+func (cl *Client) WithOTPPrompter(p otp.Prompter) *Client {
+	cl.OTPPrompter = p
+	return cl
+}
+
+// Perform OTP pre-authentication within the FAST tunnel.
+// The request is bound to the armor key so the armor is created before the request is sent.
+func (cl *Client) otpExchange(a messages.ASReq, pas types.PADataSequence) (messages.ASReq, []byte, messages.ASRep, error) {
+	var ar messages.ASRep
+	var challenge []byte
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_OTP_CHALLENGE {
+			challenge = pa.PADataValue
+		}
+	}
+	armor, err := cl.newFASTArmor()
+	if err != nil {
+		return a, nil, ar, err
+	}
+	pa, err := otp.NewRequestPADataAt(challenge, armor.Key, cl.otpPrompter(), cl.Config.Now())
+	if err != nil {
+		return a, nil, ar, err
+	}
+	a.FASTArmor = &armor
+	a.PAData = append(a.PAData, pa)
+	a.PAData = append(a.PAData, fxCookies(pas)...)
+	return cl.sendASReq(a)
+}
+
+// Decrypt the AS_REP to an OTP pre-authenticated AS_REQ. The armor key is the reply key. Ref: RFC 6560 Section 4.3
+func decryptOTPEncPart(ar *messages.ASRep, sent messages.ASReq) error {
+	err := ar.ProcessFASTResponse(sent)
+	if err != nil {
+		return err
+	}
+	return ar.DecryptEncPartWithKey(sent.FASTArmor.Key)
+}
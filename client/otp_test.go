@@ -0,0 +1,21 @@
+package client
+
+import (
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/otp"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestClient_IsConfigured_otp(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "")
+	cl.WithConfig(c)
+	cl.WithOTPPrompter(func(service string, tokens []otp.TokenInfo) (otp.Response, error) {
+		return otp.Response{Value: "123456"}, nil
+	})
+	assert.False(t, cl.IsConfigured(), "Client with an OTP prompter but no FAST armor should not be configured")
+	cl.WithFASTArmor(&Session{})
+	assert.True(t, cl.IsConfigured(), "Client with an OTP prompter and FAST armor should be configured")
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"fmt"
+	"github.com/jcmturner/gokrb5/credentials"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/kadmin"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"net"
+)
+
+// Change the password of the client's principal using the kpasswd protocol.
+// On success the client's password credential, if it has one, is updated to the new password.
+func (cl *Client) ChangePasswd(newPasswd string) (bool, error) {
+	return cl.changePasswd(newPasswd, cl.asCredentials())
+}
+
+// Change the password of the client's principal, authenticating with the credentials provided.
+func (cl *Client) changePasswd(newPasswd string, creds *credentials.Credentials) (bool, error) {
+	ok, err := cl.kpasswd(creds, func(s *Session, addr types.HostAddress) (kadmin.Request, types.Authenticator, error) {
+		return kadmin.ChangePasswdMsg(s.CName, s.CRealm, newPasswd, s.TGT, s.SessionKey, addr, cl.Config.Now())
+	})
+	if ok && cl.Credentials.HasPassword() {
+		cl.Credentials.Password = newPasswd
+	}
+	return ok, err
+}
+
+// Set the password of the target principal using the kpasswd protocol.
+// The client's principal must be authorised by the kpasswd server to change the password of the target.
+func (cl *Client) SetPasswd(target types.PrincipalName, realm, newPasswd string) (bool, error) {
+	return cl.kpasswd(cl.asCredentials(), func(s *Session, addr types.HostAddress) (kadmin.Request, types.Authenticator, error) {
+		return kadmin.SetPasswdMsg(s.CName, s.CRealm, target, realm, newPasswd, s.TGT, s.SessionKey, addr, cl.Config.Now())
+	})
+}
+
+// Send a request to a kpasswd server of the client's default realm.
+// The request is authenticated with an initial ticket for kadmin/changepw obtained by an AS exchange using the
+// credentials provided.
+func (cl *Client) kpasswd(creds *credentials.Credentials, newRequest func(*Session, types.HostAddress) (kadmin.Request, types.Authenticator, error)) (bool, error) {
+	var servers []string
+	for _, r := range cl.Config.Realms {
+		if r.Realm == cl.Config.LibDefaults.Default_realm {
+			servers = r.Kpasswd_server
+			break
+		}
+	}
+	if len(servers) < 1 {
+		return false, fmt.Errorf("No kpasswd servers defined in configuration for realm: %v", cl.Config.LibDefaults.Default_realm)
+	}
+	server := selectServer(servers)
+	s, err := cl.asExchange(types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"kadmin", "changepw"},
+	}, messages.TicketOptions{}, creds)
+	if err != nil {
+		return false, fmt.Errorf("Error getting kadmin/changepw ticket: %v", err)
+	}
+	var addr, sAddr types.HostAddress
+	if isKDCProxy(server) {
+		// The addresses seen by the client and kpasswd server are those of the proxy so directional addresses are used
+		addr = types.NewHostAddressDirectional(true)
+		sAddr = types.NewHostAddressDirectional(false)
+	} else {
+		addr, sAddr, err = hostAddresses(server)
+		if err != nil {
+			return false, err
+		}
+	}
+	r, auth, err := newRequest(s, addr)
+	if err != nil {
+		return false, fmt.Errorf("Error creating kpasswd request: %v", err)
+	}
+	b, err := r.Marshal()
+	if err != nil {
+		return false, fmt.Errorf("Error marshalling kpasswd request: %v", err)
+	}
+	rb, err := cl.send(cl.Config.LibDefaults.Default_realm, server, b)
+	if err != nil {
+		return false, fmt.Errorf("Error sending kpasswd request: %v", err)
+	}
+	var rep kadmin.Reply
+	err = rep.Unmarshal(rb)
+	if err != nil {
+		return false, err
+	}
+	err = rep.Decrypt(s.SessionKey, auth, sAddr, cl.Config)
+	if err != nil {
+		return false, fmt.Errorf("Error processing kpasswd reply: %v. %v", err, rep)
+	}
+	if rep.ResultCode != kadmin.KRB5_KPASSWD_SUCCESS {
+		return false, fmt.Errorf("Password change failed. %v", rep)
+	}
+	return true, nil
+}
+
+// Get the address of the local interface used to reach the server and the address of the server.
+// No data is sent to the server.
+func hostAddresses(server string) (types.HostAddress, types.HostAddress, error) {
+	var l, r types.HostAddress
+	conn, err := net.Dial("udp", server)
+	if err != nil {
+		return l, r, fmt.Errorf("Error determining local address: %v", err)
+	}
+	defer conn.Close()
+	l, err = types.HostAddressFromNetIP(conn.LocalAddr().(*net.UDPAddr).IP)
+	if err != nil {
+		return l, r, err
+	}
+	r, err = types.HostAddressFromNetIP(conn.RemoteAddr().(*net.UDPAddr).IP)
+	return l, r, err
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"crypto"
+	"crypto/x509"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/credentials"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/pkinit"
+	"github.com/jcmturner/gokrb5/types"
+)
+
+// Create a new client with an X.509 certificate credential for PKINIT.
+// The private key may be any crypto.Signer, for example one backed by a smartcard.
+func NewClientWithCertificate(username, realm string, cert *x509.Certificate, key crypto.Signer) Client {
+	creds := credentials.NewCredentials(username, realm)
+	cfg := config.NewConfig()
+	return Client{
+		Credentials: creds.WithCertificate(cert, key),
+		Config:      cfg,
+		Cache:       newCacheWithClock(cfg.Now),
+	}
+}
+
+// Create a new client for getting anonymous tickets with anonymous PKINIT. Ref: RFC 8062
+// The KDC's certificate is validated against the PKINIT anchors in the configuration.
+func NewAnonymousClient(realm string) Client {
+	creds := credentials.NewAnonymousCredentials(realm)
+	cfg := config.NewConfig()
+	return Client{
+		Credentials: &creds,
+		Config:      cfg,
+		Cache:       newCacheWithClock(cfg.Now),
+	}
+}
+
+// Decrypt the AS_REP with the reply key from the PKINIT key agreement with the KDC.
+// For an anonymous request the KDC's contribution to the ticket session key is also verified.
+func decryptPKINITEncPart(ar *messages.ASRep, sent messages.ASReq, sentb []byte, pk *pkinit.Request) error {
+	if sent.FASTArmor != nil {
+		err := ar.ProcessFASTResponse(sent)
+		if err != nil {
+			return err
+		}
+	}
+	key, err := pk.ReplyKey(sentb, *ar)
+	if err != nil {
+		return err
+	}
+	err = ar.DecryptEncPartWithKey(key)
+	if err != nil {
+		return err
+	}
+	// Nothing authenticates an anonymous client to the KDC so the KDC must show it took part in the session key
+	if types.IsFlagSet(&sent.ReqBody.KDCOptions, types.RequestAnonymous) {
+		return pkinit.VerifyKeyExchange(*ar, key)
+	}
+	return nil
+}
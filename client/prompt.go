@@ -0,0 +1,128 @@
+package client
+
+import (
+	"fmt"
+	"github.com/jcmturner/gokrb5/credentials"
+	"github.com/jcmturner/gokrb5/otp"
+	"github.com/jcmturner/gokrb5/prompt"
+	"github.com/jcmturner/gokrb5/types"
+)
+
+// Set the prompter used to get secret input from the user when the KDC asks for it.
+// The client prompts for its password if it has no other long term key, for a one-time password if it has no
+// OTPPrompter, and for a new password on expiry if it has no ChangePasswordPrompter.
+func (cl *Client) WithPrompter(p prompt.Prompter) *Client {
+	cl.Prompter = p
+	return cl
+}
+
+// Add a SPAKE second factor of the type specified whose data is entered by the user in response to a prompt.
+// The client's Prompter is used and the factor data sent is the text entered.
+func (cl *Client) WithSPAKESecondFactorPrompt(factorType int) *Client {
+	return cl.WithSPAKESecondFactor(promptSecondFactor{factorType: factorType, cl: cl})
+}
+
+// Get the credentials to use for an AS exchange.
+// If the client has a prompter but no long term key these are a copy of the client's credentials with a key provider
+// that prompts for the password. The user is only prompted if the key is needed and the client's credentials are
+// left unchanged.
+func (cl *Client) asCredentials() *credentials.Credentials {
+	if cl.Prompter == nil || cl.Credentials.HasKey() || cl.Credentials.IsAnonymous() {
+		return cl.Credentials
+	}
+	creds := *cl.Credentials
+	creds.KeyProvider = cl.promptKeyProvider()
+	return &creds
+}
+
+// Get a key provider that prompts for the client's password the first time a key is needed.
+// The password is remembered so the user is prompted at most once for each provider.
+func (cl *Client) promptKeyProvider() credentials.KeyProvider {
+	var password string
+	return credentials.PasswordFuncKeyProvider(func() (string, error) {
+		if password != "" {
+			return password, nil
+		}
+		p, err := cl.Prompter.Prompt(prompt.Prompt{
+			Type: prompt.Password,
+			Text: fmt.Sprintf("Password for %s", cl.principal()),
+		})
+		if err != nil {
+			return "", err
+		}
+		password = p
+		return password, nil
+	})
+}
+
+// Get the callback for one-time passwords. This is the client's OTPPrompter, or its Prompter if it has none.
+func (cl *Client) otpPrompter() otp.Prompter {
+	if cl.OTPPrompter != nil || cl.Prompter == nil {
+		return cl.OTPPrompter
+	}
+	// The first token offered is used
+	return func(service string, tokens []otp.TokenInfo) (otp.Response, error) {
+		var r otp.Response
+		token := tokens[0]
+		name := "OTP token"
+		if token.Vendor != "" {
+			name = fmt.Sprintf("%s OTP token", token.Vendor)
+		}
+		if types.IsFlagSet(&token.Flags, otp.FlagCollectPIN) || types.IsFlagSet(&token.Flags, otp.FlagSeparatePINRequired) {
+			pin, err := cl.Prompter.Prompt(prompt.Prompt{Type: prompt.OTP, Text: fmt.Sprintf("Enter %s PIN", name)})
+			if err != nil {
+				return r, err
+			}
+			r.PIN = pin
+		}
+		v, err := cl.Prompter.Prompt(prompt.Prompt{Type: prompt.OTP, Text: fmt.Sprintf("Enter %s value", name)})
+		if err != nil {
+			return r, err
+		}
+		r.Value = v
+		return r, nil
+	}
+}
+
+// Get the callback for a new password on expiry. This is the client's ChangePasswordPrompter, or its Prompter if it
+// has none.
+func (cl *Client) changePasswordPrompter() ChangePasswordPrompter {
+	if cl.ChangePasswordPrompter != nil || cl.Prompter == nil {
+		return cl.ChangePasswordPrompter
+	}
+	return func(principal string) (string, error) {
+		return cl.Prompter.Prompt(prompt.Prompt{
+			Type: prompt.NewPassword,
+			Text: fmt.Sprintf("Password expired. Enter new password for %s", principal),
+		})
+	}
+}
+
+// The client's principal name and realm as a string.
+func (cl *Client) principal() string {
+	return principalString(cl.Credentials.CName.NameString, cl.clientRealm(cl.Credentials))
+}
+
+// A SPAKE second factor whose data is entered by the user.
+type promptSecondFactor struct {
+	factorType int
+	cl         *Client
+}
+
+func (f promptSecondFactor) Type() int {
+	return f.factorType
+}
+
+func (f promptSecondFactor) Respond(challenge []byte) ([]byte, error) {
+	if f.cl.Prompter == nil {
+		return nil, fmt.Errorf("Client has no prompter for SPAKE second factor %d", f.factorType)
+	}
+	s, err := f.cl.Prompter.Prompt(prompt.Prompt{
+		Type: prompt.SecondFactor,
+		Text: fmt.Sprintf("Enter value for second factor %d", f.factorType),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/otp"
+	"github.com/jcmturner/gokrb5/prompt"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestClient_asCredentials(t *testing.T) {
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "")
+	cl.Config.LibDefaults.Default_realm = "TEST.GOKRB5"
+	p := prompt.NewFake(map[prompt.Type]string{prompt.Password: "passwordvalue"})
+	cl.WithPrompter(p)
+	creds := cl.asCredentials()
+	assert.True(t, creds.HasKey(), "Credentials should have a key provider")
+	assert.False(t, cl.Credentials.HasKey(), "Client's credentials should not be changed")
+	assert.Equal(t, 0, len(p.Prompts), "User should not be prompted until the key is needed")
+	for i := 0; i < 2; i++ {
+		_, err := creds.GetKey(creds.CName, "TEST.GOKRB5", etype.AES256_CTS_HMAC_SHA1_96, 0, nil)
+		if err != nil {
+			t.Fatalf("Error getting key: %v", err)
+		}
+	}
+	assert.Equal(t, 1, p.Count(prompt.Password), "User should be prompted for the password once")
+	assert.Equal(t, "Password for testuser1@TEST.GOKRB5", p.Prompts[0].Text, "Prompt text not as expected")
+	assert.False(t, p.Prompts[0].Echo, "Password should not be echoed")
+
+	cl.Credentials.WithPassword("passwordvalue")
+	assert.True(t, cl.asCredentials() == cl.Credentials, "Client with a password should not prompt for it")
+}
+
+func TestClient_Login_prompt(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "")
+	cl.WithConfig(c)
+	p := prompt.NewFake(map[prompt.Type]string{prompt.Password: "passwordvalue"})
+	cl.WithPrompter(p)
+	tgtKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	cl.WithTransport(TransportFunc(func(realm, addr string, b []byte) ([]byte, error) {
+		var asReq messages.ASReq
+		if err := asReq.Unmarshal(b); err != nil {
+			return nil, err
+		}
+		return testASRep(asReq, "passwordvalue", tgtKey, time.Now().UTC().Truncate(time.Second))
+	}))
+	err := cl.Login()
+	if err != nil {
+		t.Fatalf("Error logging in with prompted password: %v", err)
+	}
+	assert.Equal(t, tgtKey.KeyValue, cl.Session.SessionKey.KeyValue, "Session key not as expected")
+	assert.Equal(t, 1, p.Count(prompt.Password), "User should be prompted for the password once")
+	assert.False(t, cl.Credentials.HasKey(), "Prompted password should not be kept by the client")
+}
+
+func TestClient_prompterFallbacks(t *testing.T) {
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	assert.True(t, cl.otpPrompter() == nil, "There should be no OTP prompter")
+	assert.True(t, cl.changePasswordPrompter() == nil, "There should be no change password prompter")
+	p := prompt.NewFake(map[prompt.Type]string{prompt.OTP: "123456", prompt.NewPassword: "newpasswordvalue"})
+	cl.WithPrompter(p)
+	r, err := cl.otpPrompter()("", []otp.TokenInfo{{Flags: types.NewKrbFlags(), Vendor: "Acme"}})
+	if err != nil {
+		t.Fatalf("Error prompting for OTP: %v", err)
+	}
+	assert.Equal(t, "123456", r.Value, "OTP value not as expected")
+	assert.Equal(t, "", r.PIN, "PIN should not be collected")
+	assert.Equal(t, "Enter Acme OTP token value", p.Prompts[0].Text, "OTP prompt text not as expected")
+	flags := types.NewKrbFlags()
+	types.SetFlag(&flags, otp.FlagCollectPIN)
+	r, _ = cl.otpPrompter()("", []otp.TokenInfo{{Flags: flags}})
+	assert.Equal(t, "123456", r.PIN, "PIN not as expected")
+	assert.Equal(t, "Enter OTP token PIN", p.Prompts[1].Text, "PIN prompt text not as expected")
+	v, err := cl.changePasswordPrompter()("testuser1@TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error prompting for new password: %v", err)
+	}
+	assert.Equal(t, "newpasswordvalue", v, "New password not as expected")
+	cl.WithOTPPrompter(func(service string, tokens []otp.TokenInfo) (otp.Response, error) {
+		return otp.Response{Value: "654321"}, nil
+	})
+	r, _ = cl.otpPrompter()("", []otp.TokenInfo{{Flags: types.NewKrbFlags()}})
+	assert.Equal(t, "654321", r.Value, "Client's OTPPrompter should be used over its Prompter")
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"strings"
+)
+
+// Request a proxy ticket for the SPN specified from the client's proxiable TGT.
+// The proxy ticket can only be used from the addresses provided, which are those of the party it is to be handed to.
+// The ticket and its KrbCredInfo are returned so that they can be packaged in a KRB_CRED with messages.NewKRBCred.
+// Ref: RFC 4120 Section 2.5
+func (cl *Client) GetProxyTicket(spn string, addresses []types.HostAddress) (types.Ticket, messages.KrbCredInfo, error) {
+	if cl.Session == nil {
+		return types.Ticket{}, messages.KrbCredInfo{}, errors.New("Error client does not have a session. Client needs to login first")
+	}
+	if !types.IsFlagSet(&cl.Session.Flags, types.Proxiable) {
+		return types.Ticket{}, messages.KrbCredInfo{}, errors.New("Error client's TGT is not proxiable")
+	}
+	if len(addresses) < 1 {
+		return types.Ticket{}, messages.KrbCredInfo{}, errors.New("Error the addresses the proxy ticket is to be used from must be provided")
+	}
+	princ := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: strings.Split(spn, "/"),
+	}
+	_, tgsRep, err := cl.TGSExchangeWithOptions(princ, false, messages.TicketOptions{Proxy: true, Addresses: addresses})
+	if err != nil {
+		return types.Ticket{}, messages.KrbCredInfo{}, fmt.Errorf("Error getting proxy ticket: %v", err)
+	}
+	if !types.IsFlagSet(&tgsRep.DecryptedEncPart.Flags, types.Proxy) {
+		return types.Ticket{}, messages.KrbCredInfo{}, errors.New("Ticket issued by the KDC is not a proxy ticket")
+	}
+	return tgsRep.Ticket, messages.NewKrbCredInfo(tgsRep.CRealm, tgsRep.CName, tgsRep.DecryptedEncPart), nil
+}
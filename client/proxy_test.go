@@ -0,0 +1,64 @@
+package client
+
+import (
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClient_GetProxyTicket(t *testing.T) {
+	tgtKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	proxyKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	cl := testSessionClient(t, tgtKey)
+	now := time.Now().UTC()
+	addr, _ := types.HostAddressFromNetIP(net.ParseIP("10.80.88.90"))
+
+	var sent bool
+	var proxy, issueProxy bool
+	var addresses []types.HostAddress
+	cl.WithTransport(testTGS(tgtKey, func(tgsReq messages.TGSReq, auth types.Authenticator) (types.Ticket, messages.EncKDCRepPart) {
+		sent = true
+		proxy = types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, types.Proxy)
+		addresses = tgsReq.ReqBody.Addresses
+		flags := types.NewKrbFlags()
+		if issueProxy {
+			types.SetFlag(&flags, types.Proxy)
+		}
+		return types.Ticket{TktVNO: 5, Realm: "TEST.GOKRB5", SName: tgsReq.ReqBody.SName}, messages.EncKDCRepPart{
+			Key:      proxyKey,
+			LastReqs: []messages.LastReq{},
+			Flags:    flags,
+			AuthTime: now.Add(-time.Minute),
+			EndTime:  now.Add(time.Hour),
+			CAddr:    tgsReq.ReqBody.Addresses,
+		}
+	}))
+
+	_, _, err := cl.GetProxyTicket("HTTP/host.test.gokrb5", []types.HostAddress{addr})
+	assert.Error(t, err, "Proxy ticket should not be requested with a TGT that is not proxiable")
+	assert.False(t, sent, "TGS_REQ should not be sent for a TGT that is not proxiable")
+	types.SetFlag(&cl.Session.Flags, types.Proxiable)
+
+	_, _, err = cl.GetProxyTicket("HTTP/host.test.gokrb5", nil)
+	assert.Error(t, err, "Proxy ticket should not be requested without the addresses it is to be used from")
+	assert.False(t, sent, "TGS_REQ should not be sent without addresses")
+
+	_, _, err = cl.GetProxyTicket("HTTP/host.test.gokrb5", []types.HostAddress{addr})
+	assert.Error(t, err, "Ticket issued without the proxy flag should not be accepted")
+
+	issueProxy = true
+	tkt, info, err := cl.GetProxyTicket("HTTP/host.test.gokrb5", []types.HostAddress{addr})
+	if err != nil {
+		t.Fatalf("Error getting proxy ticket: %v", err)
+	}
+	assert.True(t, proxy, "Proxy option not set in the TGS_REQ")
+	assert.True(t, types.HostAddressesEqual(addresses, []types.HostAddress{addr}), "Addresses requested not those provided")
+	assert.Equal(t, []string{"HTTP", "host.test.gokrb5"}, tkt.SName.NameString, "Proxy ticket service not as expected")
+	assert.Equal(t, proxyKey.KeyValue, info.Key.KeyValue, "Session key of the proxy ticket not as expected")
+	assert.True(t, types.HostAddressesEqual(info.CAddr, []types.HostAddress{addr}), "Addresses of the proxy ticket not as expected")
+}
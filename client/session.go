@@ -1,21 +1,37 @@
 package client
 
 import (
+	"errors"
+	"fmt"
+	"github.com/jcmturner/asn1"
 	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/messages"
 	"github.com/jcmturner/gokrb5/types"
 	"time"
 )
 
 // Client session struct.
 type Session struct {
+	CRealm               string
+	CName                types.PrincipalName
 	AuthTime             time.Time
+	StartTime            time.Time
 	EndTime              time.Time
 	RenewTill            time.Time
 	TGT                  types.Ticket
 	SessionKey           types.EncryptionKey
 	SessionKeyExpiration time.Time
+	Flags                asn1.BitString
+	// Last request information from the AS exchange, including password and account expiration.
+	LastReq messages.LastReqInfo
 }
 
+// Whether the session's TGT is invalid. A postdated TGT is invalid until it has been validated.
+func (s *Session) IsInvalid() bool {
+	return types.IsFlagSet(&s.Flags, types.Invalid)
+}
+
+// Renew the client's TGT with a TGS exchange.
 func (cl *Client) RenewTGT() error {
 	spn := types.PrincipalName{
 		NameType:   nametype.KRB_NT_SRV_INST,
@@ -23,32 +39,82 @@ func (cl *Client) RenewTGT() error {
 	}
 	_, tgsRep, err := cl.TGSExchange(spn, true)
 	if err != nil {
+		cl.observeRenewal("", err)
 		return err
 	}
-	cl.Session = &Session{
+	cl.Session = newSessionFromTGSRep(tgsRep)
+	cl.observeRenewal("renewed with TGS exchange", nil)
+	return nil
+}
+
+// Validate the client's postdated TGT once its start time has been reached.
+// The KDC replaces the invalid TGT with a valid one. Ref: RFC 4120 Section 2.3
+func (cl *Client) ValidateTGT() error {
+	if cl.Session == nil {
+		return errors.New("Error client does not have a session. Client needs to login first")
+	}
+	spn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"krbtgt", cl.Session.TGT.Realm},
+	}
+	_, tgsRep, err := cl.TGSExchangeWithOptions(spn, false, messages.TicketOptions{Validate: true})
+	if err != nil {
+		return fmt.Errorf("Error validating TGT: %v", err)
+	}
+	cl.Session = newSessionFromTGSRep(tgsRep)
+	return nil
+}
+
+// Create a session from the TGT in a TGS_REP.
+func newSessionFromTGSRep(tgsRep messages.TGSRep) *Session {
+	return &Session{
+		CRealm:               tgsRep.CRealm,
+		CName:                tgsRep.CName,
 		AuthTime:             tgsRep.DecryptedEncPart.AuthTime,
+		StartTime:            tgsRep.DecryptedEncPart.StartTime,
 		EndTime:              tgsRep.DecryptedEncPart.EndTime,
 		RenewTill:            tgsRep.DecryptedEncPart.RenewTill,
 		TGT:                  tgsRep.Ticket,
 		SessionKey:           tgsRep.DecryptedEncPart.Key,
 		SessionKeyExpiration: tgsRep.DecryptedEncPart.KeyExpiration,
+		Flags:                tgsRep.DecryptedEncPart.Flags,
 	}
-	return nil
+}
+
+// Observe the outcome of renewing the client's TGT.
+func (cl *Client) observeRenewal(text string, err error) {
+	cl.observe(Event{
+		Type:      EventRenewal,
+		Realm:     cl.Session.CRealm,
+		Principal: principalString(cl.Session.CName.NameString, cl.Session.CRealm),
+		Text:      text,
+		Err:       err,
+	})
 }
 
 func (cl *Client) EnableAutoSessionRenewal() {
 	go func() {
 		for {
+			// A postdated TGT is validated once its start time has been reached
+			if cl.Session.IsInvalid() {
+				time.Sleep(cl.Session.StartTime.Sub(cl.Config.Now()))
+				err := cl.ValidateTGT()
+				cl.observeRenewal("validated postdated TGT", err)
+				if err != nil {
+					return
+				}
+			}
 			//Wait until one minute before endtime
-			w := (time.Until(cl.Session.EndTime) * 5) / 6
+			w := (cl.Session.EndTime.Sub(cl.Config.Now()) * 5) / 6
 			if w < 0 {
 				return
 			}
 			time.Sleep(w)
-			if time.Now().Before(cl.Session.RenewTill) {
+			if cl.Config.Now().Before(cl.Session.RenewTill) {
 				cl.RenewTGT()
 			} else {
-				cl.Login()
+				err := cl.Login()
+				cl.observeRenewal("renew till has passed, new TGT obtained with AS exchange", err)
 			}
 		}
 	}()
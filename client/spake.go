@@ -0,0 +1,117 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcmturner/gokrb5/credentials"
+	"github.com/jcmturner/gokrb5/iana/errorcode"
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/spake"
+	"github.com/jcmturner/gokrb5/types"
+)
+
+// The maximum number of AS_REQs sent with a SPAKE response or encdata message. This bounds the exchange if the KDC
+// keeps asking for more second factor data.
+const maxSPAKERoundTrips = 10
+
+// Add a second factor for SPAKE pre-authentication.
+// Second factors are offered in the order added. If the KDC offers none of them SF-NONE is used.
+func (cl *Client) WithSPAKESecondFactor(f spake.SecondFactor) *Client {
+	cl.SPAKEFactors = append(cl.SPAKEFactors, f)
+	return cl
+}
+
+// Perform SPAKE pre-authentication with the KDC. pas is the METHOD-DATA from the KDC offering PA-SPAKE.
+// If the KDC did not send a challenge a support message is sent to get one.
+func (cl *Client) spakeExchange(a messages.ASReq, pas types.PADataSequence, creds *credentials.Credentials) (messages.ASReq, []byte, messages.ASRep, *spake.Request, error) {
+	var ar messages.ASRep
+	if !creds.HasKey() {
+		return a, nil, ar, nil, errors.New("Client has no long term key for SPAKE pre-authentication")
+	}
+	key, err := cl.preAuthKey(pas, creds)
+	if err != nil {
+		return a, nil, ar, nil, err
+	}
+	pads := a.PAData
+	var support []byte
+	challenge := spakePAData(pas)
+	if len(challenge) < 1 {
+		pa, err := spake.SupportPAData()
+		if err != nil {
+			return a, nil, ar, nil, err
+		}
+		support = pa.PADataValue
+		a.PAData = append(append(pads, pa), fxCookies(pas)...)
+		_, _, _, err = cl.sendASReq(a)
+		if pas, err = morePreAuthData(err); err != nil {
+			return a, nil, ar, nil, err
+		}
+		challenge = spakePAData(pas)
+	}
+	sp, err := spake.NewRequest(key, support, challenge, a.ReqBody, cl.SPAKEFactors)
+	if err != nil {
+		return a, nil, ar, nil, fmt.Errorf("Error processing SPAKE challenge: %v", err)
+	}
+	for i := 0; i < maxSPAKERoundTrips; i++ {
+		a.PAData = append(append(pads, sp.PAData), fxCookies(pas)...)
+		sent, sentb, ar, err := cl.sendASReq(a)
+		if err == nil {
+			return sent, sentb, ar, sp, nil
+		}
+		// A second factor may need further round trips
+		if pas, err = morePreAuthData(err); err != nil {
+			return a, nil, ar, nil, err
+		}
+		err = sp.Continue(spakePAData(pas))
+		if err != nil {
+			return a, nil, ar, nil, err
+		}
+	}
+	return a, nil, ar, nil, fmt.Errorf("KDC did not complete SPAKE pre-authentication within %d round trips", maxSPAKERoundTrips)
+}
+
+// Get the METHOD-DATA from a KDC_ERR_MORE_PREAUTH_DATA_REQUIRED error. Any other error is returned.
+func morePreAuthData(err error) (types.PADataSequence, error) {
+	var pas types.PADataSequence
+	if err == nil {
+		return pas, errors.New("KDC did not continue SPAKE pre-authentication")
+	}
+	krberr, ok := err.(messages.KRBError)
+	if !ok || krberr.ErrorCode != errorcode.KDC_ERR_MORE_PREAUTH_DATA_REQUIRED {
+		return pas, err
+	}
+	err = pas.Unmarshal(krberr.EData)
+	if err != nil {
+		return pas, fmt.Errorf("Error unmarshalling METHOD-DATA from KDC_ERR_MORE_PREAUTH_DATA_REQUIRED: %v", err)
+	}
+	if len(spakePAData(pas)) < 1 {
+		return pas, errors.New("KDC did not send PA-SPAKE data")
+	}
+	return pas, nil
+}
+
+// Get the PA-SPAKE value from the METHOD-DATA.
+func spakePAData(pas types.PADataSequence) []byte {
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_SPAKE {
+			return pa.PADataValue
+		}
+	}
+	return nil
+}
+
+// Decrypt the AS_REP with the reply key from the SPAKE exchange.
+func decryptSPAKEEncPart(ar *messages.ASRep, sent messages.ASReq, sp *spake.Request) error {
+	if sent.FASTArmor != nil {
+		err := ar.ProcessFASTResponse(sent)
+		if err != nil {
+			return err
+		}
+	}
+	key, err := sp.ReplyKey()
+	if err != nil {
+		return err
+	}
+	return ar.DecryptEncPartWithKey(key)
+}
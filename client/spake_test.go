@@ -0,0 +1,31 @@
+package client
+
+import (
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/iana/errorcode"
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMorePreAuthData(t *testing.T) {
+	pas := types.PADataSequence{{PADataType: patype.PA_SPAKE, PADataValue: []byte{1, 2, 3}}}
+	b, err := asn1.Marshal(pas)
+	if err != nil {
+		t.Fatalf("Error marshalling METHOD-DATA: %v", err)
+	}
+	got, err := morePreAuthData(messages.KRBError{ErrorCode: errorcode.KDC_ERR_MORE_PREAUTH_DATA_REQUIRED, EData: b})
+	if err != nil {
+		t.Fatalf("Error getting METHOD-DATA: %v", err)
+	}
+	assert.Equal(t, []byte{1, 2, 3}, spakePAData(got), "PA-SPAKE value not as expected")
+
+	_, err = morePreAuthData(messages.KRBError{ErrorCode: errorcode.KDC_ERR_MORE_PREAUTH_DATA_REQUIRED, EData: []byte{0xff, 0x01}})
+	assert.Error(t, err, "Invalid METHOD-DATA should be an error")
+	_, err = morePreAuthData(messages.KRBError{ErrorCode: errorcode.KDC_ERR_PREAUTH_FAILED})
+	assert.Error(t, err, "Other KRB_ERROR should be returned")
+	_, err = morePreAuthData(nil)
+	assert.Error(t, err, "KDC not continuing the exchange should be an error")
+}
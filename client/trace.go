@@ -0,0 +1,176 @@
+package client
+
+import (
+	"fmt"
+	"github.com/jcmturner/gokrb5/iana/msgtype"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Types of event observed during the client's exchanges.
+const (
+	// A request has been built. Principal, Service, Realm and ETypes describe the request.
+	EventRequest = iota
+	// A pre-authentication mechanism is being attempted. PAType is the padata type.
+	EventPreAuth
+	// A message has been sent to a server. Server is the address, Duration the time taken for the reply and Err is
+	// set if the exchange failed.
+	EventSend
+	// A KRB_ERROR has been received. ErrorCode and Text describe the error.
+	EventKRBError
+	// The exchange is being retried. Text gives the reason.
+	EventRetry
+	// The TGT has been renewed, or a new one obtained once it can no longer be renewed. Err is set if this failed.
+	EventRenewal
+)
+
+// An event observed during the client's exchanges.
+type Event struct {
+	Type      int
+	Time      time.Time
+	MsgType   int
+	Realm     string
+	Principal string
+	Service   string
+	Server    string
+	ETypes    []int
+	PAType    int
+	ErrorCode int
+	Size      int
+	Duration  time.Duration
+	Text      string
+	Err       error
+}
+
+// Observer receives the events of the client's exchanges, for example to log them or record metrics.
+type Observer interface {
+	Observe(e Event)
+}
+
+// An adapter to allow the use of a function as an Observer.
+type ObserverFunc func(e Event)
+
+// Observe the event by calling the function.
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+// Set the observer of the client's exchanges.
+func (cl *Client) WithObserver(o Observer) *Client {
+	cl.Observer = o
+	return cl
+}
+
+// Pass the event to the client's observer and to the trace log if enabled.
+func (cl *Client) observe(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if cl.Observer != nil {
+		cl.Observer.Observe(e)
+	}
+	if t := envTracer(); t != nil {
+		t.Observe(e)
+	}
+}
+
+// Tracer is an Observer writing a human readable line for each event.
+type Tracer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// Create a new Tracer writing to the writer provided.
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{w: w}
+}
+
+// Write the event as a line of the trace.
+func (t *Tracer) Observe(e Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintf(t.w, "[%d] %s: %s\n", os.Getpid(), e.Time.Format("2006-01-02T15:04:05.000000Z07:00"), e)
+}
+
+var (
+	traceOnce sync.Once
+	tracer    *Tracer
+)
+
+// Get the tracer enabled by the KRB5_TRACE environment variable.
+// As with MIT Kerberos the variable is the path of a file to which the trace is appended, for example /dev/stderr.
+func envTracer() *Tracer {
+	traceOnce.Do(func() {
+		p := os.Getenv("KRB5_TRACE")
+		if p == "" {
+			return
+		}
+		f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening KRB5_TRACE file %s: %v\n", p, err)
+			return
+		}
+		tracer = NewTracer(f)
+	})
+	return tracer
+}
+
+func (e Event) String() string {
+	var s string
+	switch e.Type {
+	case EventRequest:
+		s = fmt.Sprintf("Built %s for %s to %s with etypes %v", msgTypeName(e.MsgType), e.Principal, e.Service, e.ETypes)
+	case EventPreAuth:
+		s = fmt.Sprintf("Attempting pre-authentication with padata type %d", e.PAType)
+	case EventSend:
+		if e.Err != nil {
+			s = fmt.Sprintf("Sending %s (%d bytes) to %s for realm %s failed after %v: %v", msgTypeName(e.MsgType), e.Size, e.Server, e.Realm, e.Duration, e.Err)
+		} else {
+			s = fmt.Sprintf("Sent %s (%d bytes) to %s for realm %s, reply received in %v", msgTypeName(e.MsgType), e.Size, e.Server, e.Realm, e.Duration)
+		}
+	case EventKRBError:
+		s = fmt.Sprintf("Received KRB_ERROR %d from realm %s: %s", e.ErrorCode, e.Realm, e.Text)
+	case EventRetry:
+		s = fmt.Sprintf("Retrying %s: %s", msgTypeName(e.MsgType), e.Text)
+	case EventRenewal:
+		if e.Err != nil {
+			s = fmt.Sprintf("Renewal of TGT for %s failed: %v", e.Principal, e.Err)
+		} else {
+			s = fmt.Sprintf("Renewed TGT for %s: %s", e.Principal, e.Text)
+		}
+	default:
+		s = fmt.Sprintf("Unknown event type %d", e.Type)
+	}
+	return s
+}
+
+func msgTypeName(t int) string {
+	switch t {
+	case msgtype.KRB_AS_REQ:
+		return "AS_REQ"
+	case msgtype.KRB_TGS_REQ:
+		return "TGS_REQ"
+	case msgtype.KRB_AP_REQ:
+		return "AP_REQ"
+	case 0:
+		return "message"
+	}
+	return fmt.Sprintf("message type %d", t)
+}
+
+// Get the message type from the application tag of the marshalled Kerberos message.
+// Messages that are not a single Kerberos message, such as kpasswd requests, have type 0.
+func marshalledMsgType(b []byte) int {
+	if len(b) < 1 || b[0]&0xe0 != 0x60 {
+		return 0
+	}
+	return int(b[0] & 0x1f)
+}
+
+// Format the principal name components and realm.
+func principalString(nameString []string, realm string) string {
+	return strings.Join(nameString, "/") + "@" + realm
+}
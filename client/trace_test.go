@@ -0,0 +1,46 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/iana/msgtype"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestClient_Observer(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	cl := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	cl.WithConfig(c)
+	cl.WithTransport(TransportFunc(func(r, a string, b []byte) ([]byte, error) {
+		return nil, errors.New("KDC unreachable")
+	}))
+	var events []Event
+	cl.WithObserver(ObserverFunc(func(e Event) {
+		events = append(events, e)
+	}))
+	err := cl.Login()
+	assert.Error(t, err, "Login should fail when the KDC cannot be reached")
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d: %v", len(events), events)
+	}
+	assert.Equal(t, EventRequest, events[0].Type, "First event type not as expected")
+	assert.Equal(t, msgtype.KRB_AS_REQ, events[0].MsgType, "Request message type not as expected")
+	assert.Equal(t, "testuser1@TEST.GOKRB5", events[0].Principal, "Request principal not as expected")
+	assert.Equal(t, "krbtgt/TEST.GOKRB5@TEST.GOKRB5", events[0].Service, "Request service not as expected")
+	assert.Equal(t, EventSend, events[1].Type, "Second event type not as expected")
+	assert.Equal(t, msgtype.KRB_AS_REQ, events[1].MsgType, "Sent message type not as expected")
+	assert.Error(t, events[1].Err, "Send event should carry the transport error")
+	assert.False(t, events[1].Time.IsZero(), "Event time not set")
+}
+
+func TestTracer(t *testing.T) {
+	var buf bytes.Buffer
+	tr := NewTracer(&buf)
+	tr.Observe(Event{Type: EventKRBError, Realm: "TEST.GOKRB5", ErrorCode: 25, Text: "Additional pre-authentication required"})
+	assert.True(t, strings.Contains(buf.String(), "Received KRB_ERROR 25 from realm TEST.GOKRB5: Additional pre-authentication required"), "Trace line not as expected: %s", buf.String())
+	assert.True(t, strings.HasSuffix(buf.String(), "\n"), "Trace line not terminated")
+}
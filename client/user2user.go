@@ -0,0 +1,90 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"strings"
+)
+
+// Perform a user-to-user TGS exchange to retrieve a ticket to the peer principal specified.
+// The peer's TGT must be provided. The ticket issued by the KDC is encrypted in the session key of the peer's TGT.
+func (cl *Client) User2UserTGSExchange(spn types.PrincipalName, peerTGT types.Ticket) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
+	if cl.Session == nil {
+		return tgsReq, tgsRep, errors.New("Error client does not have a session. Client needs to login first")
+	}
+	tgsReq, err = messages.NewUser2UserTGSReqWithPrincipal(cl.Credentials.CName, cl.Session.CRealm, cl.Config, cl.Session.TGT, cl.Session.SessionKey, spn, false, peerTGT)
+	if err != nil {
+		return tgsReq, tgsRep, fmt.Errorf("Error generating New user-to-user TGS_REQ: %v", err)
+	}
+	tgsRep, err = cl.sendTGSReq(tgsReq, cl.Session.TGT.Realm, cl.Session.SessionKey)
+	return tgsReq, tgsRep, err
+}
+
+// Make a request to get a user-to-user ticket for the peer principal specified.
+// The peer's TGT must be provided. This will have been obtained from the peer by the application protocol.
+// The ticket will be added to the client's ticket cache.
+func (cl *Client) GetUser2UserServiceTicket(spn string, peerTGT types.Ticket) error {
+	princ := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: strings.Split(spn, "/"),
+	}
+	_, tgsRep, err := cl.User2UserTGSExchange(princ, peerTGT)
+	if err != nil {
+		return err
+	}
+	cl.Cache.AddEntryWithSessionKey(tgsRep.Ticket, tgsRep.DecryptedEncPart.AuthTime, tgsRep.DecryptedEncPart.EndTime, tgsRep.DecryptedEncPart.RenewTill, tgsRep.DecryptedEncPart.Key)
+	return nil
+}
+
+// Create an AP_REQ to send to the peer using the user-to-user ticket in the cache for the peer principal specified.
+func (cl *Client) NewUser2UserAPReq(spn string) (messages.APReq, error) {
+	tkt, key, ok := cl.Cache.getTicket(spn, cl.Config.Now())
+	if !ok {
+		return messages.APReq{}, fmt.Errorf("No valid user-to-user ticket in the cache for %s", spn)
+	}
+	return messages.NewUser2UserAPReq(tkt, key, cl.newAuthenticator())
+}
+
+// Verify a user-to-user AP_REQ received from a peer.
+// The ticket is decrypted with the session key of the client's own TGT rather than a key from a keytab.
+// The TGT must be the one provided to the peer when it requested the user-to-user ticket.
+// Tickets restricted to client addresses are not accepted. Use VerifyUser2UserAPReqFromAddress to verify these.
+func (cl *Client) VerifyUser2UserAPReq(apReq *messages.APReq) (bool, error) {
+	err := cl.decryptUser2UserAPReq(apReq)
+	if err != nil {
+		return false, err
+	}
+	return apReq.IsValid(cl.Config)
+}
+
+// Verify a user-to-user AP_REQ received from the peer address specified.
+// If the ticket is restricted to client addresses cAddr must be one of them.
+func (cl *Client) VerifyUser2UserAPReqFromAddress(apReq *messages.APReq, cAddr types.HostAddress) (bool, error) {
+	err := cl.decryptUser2UserAPReq(apReq)
+	if err != nil {
+		return false, err
+	}
+	return apReq.IsValidFromAddress(cl.Config, cAddr)
+}
+
+// Decrypt the ticket and authenticator of a user-to-user AP_REQ.
+func (cl *Client) decryptUser2UserAPReq(apReq *messages.APReq) error {
+	if cl.Session == nil {
+		return errors.New("Error client does not have a session. Client needs to login first")
+	}
+	if !types.IsFlagSet(&apReq.APOptions, types.APOptionUseSessionKey) {
+		return errors.New("AP_REQ does not have the use-session-key option set so is not a user-to-user request")
+	}
+	err := apReq.DecryptTicket(cl.Session.SessionKey)
+	if err != nil {
+		return fmt.Errorf("Error decrypting user-to-user ticket: %v", err)
+	}
+	err = apReq.DecryptAuthenticator()
+	if err != nil {
+		return fmt.Errorf("Error decrypting user-to-user authenticator: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/asn1tools"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Create the ticket the KDC would issue for a user-to-user exchange, encrypted in the session key of the peer's TGT.
+func testUser2UserTicket(t *testing.T, tgtSessionKey, sessionKey types.EncryptionKey, now time.Time) types.Ticket {
+	encPart := types.EncTicketPart{
+		Flags:    types.NewKrbFlags(),
+		Key:      sessionKey,
+		CRealm:   "TEST.GOKRB5",
+		CName:    types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"testuser1"}},
+		AuthTime: now.Add(-time.Minute),
+		EndTime:  now.Add(time.Hour),
+	}
+	b, err := asn1.Marshal(encPart)
+	if err != nil {
+		t.Fatalf("Error marshalling ticket encrypted part: %v", err)
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncTicketPart)
+	ed, err := crypto.GetEncryptedData(b, tgtSessionKey, keyusage.KDC_REP_TICKET, 0)
+	if err != nil {
+		t.Fatalf("Error encrypting ticket: %v", err)
+	}
+	return types.Ticket{
+		TktVNO:  5,
+		Realm:   "TEST.GOKRB5",
+		SName:   types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"testuser2"}},
+		EncPart: ed,
+	}
+}
+
+func TestUser2UserAPReq(t *testing.T) {
+	now := time.Now().UTC()
+	tgtSessionKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	tkt := testUser2UserTicket(t, tgtSessionKey, sessionKey, now)
+
+	initiator := NewClientWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue")
+	initiator.Config.LibDefaults.Default_realm = "TEST.GOKRB5"
+	initiator.Cache.AddEntryWithSessionKey(tkt, now.Add(-time.Minute), now.Add(time.Hour), now.Add(time.Hour), sessionKey)
+	apReq, err := initiator.NewUser2UserAPReq("testuser2")
+	if err != nil {
+		t.Fatalf("Error creating user-to-user AP_REQ: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&apReq.APOptions, types.APOptionUseSessionKey), "use-session-key option not set")
+	b, err := apReq.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling AP_REQ: %v", err)
+	}
+
+	acceptor := NewClientWithPassword("testuser2", "TEST.GOKRB5", "passwordvalue")
+	acceptor.Session = &Session{CRealm: "TEST.GOKRB5", SessionKey: tgtSessionKey}
+	var received messages.APReq
+	err = received.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling AP_REQ: %v", err)
+	}
+	ok, err := acceptor.VerifyUser2UserAPReq(&received)
+	if !ok || err != nil {
+		t.Fatalf("User-to-user AP_REQ not verified: %v", err)
+	}
+	assert.Equal(t, sessionKey, received.DecryptedTicket.Key, "Session key from the ticket not as expected")
+	assert.Equal(t, []string{"testuser1"}, received.DecryptedAuthenticator.CName.NameString, "Authenticator CName not as expected")
+
+	// The ticket cannot be decrypted with the session key of a different TGT
+	otherKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	acceptor.Session.SessionKey = otherKey
+	received = messages.APReq{}
+	received.Unmarshal(b)
+	ok, err = acceptor.VerifyUser2UserAPReq(&received)
+	assert.False(t, ok, "AP_REQ should not verify with another TGT's session key")
+	assert.Error(t, err, "AP_REQ should not verify with another TGT's session key")
+
+	// An AP_REQ without the use-session-key option is not a user-to-user request
+	received = messages.APReq{}
+	received.Unmarshal(b)
+	received.APOptions = types.NewKrbFlags()
+	acceptor.Session.SessionKey = tgtSessionKey
+	_, err = acceptor.VerifyUser2UserAPReq(&received)
+	assert.Error(t, err, "AP_REQ without use-session-key should not be accepted")
+}
+
+func TestUser2UserAPReq_expired(t *testing.T) {
+	now := time.Now().UTC()
+	tgtSessionKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	tkt := testUser2UserTicket(t, tgtSessionKey, sessionKey, now.Add(-2*time.Hour))
+	apReq, err := messages.NewUser2UserAPReq(tkt, sessionKey, types.NewAuthenticator("TEST.GOKRB5", "testuser1"))
+	if err != nil {
+		t.Fatalf("Error creating user-to-user AP_REQ: %v", err)
+	}
+	acceptor := NewClientWithPassword("testuser2", "TEST.GOKRB5", "passwordvalue")
+	acceptor.Session = &Session{CRealm: "TEST.GOKRB5", SessionKey: tgtSessionKey}
+	ok, err := acceptor.VerifyUser2UserAPReq(&apReq)
+	assert.False(t, ok, "AP_REQ with an expired ticket should not verify")
+	assert.Error(t, err, "AP_REQ with an expired ticket should not verify")
+}
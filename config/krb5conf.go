@@ -9,20 +9,25 @@ import (
 	"github.com/jcmturner/asn1"
 	"github.com/jcmturner/gokrb5/iana/etype"
 	"io"
+	"net"
 	"os"
 	"os/user"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 
 // Struct representing the KRB5 configuration.
 type Config struct {
-	LibDefaults *LibDefaults
-	Realms      []Realm
-	DomainRealm DomainRealm
+	// Offset of the KDC's clock in nanoseconds. It is accessed atomically as clients sharing the Config may record it
+	// concurrently, so is kept first in the struct for 64-bit alignment.
+	kdcTimeOffset int64
+	LibDefaults   *LibDefaults
+	Realms        []Realm
+	DomainRealm   DomainRealm
 	//CaPaths
 	//AppDefaults
 	//Plugins
@@ -60,7 +65,7 @@ type LibDefaults struct {
 	Dns_canonicalize_hostname  bool     //default true
 	Dns_lookup_kdc             bool     //default false
 	Dns_lookup_realm           bool
-	//extra_addresses []net.IPAddr //Not implementing yet
+	Extra_addresses            []net.IP //additional addresses placed in requests when noaddresses is false
 	Forwardable              bool           //default false
 	Ignore_acceptor_hostname bool           //default false
 	K5login_authoritative    bool           //default false
@@ -71,6 +76,9 @@ type LibDefaults struct {
 	Noaddresses           bool     //default true
 	Permitted_enctypes    []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
 	Permitted_enctype_ids []int
+	Pkinit_anchors        []string //trusted anchors for the KDC's certificate. FILE:path or DIR:path to PEM encoded certificates
+	Pkinit_dh_min_bits    int      //default 2048. Minimum strength in bits of the PKINIT key agreement group
+	Pkinit_kdc_hostname   []string //DNS names accepted in the KDC's certificate in place of the krbtgt principal name
 	//plugin_base_dir string //not supporting plugins
 	Preferred_preauth_types []int         //default “17, 16, 15, 14”, which forces libkrb5 to attempt to use PKINIT if it is supported
 	Proxiable               bool          //default false
@@ -102,6 +110,7 @@ func newLibDefaults() *LibDefaults {
 		Kdc_timesync:               1,
 		Noaddresses:                true,
 		Permitted_enctypes:         []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
+		Pkinit_dh_min_bits:         2048,
 		Preferred_preauth_types:    []int{17, 16, 15, 14},
 		Rdns:                 true,
 		Realm_try_domains:    -1,
@@ -174,6 +183,14 @@ func (l *LibDefaults) parseLines(lines []string) error {
 				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
 			}
 			l.Dns_lookup_realm = v
+		case "extra_addresses":
+			for _, a := range strings.FieldsFunc(p[1], func(r rune) bool { return r == ',' || r == ' ' }) {
+				ip := net.ParseIP(a)
+				if ip == nil {
+					return fmt.Errorf("libdefaults configuration line invalid. Invalid IP address %s: %s", a, line)
+				}
+				l.Extra_addresses = append(l.Extra_addresses, ip)
+			}
 		case "forwardable":
 			v, err := parseBoolean(p[1])
 			if err != nil {
@@ -218,6 +235,16 @@ func (l *LibDefaults) parseLines(lines []string) error {
 			l.Noaddresses = v
 		case "permitted_enctypes":
 			l.Permitted_enctypes = strings.Fields(p[1])
+		case "pkinit_anchors":
+			l.Pkinit_anchors = append(l.Pkinit_anchors, strings.TrimSpace(p[1]))
+		case "pkinit_dh_min_bits":
+			v, err := parsePKINITDHBits(p[1])
+			if err != nil {
+				return fmt.Errorf("libdefaults configuration line invalid. %v: %s", err, line)
+			}
+			l.Pkinit_dh_min_bits = v
+		case "pkinit_kdc_hostname":
+			l.Pkinit_kdc_hostname = append(l.Pkinit_kdc_hostname, strings.TrimSpace(p[1]))
 		case "preferred_preauth_types":
 			p[1] = strings.Replace(p[1], " ", "", -1)
 			t := strings.Split(p[1], ",")
@@ -418,6 +445,27 @@ func (c *Config) ResolveRealm(domainName string) string {
 	return c.LibDefaults.Default_realm
 }
 
+// Get the current time.
+// When kdc_timesync is enabled this is corrected by the offset of the KDC's clock recorded with SetKDCTime.
+func (c *Config) Now() time.Time {
+	return time.Now().Add(c.KDCTimeOffset())
+}
+
+// Record the offset of the KDC's clock from the local clock given the KDC's current time.
+// The offset is only recorded if kdc_timesync is enabled, in which case true is returned.
+func (c *Config) SetKDCTime(t time.Time) bool {
+	if c.LibDefaults.Kdc_timesync == 0 {
+		return false
+	}
+	atomic.StoreInt64(&c.kdcTimeOffset, int64(time.Until(t)))
+	return true
+}
+
+// Get the offset of the KDC's clock from the local clock.
+func (c *Config) KDCTimeOffset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.kdcTimeOffset))
+}
+
 // Load the KRB5 configuration from the specified file path.
 func Load(cfgPath string) (*Config, error) {
 	fh, err := os.Open(cfgPath)
@@ -429,6 +477,20 @@ func Load(cfgPath string) (*Config, error) {
 	return NewConfigFromScanner(scanner)
 }
 
+// Get the path of the default KRB5 configuration file.
+// This is the first file listed in the KRB5_CONFIG environment variable if set, otherwise /etc/krb5.conf.
+func DefaultPath() string {
+	if p := os.Getenv("KRB5_CONFIG"); p != "" {
+		return strings.Split(p, ":")[0]
+	}
+	return "/etc/krb5.conf"
+}
+
+// Load the default KRB5 configuration file.
+func LoadDefault() (*Config, error) {
+	return Load(DefaultPath())
+}
+
 // Create a new Config struct from a string.
 func NewConfigFromString(s string) (*Config, error) {
 	reader := strings.NewReader(s)
@@ -562,6 +624,30 @@ func parseDuration(s string) (time.Duration, error) {
 	return time.Duration(0), errors.New("Invalid time duration value")
 }
 
+// Parse the minimum PKINIT key agreement group strength in bits.
+// Any group at least this strong is accepted. The 2048 and 4096 bit MODP groups are supported along with the P-256,
+// P-384 and P-521 curves, which are as strong as 3072, 7680 and 15360 bit groups. The curve names are accepted and
+// mapped to these strengths, so P-256 allows any of the curves or the 4096 bit group but not the 2048 bit group.
+func parsePKINITDHBits(s string) (int, error) {
+	s = strings.Replace(s, " ", "", -1)
+	switch strings.ToUpper(s) {
+	case "P-256":
+		return 3072, nil
+	case "P-384":
+		return 7680, nil
+	case "P-521":
+		return 15360, nil
+	}
+	v, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, errors.New("Invalid PKINIT DH bits value")
+	}
+	if v < 1 || v > 15360 {
+		return 0, errors.New("Unsupported PKINIT DH bits value")
+	}
+	return int(v), nil
+}
+
 // Parse possible boolean values to golang bool.
 func parseBoolean(s string) (bool, error) {
 	s = strings.Replace(s, " ", "", -1)
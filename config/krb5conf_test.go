@@ -3,6 +3,7 @@ package config
 import (
 	"testing"
 	"io/ioutil"
+	"net"
 	"os"
 	"github.com/stretchr/testify/assert"
 	"time"
@@ -27,6 +28,10 @@ const krb5Conf = `
  default_keytab_name = FILE:/etc/krb5.keytab
  default_client_keytab_name = FILE:/home/gokrb5/client.keytab
  default_tkt_enctypes = aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96
+ pkinit_anchors = FILE:/etc/krb5/ca.pem
+ pkinit_anchors = DIR:/etc/krb5/anchors
+ pkinit_dh_min_bits = P-256
+ extra_addresses = 10.80.88.1, fe80::1
 
 [realms]
  TEST.GOKRB5 = {
@@ -74,6 +79,9 @@ func TestLoad(t *testing.T) {
 	assert.Equal(t, "FILE:/etc/krb5.keytab", c.LibDefaults.Default_keytab_name, "[libdefaults] default_keytab_name not as expected")
 	assert.Equal(t, "FILE:/home/gokrb5/client.keytab", c.LibDefaults.Default_client_keytab_name, "[libdefaults] default_client_keytab_name not as expected")
 	assert.Equal(t, []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96"}, c.LibDefaults.Default_tkt_enctypes, "[libdefaults] default_tkt_enctypes not as expected")
+	assert.Equal(t, []string{"FILE:/etc/krb5/ca.pem", "DIR:/etc/krb5/anchors"}, c.LibDefaults.Pkinit_anchors, "[libdefaults] pkinit_anchors not as expected")
+	assert.Equal(t, 3072, c.LibDefaults.Pkinit_dh_min_bits, "[libdefaults] pkinit_dh_min_bits not as expected")
+	assert.Equal(t, []net.IP{net.ParseIP("10.80.88.1"), net.ParseIP("fe80::1")}, c.LibDefaults.Extra_addresses, "[libdefaults] extra_addresses not as expected")
 
 	assert.Equal(t, 2, len(c.Realms), "Number of realms not as expected")
 	assert.Equal(t, "TEST.GOKRB5", c.Realms[0].Realm, "[realm] realm name not as expectd")
@@ -88,3 +96,48 @@ func TestLoad(t *testing.T) {
 	assert.Equal(t, "TEST.GOKRB5", c.DomainRealm["test.gokrb5"], "Domain to realm mapping not as expected")
 
 }
+
+func TestLoadDefault(t *testing.T) {
+	cf, _ := ioutil.TempFile(os.TempDir(), "TEST-gokrb5-krb5.conf")
+	defer os.Remove(cf.Name())
+	cf.WriteString(krb5Conf)
+
+	t.Setenv("KRB5_CONFIG", "")
+	assert.Equal(t, "/etc/krb5.conf", DefaultPath(), "Default path not as expected")
+	t.Setenv("KRB5_CONFIG", cf.Name()+":/etc/krb5.conf")
+	assert.Equal(t, cf.Name(), DefaultPath(), "Default path from KRB5_CONFIG not as expected")
+	c, err := LoadDefault()
+	if err != nil {
+		t.Fatalf("Error loading default config: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.Default_realm, "[libdefaults] default_realm not as expected")
+}
+
+func TestConfig_SetKDCTime(t *testing.T) {
+	c := NewConfig()
+	kdcTime := time.Now().Add(time.Hour)
+	assert.True(t, c.SetKDCTime(kdcTime), "KDC time not recorded with kdc_timesync enabled")
+	assert.True(t, c.Now().Sub(kdcTime) < time.Minute && kdcTime.Sub(c.Now()) < time.Minute, "Time not corrected by the KDC's clock offset")
+
+	c = NewConfig()
+	c.LibDefaults.Kdc_timesync = 0
+	assert.False(t, c.SetKDCTime(kdcTime), "KDC time recorded with kdc_timesync disabled")
+	assert.Equal(t, time.Duration(0), c.KDCTimeOffset(), "KDC clock offset not as expected")
+}
+
+func TestConfig_SetKDCTime_concurrent(t *testing.T) {
+	c := NewConfig()
+	kdcTime := time.Now().Add(time.Hour)
+	done := make(chan bool)
+	for i := 0; i < 4; i++ {
+		go func() {
+			c.SetKDCTime(kdcTime)
+			c.Now()
+			done <- true
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	assert.True(t, c.KDCTimeOffset() > 59*time.Minute, "KDC clock offset not as expected")
+}
@@ -0,0 +1,335 @@
+package credentials
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/types"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+const (
+	headerFieldTagKDCOffset = 1
+	configRealm             = "X-CACHECONF:"
+)
+
+// Credentials cache struct.
+// Implementation of the MIT credential cache file format: https://web.mit.edu/kerberos/krb5-devel/doc/formats/ccache_file_format.html
+type CCache struct {
+	Version          uint8
+	Header           CCacheHeader
+	DefaultPrincipal CCachePrincipal
+	Credentials      []CCacheCredential
+}
+
+// Credentials cache header struct.
+type CCacheHeader struct {
+	length uint16
+	fields []headerField
+}
+
+type headerField struct {
+	tag    uint16
+	length uint16
+	value  []byte
+}
+
+// Principal within a credentials cache.
+type CCachePrincipal struct {
+	Realm         string
+	PrincipalName types.PrincipalName
+}
+
+// Credential within a credentials cache.
+type CCacheCredential struct {
+	Client       CCachePrincipal
+	Server       CCachePrincipal
+	Key          types.EncryptionKey
+	AuthTime     time.Time
+	StartTime    time.Time
+	EndTime      time.Time
+	RenewTill    time.Time
+	IsSKey       bool
+	TicketFlags  asn1.BitString
+	Addresses    []types.HostAddress
+	AuthData     []types.AuthorizationDataEntry
+	Ticket       []byte
+	SecondTicket []byte
+}
+
+// Load a credentials cache file into a CCache type.
+func LoadCCache(cpath string) (CCache, error) {
+	k, err := ioutil.ReadFile(cpath)
+	if err != nil {
+		return CCache{}, err
+	}
+	return ParseCCache(k)
+}
+
+// Get the path of the default credentials cache.
+// This is the KRB5CCNAME environment variable if set, otherwise /tmp/krb5cc_<uid> as used by MIT Kerberos.
+// Only file credentials caches are supported.
+func DefaultCCachePath() (string, error) {
+	if n := os.Getenv("KRB5CCNAME"); n != "" {
+		if i := strings.Index(n, ":"); i > 0 {
+			if n[:i] != "FILE" {
+				return "", fmt.Errorf("Credentials cache type %s is not supported", n[:i])
+			}
+			n = n[i+1:]
+		}
+		return n, nil
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("Error getting current user for default credentials cache path: %v", err)
+	}
+	return "/tmp/krb5cc_" + usr.Uid, nil
+}
+
+// Load the default credentials cache.
+func LoadDefaultCCache() (CCache, error) {
+	p, err := DefaultCCachePath()
+	if err != nil {
+		return CCache{}, err
+	}
+	return LoadCCache(p)
+}
+
+// Parse byte slice of credentials cache data into a CCache type.
+func ParseCCache(b []byte) (CCache, error) {
+	var c CCache
+	//The first byte of the file always has the value 5
+	if len(b) < 2 || int8(b[0]) != 5 {
+		return c, errors.New("Invalid credentials cache data. First byte does not equal 5")
+	}
+	//Get credentials cache version
+	//The second byte contains the version number (1 to 4)
+	c.Version = uint8(b[1])
+	if c.Version < 1 || c.Version > 4 {
+		return c, errors.New("Invalid credentials cache data. Credentials cache version is not within 1 to 4")
+	}
+	r := &ccacheReader{b: b, p: 2, e: byteOrder(b, c.Version)}
+	if c.Version == 4 {
+		r.parseHeader(&c)
+	}
+	c.DefaultPrincipal = r.parsePrincipal(c.Version)
+	for r.err == nil && r.p < len(b) {
+		cred := r.parseCredential(c.Version)
+		c.Credentials = append(c.Credentials, cred)
+	}
+	if r.err != nil {
+		return c, r.err
+	}
+	return c, nil
+}
+
+// Get the byte order of the integers in the credentials cache from its version.
+// Versions 3 and 4 always use big-endian byte order. Versions 1 and 2 use the native byte order of the host that
+// wrote the file, which is detected from the first integer following the version: the principal's name type in
+// version 2 and its number of components in version 1. Both are small values so the byte order that gives the
+// smaller value is used.
+func byteOrder(b []byte, version uint8) binary.ByteOrder {
+	if version > 2 || len(b) < 6 {
+		return binary.BigEndian
+	}
+	if binary.LittleEndian.Uint32(b[2:6]) < binary.BigEndian.Uint32(b[2:6]) {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// Get the credential from the credentials cache for the server principal name specified.
+func (c *CCache) GetEntry(p types.PrincipalName) (CCacheCredential, bool) {
+	for _, cred := range c.Credentials {
+		// Configuration entries are stored as credentials with a special realm and should be ignored
+		if cred.Server.Realm == configRealm {
+			continue
+		}
+		if strings.Join(cred.Server.PrincipalName.NameString, "/") == strings.Join(p.NameString, "/") {
+			return cred, true
+		}
+	}
+	return CCacheCredential{}, false
+}
+
+// Get the client principal's realm as a string.
+func (c *CCache) GetClientRealm() string {
+	return c.DefaultPrincipal.Realm
+}
+
+// Get the client principal name.
+func (c *CCache) GetClientPrincipalName() types.PrincipalName {
+	return c.DefaultPrincipal.PrincipalName
+}
+
+// Reader of credentials cache bytes.
+// Once reading past the end of the data has been attempted err is set and subsequent reads return zero values.
+type ccacheReader struct {
+	b   []byte
+	p   int
+	e   binary.ByteOrder
+	err error
+}
+
+// Get the next n bytes of the data, setting err if there are not that many remaining.
+func (r *ccacheReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.b)-r.p {
+		r.err = errors.New("Invalid credentials cache data. Data is truncated")
+		return nil
+	}
+	b := r.b[r.p : r.p+n]
+	r.p += n
+	return b
+}
+
+// Read a count of items that each take at least size bytes, setting err if the data remaining could not hold them.
+// This prevents the count being used to make an excessive allocation.
+func (r *ccacheReader) readCount(size int) int {
+	n := int(r.readInt32())
+	if r.err == nil && (n < 0 || n > (len(r.b)-r.p)/size) {
+		r.err = fmt.Errorf("Invalid credentials cache data. Count of %d exceeds the data remaining", n)
+	}
+	if r.err != nil {
+		return 0
+	}
+	return n
+}
+
+// Parse the credentials cache header.
+func (r *ccacheReader) parseHeader(c *CCache) {
+	c.Header.length = uint16(r.readInt16())
+	end := r.p + int(c.Header.length)
+	for r.err == nil && r.p < end {
+		f := headerField{
+			tag:    uint16(r.readInt16()),
+			length: uint16(r.readInt16()),
+		}
+		f.value = r.readBytes(int(f.length))
+		c.Header.fields = append(c.Header.fields, f)
+	}
+}
+
+// Parse a principal from the credentials cache bytes.
+func (r *ccacheReader) parsePrincipal(version uint8) (princ CCachePrincipal) {
+	if version != 1 {
+		//Name Type is omitted in version 1
+		princ.PrincipalName.NameType = int(r.readInt32())
+	}
+	// Each component and the realm are prefixed with their length
+	nc := r.readCount(4)
+	if version == 1 {
+		//In version 1 the number of components includes the realm. Minus 1 to make consistent with version 2
+		nc--
+	}
+	princ.Realm = string(r.readData())
+	for i := 0; i < nc && r.err == nil; i++ {
+		princ.PrincipalName.NameString = append(princ.PrincipalName.NameString, string(r.readData()))
+	}
+	return princ
+}
+
+// Parse a credential from the credentials cache bytes.
+func (r *ccacheReader) parseCredential(version uint8) (cred CCacheCredential) {
+	cred.Client = r.parsePrincipal(version)
+	cred.Server = r.parsePrincipal(version)
+	key := types.EncryptionKey{}
+	key.KeyType = int(r.readInt16())
+	if version == 3 {
+		//repeated twice in version 3
+		key.KeyType = int(r.readInt16())
+	}
+	key.KeyValue = r.readData()
+	cred.Key = key
+	cred.AuthTime = r.readTimestamp()
+	cred.StartTime = r.readTimestamp()
+	cred.EndTime = r.readTimestamp()
+	cred.RenewTill = r.readTimestamp()
+	cred.IsSKey = r.readInt8() != 0
+	cred.TicketFlags = types.NewKrbFlags()
+	binary.BigEndian.PutUint32(cred.TicketFlags.Bytes, uint32(r.readInt32()))
+	// Addresses and authorization data entries each have a sixteen bit type and length prefixed data
+	cred.Addresses = make([]types.HostAddress, r.readCount(6))
+	for i := range cred.Addresses {
+		cred.Addresses[i] = r.readAddress()
+	}
+	cred.AuthData = make([]types.AuthorizationDataEntry, r.readCount(6))
+	for i := range cred.AuthData {
+		cred.AuthData[i] = r.readAuthDataEntry()
+	}
+	cred.Ticket = r.readData()
+	cred.SecondTicket = r.readData()
+	return
+}
+
+// Read an address from the credentials cache bytes.
+func (r *ccacheReader) readAddress() types.HostAddress {
+	a := types.HostAddress{}
+	a.AddrType = int(r.readInt16())
+	a.Address = r.readData()
+	return a
+}
+
+// Read an authorization data entry from the credentials cache bytes.
+func (r *ccacheReader) readAuthDataEntry() types.AuthorizationDataEntry {
+	a := types.AuthorizationDataEntry{}
+	a.ADType = int(r.readInt16())
+	a.ADData = r.readData()
+	return a
+}
+
+// Read data that is prefixed with its thirty two bit length.
+func (r *ccacheReader) readData() []byte {
+	l := r.readInt32()
+	return r.readBytes(int(l))
+}
+
+// Read bytes representing a timestamp.
+func (r *ccacheReader) readTimestamp() time.Time {
+	return time.Unix(int64(uint32(r.readInt32())), 0)
+}
+
+// Read bytes representing an eight bit integer.
+func (r *ccacheReader) readInt8() int8 {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+// Read bytes representing a sixteen bit integer.
+func (r *ccacheReader) readInt16() int16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(r.e.Uint16(b))
+}
+
+// Read bytes representing a thirty two bit integer.
+func (r *ccacheReader) readInt32() int32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(r.e.Uint32(b))
+}
+
+// Read a copy of the next s bytes.
+func (r *ccacheReader) readBytes(s int) []byte {
+	b := r.next(s)
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, s)
+	copy(c, b)
+	return c
+}
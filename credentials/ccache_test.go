@@ -0,0 +1,151 @@
+package credentials
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"os/user"
+	"testing"
+	"time"
+)
+
+// Version 4 credentials cache with a configuration entry and a TGT
+const ccacheDataHexStr = "0504000c00010008000000000000000000000001000000010000000b544553542e474f4b5242350000000974657374757365723100000001000000010000000b544553542e474f4b5242350000000974657374757365723100000000000000030000000c582d4341434845434f4e463a000000156b7262355f6363616368655f636f6e665f646174610000000a666173745f617661696c0000001e6b72627467742f544553542e474f4b52423540544553542e474f4b52423500120000000058ab01a058ab01a058ac532058b43c2000000000000000000000000000000000037965730000000000000001000000010000000b544553542e474f4b5242350000000974657374757365723100000002000000020000000b544553542e474f4b524235000000066b72627467740000000b544553542e474f4b524235001200000020000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f58ab01a058ab01a058ac532058b43c200050e1000000000000000000000000005e615c305aa003020105a1101b0e415448454e412e4d49542e454455a21a3018a003020101a111300f1b066866747361691b056578747261a3253023a003020100a103020105a21704156b726241534e2e312074657374206d65737361676500000000"
+
+func TestParseCCache(t *testing.T) {
+	b, _ := hex.DecodeString(ccacheDataHexStr)
+	c, err := ParseCCache(b)
+	if err != nil {
+		t.Fatalf("Error parsing credentials cache data: %v\n", err)
+	}
+	assert.Equal(t, uint8(4), c.Version, "Credentials cache version not as expected")
+	assert.Equal(t, 1, len(c.Header.fields), "Number of header fields not as expected")
+	assert.Equal(t, uint16(headerFieldTagKDCOffset), c.Header.fields[0].tag, "Header field tag not as expected")
+	assert.Equal(t, "TEST.GOKRB5", c.GetClientRealm(), "Client realm not as expected")
+	assert.Equal(t, nametype.KRB_NT_PRINCIPAL, c.GetClientPrincipalName().NameType, "Client name type not as expected")
+	assert.Equal(t, []string{"testuser1"}, c.GetClientPrincipalName().NameString, "Client name not as expected")
+	assert.Equal(t, 2, len(c.Credentials), "Number of credentials not as expected")
+	cred := c.Credentials[1]
+	assert.Equal(t, []string{"krbtgt", "TEST.GOKRB5"}, cred.Server.PrincipalName.NameString, "Server name not as expected")
+	assert.Equal(t, 18, cred.Key.KeyType, "Key type not as expected")
+	assert.Equal(t, "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", hex.EncodeToString(cred.Key.KeyValue), "Key value not as expected")
+	assert.Equal(t, time.Unix(1487602080, 0), cred.AuthTime, "Auth time not as expected")
+	assert.Equal(t, time.Unix(1487688480, 0), cred.EndTime, "End time not as expected")
+	assert.Equal(t, time.Unix(1488206880, 0), cred.RenewTill, "Renew till time not as expected")
+	assert.False(t, cred.IsSKey, "IsSKey not as expected")
+	assert.True(t, types.IsFlagSet(&cred.TicketFlags, types.Forwardable), "Forwardable flag not set")
+	assert.True(t, types.IsFlagSet(&cred.TicketFlags, types.Renewable), "Renewable flag not set")
+	tkt, err := types.UnmarshalTicket(cred.Ticket)
+	if err != nil {
+		t.Fatalf("Error unmarshalling ticket from credentials cache: %v", err)
+	}
+	assert.Equal(t, "ATHENA.MIT.EDU", tkt.Realm, "Ticket realm not as expected")
+}
+
+func TestCCache_GetEntry(t *testing.T) {
+	b, _ := hex.DecodeString(ccacheDataHexStr)
+	c, err := ParseCCache(b)
+	if err != nil {
+		t.Fatalf("Error parsing credentials cache data: %v\n", err)
+	}
+	cred, ok := c.GetEntry(types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: []string{"krbtgt", "TEST.GOKRB5"}})
+	assert.True(t, ok, "Entry for krbtgt not found")
+	assert.Equal(t, "TEST.GOKRB5", cred.Server.Realm, "Realm of entry not as expected")
+	_, ok = c.GetEntry(types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"HTTP", "host.test.gokrb5"}})
+	assert.False(t, ok, "Entry should not have been found")
+}
+
+func TestParseCCache_truncated(t *testing.T) {
+	b, _ := hex.DecodeString(ccacheDataHexStr)
+	_, err := ParseCCache(b[:len(b)-20])
+	assert.Error(t, err, "Truncated credentials cache should return an error")
+}
+
+func TestDefaultCCachePath(t *testing.T) {
+	orig := os.Getenv("KRB5CCNAME")
+	defer os.Setenv("KRB5CCNAME", orig)
+	os.Setenv("KRB5CCNAME", "FILE:/tmp/krb5cc_test")
+	p, err := DefaultCCachePath()
+	assert.NoError(t, err, "Error getting path of file credentials cache")
+	assert.Equal(t, "/tmp/krb5cc_test", p, "Path not as expected")
+	os.Setenv("KRB5CCNAME", "/tmp/krb5cc_test2")
+	p, _ = DefaultCCachePath()
+	assert.Equal(t, "/tmp/krb5cc_test2", p, "Path without type not as expected")
+	os.Setenv("KRB5CCNAME", "KEYRING:persistent:1000")
+	_, err = DefaultCCachePath()
+	assert.Error(t, err, "Keyring credentials cache should not be supported")
+	os.Unsetenv("KRB5CCNAME")
+	p, _ = DefaultCCachePath()
+	usr, _ := user.Current()
+	assert.Equal(t, "/tmp/krb5cc_"+usr.Uid, p, "Default path not as expected")
+}
+
+// Build credentials cache data for the version and byte order provided with a single credential claiming the number
+// of addresses specified.
+func testCCacheData(version uint8, e binary.ByteOrder, addresses uint32) []byte {
+	var b []byte
+	i16 := func(i uint16) {
+		v := make([]byte, 2)
+		e.PutUint16(v, i)
+		b = append(b, v...)
+	}
+	i32 := func(i uint32) {
+		v := make([]byte, 4)
+		e.PutUint32(v, i)
+		b = append(b, v...)
+	}
+	data := func(d string) {
+		i32(uint32(len(d)))
+		b = append(b, d...)
+	}
+	principal := func(name string) {
+		i32(1)
+		i32(1)
+		data("TEST.GOKRB5")
+		data(name)
+	}
+	b = append(b, 5, version)
+	principal("testuser1")
+	principal("testuser1")
+	principal("HTTP")
+	i16(18)
+	if version == 3 {
+		i16(18)
+	}
+	data("key")
+	for i := 0; i < 4; i++ {
+		i32(1487602080)
+	}
+	b = append(b, 0)
+	i32(0)
+	i32(addresses)
+	i32(0)
+	data("ticket")
+	data("")
+	return b
+}
+
+func TestParseCCache_byteOrder(t *testing.T) {
+	c, err := ParseCCache(testCCacheData(2, binary.LittleEndian, 0))
+	if err != nil {
+		t.Fatalf("Error parsing little-endian version 2 credentials cache: %v", err)
+	}
+	assert.Equal(t, []string{"testuser1"}, c.GetClientPrincipalName().NameString, "Client name not as expected")
+	assert.Equal(t, 1, len(c.Credentials), "Number of credentials not as expected")
+	assert.Equal(t, []byte("ticket"), c.Credentials[0].Ticket, "Ticket not as expected")
+	c, err = ParseCCache(testCCacheData(3, binary.BigEndian, 0))
+	if err != nil {
+		t.Fatalf("Error parsing version 3 credentials cache: %v", err)
+	}
+	assert.Equal(t, time.Unix(1487602080, 0), c.Credentials[0].EndTime, "End time not as expected")
+}
+
+func TestParseCCache_excessiveCount(t *testing.T) {
+	_, err := ParseCCache(testCCacheData(3, binary.BigEndian, 0x7fffffff))
+	assert.Error(t, err, "Count of addresses exceeding the data should return an error")
+	_, err = ParseCCache(testCCacheData(3, binary.BigEndian, 0xffffffff))
+	assert.Error(t, err, "Negative count of addresses should return an error")
+}
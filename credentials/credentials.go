@@ -2,35 +2,59 @@
 package credentials
 
 import (
+	"crypto"
+	"crypto/x509"
 	"github.com/jcmturner/gokrb5/keytab"
 	"github.com/jcmturner/gokrb5/types"
-	"github.com/jcmturner/gokrb5/iana/nametype"
 )
 
 // Credentials struct for a user.
 // Contains either a keytab, password or both.
-// Keytabs are used over passwords if both are defined.
+// Keytabs are used over passwords if both are defined. A KeyProvider may be defined instead to supply keys on demand.
+// A certificate and private key may also be defined for PKINIT pre-authentication.
 type Credentials struct {
 	Username string
 	Realm string
 	CName types.PrincipalName
 	Keytab   keytab.Keytab
 	Password string
+	Certificate *x509.Certificate
+	PrivateKey  crypto.Signer
+	KeyProvider KeyProvider
 }
 
 // Create a new Credentials struct.
+// The username may be a principal name string such as user/admin@EXAMPLE.COM. If it includes a realm this is used
+// when the realm provided is empty.
 func NewCredentials(username string, realm string) Credentials {
+	cname, r := types.ParsePrincipalName(username)
+	if realm == "" {
+		realm = r
+	}
+	return NewCredentialsFromPrincipal(cname, realm)
+}
+
+// Create a new Credentials struct for the principal name, of any name type, and realm provided.
+// For example a service account such as host/app01.example.com with the KRB_NT_SRV_HST name type.
+func NewCredentialsFromPrincipal(cname types.PrincipalName, realm string) Credentials {
 	return Credentials{
-		Username: username,
-		Realm: realm,
-		CName: types.PrincipalName{
-			NameType: nametype.KRB_NT_PRINCIPAL,
-			NameString: []string{username},
-		},
+		Username: cname.PrincipalNameString(),
+		Realm:    realm,
+		CName:    cname,
 		Keytab:   keytab.NewKeytab(),
 	}
 }
 
+// Create a new Credentials struct for the well-known anonymous principal of the realm.
+// Anonymous credentials are used to get anonymous tickets with anonymous PKINIT. Ref: RFC 8062
+func NewAnonymousCredentials(realm string) Credentials {
+	return Credentials{
+		Realm:  realm,
+		CName:  types.NewAnonymousPrincipalName(),
+		Keytab: keytab.NewKeytab(),
+	}
+}
+
 // Set the Keytab in the Credentials struct.
 func (c *Credentials) WithKeytab(kt keytab.Keytab) *Credentials {
 	c.Keytab = kt
@@ -58,3 +82,21 @@ func (c *Credentials) HasPassword() bool {
 	}
 	return false
 }
+
+// Set the X.509 certificate and corresponding private key in the Credentials struct for PKINIT.
+// The private key may be any crypto.Signer, for example one backed by a smartcard.
+func (c *Credentials) WithCertificate(cert *x509.Certificate, key crypto.Signer) *Credentials {
+	c.Certificate = cert
+	c.PrivateKey = key
+	return c
+}
+
+// Query if the Credentials has a certificate and private key defined.
+func (c *Credentials) HasCertificate() bool {
+	return c.Certificate != nil && c.PrivateKey != nil
+}
+
+// Query if the Credentials are for the well-known anonymous principal.
+func (c *Credentials) IsAnonymous() bool {
+	return c.CName.IsAnonymous()
+}
@@ -0,0 +1,101 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/keytab"
+	"github.com/jcmturner/gokrb5/types"
+)
+
+// KeyProvider is a source of the client's long term key. This is the reply key used to decrypt the AS_REP and the
+// key used for pre-authentication.
+// Keys are requested on demand so the provider may fetch secrets lazily, for example from a secret manager.
+type KeyProvider interface {
+	// Get the key of the encryption type specified for the principal and realm.
+	// A kvno of 0 means any key version. pas is the padata from the KDC which may carry salt and string-to-key
+	// parameters for deriving the key.
+	GetKey(cname types.PrincipalName, realm string, etype, kvno int, pas types.PADataSequence) (types.EncryptionKey, error)
+}
+
+// KeyProviderFunc allows an ordinary function to be used as a KeyProvider.
+type KeyProviderFunc func(cname types.PrincipalName, realm string, etype, kvno int, pas types.PADataSequence) (types.EncryptionKey, error)
+
+// Get the key by calling the function.
+func (f KeyProviderFunc) GetKey(cname types.PrincipalName, realm string, etype, kvno int, pas types.PADataSequence) (types.EncryptionKey, error) {
+	return f(cname, realm, etype, kvno, pas)
+}
+
+// Create a KeyProvider that gets keys from the keytab.
+func KeytabKeyProvider(kt keytab.Keytab) KeyProvider {
+	return KeyProviderFunc(func(cname types.PrincipalName, realm string, etype, kvno int, pas types.PADataSequence) (types.EncryptionKey, error) {
+		key, err := kt.GetEncryptionKeyForPrincipal(cname, realm, kvno, etype)
+		if err != nil {
+			return key, fmt.Errorf("Error getting key from keytab: %v", err)
+		}
+		return key, nil
+	})
+}
+
+// Create a KeyProvider that derives keys from the password.
+func PasswordKeyProvider(password string) KeyProvider {
+	return PasswordFuncKeyProvider(func() (string, error) {
+		return password, nil
+	})
+}
+
+// Create a KeyProvider that derives keys from a password returned by the function.
+// The function is called each time a key is needed so the password can be fetched when required, for example from a
+// vault or by prompting the user, rather than held for the lifetime of the credentials.
+func PasswordFuncKeyProvider(f func() (string, error)) KeyProvider {
+	return KeyProviderFunc(func(cname types.PrincipalName, realm string, etype, kvno int, pas types.PADataSequence) (types.EncryptionKey, error) {
+		var key types.EncryptionKey
+		password, err := f()
+		if err != nil {
+			return key, fmt.Errorf("Error getting password: %v", err)
+		}
+		key, _, err = crypto.GetKeyFromPassword(password, cname, realm, etype, pas)
+		if err != nil {
+			return key, fmt.Errorf("Error deriving key from password: %v", err)
+		}
+		return key, nil
+	})
+}
+
+// Create a KeyProvider for raw keys, for example keys held in a secret manager.
+// The key matching the encryption type requested is returned.
+func StaticKeyProvider(keys ...types.EncryptionKey) KeyProvider {
+	return KeyProviderFunc(func(cname types.PrincipalName, realm string, etype, kvno int, pas types.PADataSequence) (types.EncryptionKey, error) {
+		for _, key := range keys {
+			if key.KeyType == etype {
+				return key, nil
+			}
+		}
+		return types.EncryptionKey{}, fmt.Errorf("No key available for encryption type %d", etype)
+	})
+}
+
+// Set the KeyProvider in the Credentials struct. The provider is used over any keytab or password.
+func (c *Credentials) WithKeyProvider(p KeyProvider) *Credentials {
+	c.KeyProvider = p
+	return c
+}
+
+// Query if the Credentials has a source for the client's long term key: a key provider, keytab or password.
+func (c *Credentials) HasKey() bool {
+	return c.KeyProvider != nil || c.HasKeytab() || c.HasPassword()
+}
+
+// Get the client's long term key of the encryption type specified for the principal and realm.
+// The key provider is used if there is one, otherwise the keytab and then the password.
+func (c *Credentials) GetKey(cname types.PrincipalName, realm string, etype, kvno int, pas types.PADataSequence) (types.EncryptionKey, error) {
+	switch {
+	case c.KeyProvider != nil:
+		return c.KeyProvider.GetKey(cname, realm, etype, kvno, pas)
+	case c.HasKeytab():
+		return KeytabKeyProvider(c.Keytab).GetKey(cname, realm, etype, kvno, pas)
+	case c.HasPassword():
+		return PasswordKeyProvider(c.Password).GetKey(cname, realm, etype, kvno, pas)
+	}
+	return types.EncryptionKey{}, errors.New("No secret available in credentials")
+}
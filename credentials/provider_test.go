@@ -0,0 +1,80 @@
+package credentials
+
+import (
+	"errors"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/keytab"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestStaticKeyProvider(t *testing.T) {
+	k17 := types.EncryptionKey{KeyType: etype.AES128_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 16)}
+	k18 := types.EncryptionKey{KeyType: etype.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}
+	p := StaticKeyProvider(k17, k18)
+	cname, _ := types.ParsePrincipalName("testuser1")
+	key, err := p.GetKey(cname, "TEST.GOKRB5", etype.AES256_CTS_HMAC_SHA1_96, 0, nil)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, k18, key, "Key not as expected")
+	_, err = p.GetKey(cname, "TEST.GOKRB5", etype.RC4_HMAC, 0, nil)
+	assert.Error(t, err, "There should be no key for the encryption type")
+}
+
+func TestPasswordFuncKeyProvider(t *testing.T) {
+	var calls int
+	p := PasswordFuncKeyProvider(func() (string, error) {
+		calls++
+		return "passwordvalue", nil
+	})
+	cname, _ := types.ParsePrincipalName("testuser1")
+	key, err := p.GetKey(cname, "TEST.GOKRB5", etype.AES256_CTS_HMAC_SHA1_96, 0, nil)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	expected, err := PasswordKeyProvider("passwordvalue").GetKey(cname, "TEST.GOKRB5", etype.AES256_CTS_HMAC_SHA1_96, 0, nil)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, expected, key, "Key derived from password not as expected")
+	assert.Equal(t, 1, calls, "Password function should be called when the key is requested")
+
+	p = PasswordFuncKeyProvider(func() (string, error) {
+		return "", errors.New("vault unavailable")
+	})
+	_, err = p.GetKey(cname, "TEST.GOKRB5", etype.AES256_CTS_HMAC_SHA1_96, 0, nil)
+	assert.Error(t, err, "Error from the password function should be returned")
+}
+
+func TestCredentials_GetKey(t *testing.T) {
+	c := NewCredentials("testuser1", "TEST.GOKRB5")
+	assert.False(t, c.HasKey(), "Credentials should not have a key")
+	_, err := c.GetKey(c.CName, c.Realm, etype.AES256_CTS_HMAC_SHA1_96, 0, nil)
+	assert.Error(t, err, "Getting a key without a secret should fail")
+
+	kt := keytab.NewKeytab()
+	e := keytab.KeytabEntry{
+		Principal: keytab.Principal{NumComponents: 1, Realm: "TEST.GOKRB5", Components: []string{"testuser1"}, NameType: 1},
+		Timestamp: time.Now(),
+		KVNO:      1,
+		Key:       types.EncryptionKey{KeyType: etype.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("keytab")},
+	}
+	kt.Entries = append(kt.Entries, e)
+	c.WithKeytab(kt)
+	assert.True(t, c.HasKey(), "Credentials should have a key")
+	key, err := c.GetKey(c.CName, c.Realm, etype.AES256_CTS_HMAC_SHA1_96, 1, nil)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, []byte("keytab"), key.KeyValue, "Key from keytab not as expected")
+
+	c.WithKeyProvider(StaticKeyProvider(types.EncryptionKey{KeyType: etype.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte("provider")}))
+	key, err = c.GetKey(c.CName, c.Realm, etype.AES256_CTS_HMAC_SHA1_96, 1, nil)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, []byte("provider"), key.KeyValue, "Key provider should be used over the keytab")
+}
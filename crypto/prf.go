@@ -0,0 +1,101 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/jcmturner/gokrb5/types"
+)
+
+// Pseudo-random function for the simplified profile as defined in RFC 3961 section 5.3 and RFC 3962 section 6.
+// tmp1 = H(octet-string)
+// tmp2 = truncate tmp1 to multiple of m
+// PRF = E(DK(protocol-key, prfconstant), tmp2, initial-cipher-state)
+func PseudoRandom(key, b []byte, e EType) ([]byte, error) {
+	h := e.GetHash()
+	h.Write(b)
+	tmp1 := h.Sum(nil)
+	// Truncate to a multiple of the cipher block size
+	bs := e.GetCypherBlockBitLength() / 8
+	tmp2 := tmp1[:(len(tmp1)/bs)*bs]
+	k, err := e.DeriveKey(key, []byte("prf"))
+	if err != nil {
+		return nil, fmt.Errorf("Error deriving key for pseudo-random function: %v", err)
+	}
+	_, prf, err := e.Encrypt(k, tmp2)
+	if err != nil {
+		return nil, fmt.Errorf("Error encrypting in pseudo-random function: %v", err)
+	}
+	return prf, nil
+}
+
+// PRF+ function as defined in RFC 6113 section 5.1.
+// PRF+(protocol key, octet string) -> (octet string)
+// PRF+(key, shared-info) := pseudo-random( key,  1 || shared-info ) || pseudo-random( key, 2 || shared-info ) || ...
+// The output is truncated to the number of bytes specified.
+func PRFPlus(key, b []byte, l int, e EType) ([]byte, error) {
+	if l > 255*e.GetCypherBlockBitLength()/8 {
+		return nil, errors.New("Length requested from PRF+ is too large")
+	}
+	var out []byte
+	for i := 1; len(out) < l; i++ {
+		r, err := PseudoRandom(key, append([]byte{byte(i)}, b...), e)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r...)
+	}
+	return out[:l], nil
+}
+
+// KRB-FX-CF2 function as defined in RFC 6113 section 5.1.
+// Combines two keys to produce a new key of the same encryption type as the first key.
+// KRB-FX-CF2(protocol key, protocol key, octet string, octet string) -> (protocol key)
+func KRBFXCF2(key1, key2 types.EncryptionKey, pepper1, pepper2 string) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	e1, err := GetEtype(key1.KeyType)
+	if err != nil {
+		return key, fmt.Errorf("Error getting etype of first key: %v", err)
+	}
+	e2, err := GetEtype(key2.KeyType)
+	if err != nil {
+		return key, fmt.Errorf("Error getting etype of second key: %v", err)
+	}
+	l := e1.GetKeySeedBitLength() / 8
+	o1, err := PRFPlus(key1.KeyValue, []byte(pepper1), l, e1)
+	if err != nil {
+		return key, fmt.Errorf("Error in PRF+ of first key: %v", err)
+	}
+	o2, err := PRFPlus(key2.KeyValue, []byte(pepper2), l, e2)
+	if err != nil {
+		return key, fmt.Errorf("Error in PRF+ of second key: %v", err)
+	}
+	for i := range o1 {
+		o1[i] = o1[i] ^ o2[i]
+	}
+	key = types.EncryptionKey{
+		KeyType:  key1.KeyType,
+		KeyValue: e1.RandomToKey(o1),
+	}
+	return key, nil
+}
+
+// Generate a new random key of the encryption type specified.
+// This can be used as a sub-session key.
+func GenerateKey(etypeID int) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	e, err := GetEtype(etypeID)
+	if err != nil {
+		return key, fmt.Errorf("Error getting etype to generate key: %v", err)
+	}
+	b := make([]byte, e.GetKeySeedBitLength()/8)
+	_, err = rand.Read(b)
+	if err != nil {
+		return key, fmt.Errorf("Could not generate random key: %v", err)
+	}
+	key = types.EncryptionKey{
+		KeyType:  etypeID,
+		KeyValue: e.RandomToKey(b),
+	}
+	return key, nil
+}
@@ -0,0 +1,55 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKRBFXCF2(t *testing.T) {
+	// Test vectors from MIT Kerberos t_cf2 where the keys are derived from string to key with the string as the salt.
+	var tests = []struct {
+		etype    int
+		key1     string
+		key2     string
+		pepper1  string
+		pepper2  string
+		expected string
+	}{
+		{etype.AES128_CTS_HMAC_SHA1_96, "key1", "key2", "a", "b", "97df97e4b798b29eb31ed7280287a92a"},
+		{etype.AES256_CTS_HMAC_SHA1_96, "key1", "key2", "a", "b", "4d6ca4e629785c1f01baf55e2e548566b9617ae3a96868c337cb93b5e72b1c7b"},
+	}
+	for _, test := range tests {
+		e, err := GetEtype(test.etype)
+		if err != nil {
+			t.Fatalf("Error getting etype: %v", err)
+		}
+		kb1, err := e.StringToKey(test.key1, test.key1, e.GetDefaultStringToKeyParams())
+		if err != nil {
+			t.Fatalf("Error deriving key1: %v", err)
+		}
+		kb2, err := e.StringToKey(test.key2, test.key2, e.GetDefaultStringToKeyParams())
+		if err != nil {
+			t.Fatalf("Error deriving key2: %v", err)
+		}
+		k1 := types.EncryptionKey{KeyType: test.etype, KeyValue: kb1}
+		k2 := types.EncryptionKey{KeyType: test.etype, KeyValue: kb2}
+		k, err := KRBFXCF2(k1, k2, test.pepper1, test.pepper2)
+		if err != nil {
+			t.Fatalf("Error in KRB-FX-CF2: %v", err)
+		}
+		assert.Equal(t, test.etype, k.KeyType, "Key type of KRB-FX-CF2 output not as expected")
+		assert.Equal(t, test.expected, hex.EncodeToString(k.KeyValue), "KRB-FX-CF2 output not as expected")
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	k, err := GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	assert.Equal(t, etype.AES256_CTS_HMAC_SHA1_96, k.KeyType, "Key type not as expected")
+	assert.Equal(t, 32, len(k.KeyValue), "Key length not as expected")
+}
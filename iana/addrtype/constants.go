@@ -0,0 +1,13 @@
+package addrtype
+
+const (
+	IPv4            = 2
+	Directional     = 3
+	ChaosNet        = 5
+	XNS             = 6
+	ISO             = 7
+	DECNET_Phase_IV = 12
+	AppleTalk_DDP   = 16
+	NetBios         = 20
+	IPv6            = 24
+)
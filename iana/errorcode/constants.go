@@ -69,4 +69,10 @@ const (
 	KDC_ERR_REVOCATION_STATUS_UNAVAILABLE = 74 //Reserved for PKINIT
 	KDC_ERR_CLIENT_NAME_MISMATCH          = 75 //Reserved for PKINIT
 	KDC_ERR_KDC_NAME_MISMATCH             = 76 //Reserved for PKINIT
+	KDC_ERR_MORE_PREAUTH_DATA_REQUIRED    = 91 //More pre-authentication data is required
+)
+
+// Codes given a new meaning by later specifications.
+const (
+	KDC_ERR_DH_KEY_PARAMETERS_NOT_ACCEPTED = KDC_ERR_KEY_TOO_WEAK //PKINIT Diffie-Hellman group not accepted. Ref: RFC 4556 Section 3.2.2
 )
@@ -24,7 +24,20 @@ const (
 	GSSAPI_ACCEPTOR_SIGN  = 23
 	GSSAPI_INITIATOR_SEAL = 24
 	GSSAPI_INITIATOR_SIGN = 25
-	KEY_USAGE_AS_REQ      = 56
+	//RFC 8062
+	KEY_USAGE_PA_PKINIT_KX = 44
+	//RFC 6560
+	KEY_USAGE_PA_OTP_REQUEST = 45
+	//RFC 6113
+	KEY_USAGE_FAST_REQ_CHKSUM      = 50
+	KEY_USAGE_FAST_ENC             = 51
+	KEY_USAGE_FAST_REP             = 52
+	KEY_USAGE_FAST_FINISHED        = 53
+	KEY_USAGE_ENC_CHALLENGE_CLIENT = 54
+	KEY_USAGE_ENC_CHALLENGE_KDC    = 55
+	KEY_USAGE_AS_REQ               = 56
+	//draft-ietf-kitten-krb-spake-preauth
+	KEY_USAGE_SPAKE = 65
 	//26-511.  Reserved for future use in Kerberos and related protocols.
 	//512-1023.  Reserved for uses internal to a Kerberos implementation.
 	//1024.  Encryption for application use in protocols that do not specify key usage values
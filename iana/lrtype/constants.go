@@ -0,0 +1,14 @@
+// Kerberos last request type assigned numbers. Ref: RFC 4120 Section 5.4.2
+// Negative values indicate the information pertains only to the responding server.
+package lrtype
+
+const (
+	NONE                 = 0
+	LAST_INITIAL_TGT_REQ = 1
+	LAST_INITIAL_REQ     = 2
+	NEWEST_TGT_ISSUE     = 3
+	LAST_RENEWAL         = 4
+	LAST_REQ             = 5
+	PW_EXPTIME           = 6
+	ACCT_EXPTIME         = 7
+)
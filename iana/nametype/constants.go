@@ -10,4 +10,5 @@ const (
 	KRB_NT_X500_PRINCIPAL = 6  //Encoded X.509 Distinguished name [RFC2253]
 	KRB_NT_SMTP_NAME      = 7  //Name in form of SMTP email name (e.g., user@example.com)
 	KRB_NT_ENTERPRISE     = 10 //Enterprise name; may be mapped to principal name
+	KRB_NT_WELLKNOWN      = 11 //Well-known principal names [RFC6111]
 )
@@ -69,7 +69,9 @@ const (
 	PA_PKU2U_NAME     = 148
 	PA_REQ_ENC_PA_REP = 149
 	PA_AS_FRESHNESS   = 150
-	//UNASSIGNED : 151-164
+	PA_SPAKE          = 151
+	//UNASSIGNED : 152-164
 	PA_SUPPORTED_ETYPES = 165
 	PA_EXTENDED_ERROR   = 166
+	PA_PAC_OPTIONS      = 167
 )
@@ -0,0 +1,191 @@
+package kadmin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"time"
+)
+
+/*
+Request and reply framing. Ref: RFC 3244 Section 2 and 3
+
+ 0                   1                   2                   3
+ 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
++-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+|         message length        |    protocol version number    |
++-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+|          AP_REQ length        |         AP-REQ data           /
++-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+/                        KRB-PRIV message                       /
++-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+The reply has the same layout with an AP-REP in place of the AP-REQ. If the AP-REP length is zero a KRB-ERROR follows
+instead of the KRB-PRIV.
+*/
+
+// Result codes. Ref: RFC 3244 Section 2
+const (
+	KRB5_KPASSWD_SUCCESS             = 0
+	KRB5_KPASSWD_MALFORMED           = 1
+	KRB5_KPASSWD_HARDERROR           = 2
+	KRB5_KPASSWD_AUTHERROR           = 3
+	KRB5_KPASSWD_SOFTERROR           = 4
+	KRB5_KPASSWD_ACCESSDENIED        = 5
+	KRB5_KPASSWD_BAD_VERSION         = 6
+	KRB5_KPASSWD_INITIAL_FLAG_NEEDED = 7
+)
+
+var resultCodeText = map[int]string{
+	KRB5_KPASSWD_SUCCESS:             "success",
+	KRB5_KPASSWD_MALFORMED:           "request fails basic integrity checks",
+	KRB5_KPASSWD_HARDERROR:           "server error",
+	KRB5_KPASSWD_AUTHERROR:           "request fails authentication",
+	KRB5_KPASSWD_SOFTERROR:           "password change rejected",
+	KRB5_KPASSWD_ACCESSDENIED:        "not authorized",
+	KRB5_KPASSWD_BAD_VERSION:         "unknown protocol version",
+	KRB5_KPASSWD_INITIAL_FLAG_NEEDED: "initial flag required",
+}
+
+const headerLen = 6
+
+type Request struct {
+	Version int
+	APREQ   messages.APReq
+	KRBPriv messages.KRBPriv
+}
+
+type Reply struct {
+	Version    int
+	APREP      messages.APRep
+	KRBPriv    messages.KRBPriv
+	KRBError   *messages.KRBError
+	ResultCode int
+	Result     string
+}
+
+func (r *Request) Marshal() ([]byte, error) {
+	ab, err := r.APREQ.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling AP_REQ: %v", err)
+	}
+	pb, err := r.KRBPriv.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	l := headerLen + len(ab) + len(pb)
+	if l > 0xffff {
+		return nil, errors.New("kpasswd request is too large")
+	}
+	b := make([]byte, headerLen, l)
+	binary.BigEndian.PutUint16(b[0:2], uint16(l))
+	binary.BigEndian.PutUint16(b[2:4], uint16(r.Version))
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(ab)))
+	b = append(b, ab...)
+	b = append(b, pb...)
+	return b, nil
+}
+
+func (r *Reply) Unmarshal(b []byte) error {
+	if len(b) < headerLen {
+		return errors.New("kpasswd reply is too short")
+	}
+	if int(binary.BigEndian.Uint16(b[0:2])) != len(b) {
+		return fmt.Errorf("kpasswd reply length does not match the message length. Message length: %d; Actual: %d", binary.BigEndian.Uint16(b[0:2]), len(b))
+	}
+	r.Version = int(binary.BigEndian.Uint16(b[2:4]))
+	if r.Version != VersionChangePasswd && r.Version != VersionSetPasswd {
+		return fmt.Errorf("kpasswd reply has an unknown protocol version: %#x", r.Version)
+	}
+	al := int(binary.BigEndian.Uint16(b[4:6]))
+	if al == 0 {
+		var krberr messages.KRBError
+		err := krberr.Unmarshal(b[headerLen:])
+		if err != nil {
+			return fmt.Errorf("Error unmarshalling kpasswd KRB_ERROR: %v", err)
+		}
+		r.KRBError = &krberr
+		// The e-data of the error carries the result
+		if len(krberr.EData) >= 2 {
+			r.unmarshalResult(krberr.EData)
+		}
+		return nil
+	}
+	if headerLen+al > len(b) {
+		return errors.New("kpasswd reply AP_REP length exceeds the message length")
+	}
+	err := r.APREP.Unmarshal(b[headerLen : headerLen+al])
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling kpasswd AP_REP: %v", err)
+	}
+	err = r.KRBPriv.Unmarshal(b[headerLen+al:])
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling kpasswd KRB_PRIV: %v", err)
+	}
+	return nil
+}
+
+// Decrypt the reply and get the result.
+// auth is the authenticator sent in the request and sAddress is the address of the kpasswd server.
+// The AP_REP is decrypted with the session key of the kadmin/changepw ticket and must carry the time from the
+// authenticator. The KRB_PRIV is encrypted in the sub-session key from the AP_REP, or that of the authenticator if the
+// server did not provide one. It must be from the server's address, have the sequence number from the AP_REP and, if it
+// has a timestamp, a time within the clock skew. Ref: RFC 4120 Sections 3.2.5 and 3.4
+// If the server returned a KRB_ERROR it is returned as the error.
+func (r *Reply) Decrypt(sessionKey types.EncryptionKey, auth types.Authenticator, sAddress types.HostAddress, cfg *config.Config) error {
+	if r.KRBError != nil {
+		return *r.KRBError
+	}
+	ep, err := r.APREP.DecryptEncPart(sessionKey)
+	if err != nil {
+		return err
+	}
+	if ep.CTime.Unix() != auth.CTime.Unix() || ep.Cusec != auth.Cusec {
+		return errors.New("AP_REP time does not match that of the authenticator sent")
+	}
+	key := auth.SubKey
+	if len(ep.Subkey.KeyValue) > 0 {
+		key = ep.Subkey
+	}
+	p, err := r.KRBPriv.DecryptEncPart(key)
+	if err != nil {
+		return err
+	}
+	if !p.SAddress.Equal(sAddress) {
+		return errors.New("KRB_PRIV sender address is not that of the kpasswd server")
+	}
+	if p.SequenceNumber != ep.SequenceNumber {
+		return fmt.Errorf("KRB_PRIV sequence number not as expected. Expected: %d; Actual: %d", ep.SequenceNumber, p.SequenceNumber)
+	}
+	if !p.Timestamp.IsZero() {
+		t := p.Timestamp.Add(time.Duration(p.Usec) * time.Microsecond)
+		if d := cfg.Now().Sub(t); d > cfg.LibDefaults.Clockskew || -d > cfg.LibDefaults.Clockskew {
+			return fmt.Errorf("KRB_PRIV timestamp is outside the clock skew of %v", cfg.LibDefaults.Clockskew)
+		}
+	}
+	return r.unmarshalResult(p.UserData)
+}
+
+// The result is a two byte result code followed by the result string.
+func (r *Reply) unmarshalResult(b []byte) error {
+	if len(b) < 2 {
+		return errors.New("kpasswd result is too short")
+	}
+	r.ResultCode = int(binary.BigEndian.Uint16(b[0:2]))
+	r.Result = string(b[2:])
+	return nil
+}
+
+func (r Reply) String() string {
+	t, ok := resultCodeText[r.ResultCode]
+	if !ok {
+		t = "unknown result code"
+	}
+	if r.Result == "" {
+		return fmt.Sprintf("kpasswd result %d (%s)", r.ResultCode, t)
+	}
+	return fmt.Sprintf("kpasswd result %d (%s): %s", r.ResultCode, t, r.Result)
+}
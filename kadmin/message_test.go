@@ -0,0 +1,217 @@
+package kadmin
+
+import (
+	"encoding/binary"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/msgtype"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+const testRealm = "TEST.GOKRB5"
+
+var testCName = types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"testuser1"}}
+
+func testTicket(t *testing.T) (types.Ticket, types.EncryptionKey) {
+	key, err := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	tkt := types.Ticket{
+		TktVNO: iana.PVNO,
+		Realm:  testRealm,
+		SName:  types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"kadmin", "changepw"}},
+		EncPart: types.EncryptedData{
+			EType:  etype.AES256_CTS_HMAC_SHA1_96,
+			Cipher: []byte("ticket"),
+		},
+	}
+	return tkt, key
+}
+
+func testAddress() types.HostAddress {
+	h, _ := types.NewHostAddressIPv4(net.ParseIP("10.80.88.88"))
+	return h
+}
+
+// Unmarshal a request as the kpasswd server would and get the user data.
+func testServerRequest(t *testing.T, b []byte, sessionKey types.EncryptionKey) (int, messages.APReq, []byte) {
+	assert.Equal(t, len(b), int(binary.BigEndian.Uint16(b[0:2])), "Message length not as expected")
+	v := int(binary.BigEndian.Uint16(b[2:4]))
+	al := int(binary.BigEndian.Uint16(b[4:6]))
+	var a messages.APReq
+	err := a.Unmarshal(b[6 : 6+al])
+	if err != nil {
+		t.Fatalf("Error unmarshalling AP_REQ: %v", err)
+	}
+	a.DecryptedTicket.Key = sessionKey
+	err = a.DecryptAuthenticator()
+	if err != nil {
+		t.Fatalf("Error decrypting authenticator: %v", err)
+	}
+	var p messages.KRBPriv
+	err = p.Unmarshal(b[6+al:])
+	if err != nil {
+		t.Fatalf("Error unmarshalling KRB_PRIV: %v", err)
+	}
+	ep, err := p.DecryptEncPart(a.DecryptedAuthenticator.SubKey)
+	if err != nil {
+		t.Fatalf("Error decrypting KRB_PRIV: %v", err)
+	}
+	assert.Equal(t, a.DecryptedAuthenticator.SeqNumber, ep.SequenceNumber, "Sequence number not as expected")
+	assert.Equal(t, testAddress(), ep.SAddress, "Sender address not as expected")
+	return v, a, ep.UserData
+}
+
+func TestChangePasswdMsg(t *testing.T) {
+	tkt, key := testTicket(t)
+	r, auth, err := ChangePasswdMsg(testCName, testRealm, "newpasswd", tkt, key, testAddress(), time.Now())
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	b, err := r.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling request: %v", err)
+	}
+	v, a, d := testServerRequest(t, b, key)
+	assert.Equal(t, VersionChangePasswd, v, "Version not as expected")
+	assert.Equal(t, auth.SubKey, a.DecryptedAuthenticator.SubKey, "Sub-session key not as expected")
+	assert.Equal(t, testCName.NameString, a.DecryptedAuthenticator.CName.NameString, "CName not as expected")
+	assert.Equal(t, []byte("newpasswd"), d, "New password not as expected")
+}
+
+func TestSetPasswdMsg(t *testing.T) {
+	tkt, key := testTicket(t)
+	target := types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"testuser2"}}
+	r, _, err := SetPasswdMsg(testCName, testRealm, target, testRealm, "newpasswd", tkt, key, testAddress(), time.Now())
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	b, err := r.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling request: %v", err)
+	}
+	v, _, d := testServerRequest(t, b, key)
+	assert.Equal(t, VersionSetPasswd, v, "Version not as expected")
+	var c ChangePasswdData
+	err = c.Unmarshal(d)
+	if err != nil {
+		t.Fatalf("Error unmarshalling ChangePasswdData: %v", err)
+	}
+	assert.Equal(t, []byte("newpasswd"), c.NewPasswd, "New password not as expected")
+	assert.Equal(t, target.NameString, c.TargName.NameString, "Target name not as expected")
+	assert.Equal(t, testRealm, c.TargRealm, "Target realm not as expected")
+}
+
+func testServerAddress() types.HostAddress {
+	h, _ := types.NewHostAddressIPv4(net.ParseIP("10.80.88.1"))
+	return h
+}
+
+// Create a reply as the kpasswd server would with the AP_REP and KRB_PRIV encrypted parts provided.
+func testReply(t *testing.T, sessionKey types.EncryptionKey, ep messages.EncAPRepPart, pp messages.EncKrbPrivPart) []byte {
+	epb, err := ep.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling AP_REP encrypted part: %v", err)
+	}
+	ed, err := crypto.GetEncryptedData(epb, sessionKey, keyusage.AP_REP_ENCPART, 0)
+	if err != nil {
+		t.Fatalf("Error encrypting AP_REP encrypted part: %v", err)
+	}
+	aprep := messages.APRep{PVNO: iana.PVNO, MsgType: msgtype.KRB_AP_REP, EncPart: ed}
+	ab, err := aprep.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling AP_REP: %v", err)
+	}
+	ppb, err := pp.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling KRB_PRIV encrypted part: %v", err)
+	}
+	ed, err = crypto.GetEncryptedData(ppb, ep.Subkey, keyusage.KRB_PRIV_ENCPART, 0)
+	if err != nil {
+		t.Fatalf("Error encrypting KRB_PRIV encrypted part: %v", err)
+	}
+	p := messages.KRBPriv{PVNO: iana.PVNO, MsgType: msgtype.KRB_PRIV, EncPart: ed}
+	pb, err := p.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling KRB_PRIV: %v", err)
+	}
+	b := make([]byte, 6)
+	binary.BigEndian.PutUint16(b[0:2], uint16(6+len(ab)+len(pb)))
+	binary.BigEndian.PutUint16(b[2:4], VersionChangePasswd)
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(ab)))
+	b = append(b, ab...)
+	b = append(b, pb...)
+	return b
+}
+
+func TestReply_Decrypt(t *testing.T) {
+	tkt, key := testTicket(t)
+	cfg := config.NewConfig()
+	_, auth, err := ChangePasswdMsg(testCName, testRealm, "newpasswd", tkt, key, testAddress(), time.Now())
+	if err != nil {
+		t.Fatalf("Error creating request: %v", err)
+	}
+	subKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	now := time.Now().UTC()
+	validAPRep := messages.EncAPRepPart{CTime: auth.CTime, Cusec: auth.Cusec, Subkey: subKey, SequenceNumber: 1}
+	validPriv := messages.EncKrbPrivPart{
+		UserData:       append([]byte{0, KRB5_KPASSWD_SOFTERROR}, []byte("Password too short")...),
+		Timestamp:      now,
+		SequenceNumber: 1,
+		SAddress:       testServerAddress(),
+	}
+
+	var r Reply
+	err = r.Unmarshal(testReply(t, key, validAPRep, validPriv))
+	if err != nil {
+		t.Fatalf("Error unmarshalling reply: %v", err)
+	}
+	// The server's sub-session key from the AP_REP must be used over the client's
+	err = r.Decrypt(key, auth, testServerAddress(), cfg)
+	if err != nil {
+		t.Fatalf("Error decrypting reply: %v", err)
+	}
+	assert.Equal(t, KRB5_KPASSWD_SOFTERROR, r.ResultCode, "Result code not as expected")
+	assert.Equal(t, "Password too short", r.Result, "Result string not as expected")
+	assert.Equal(t, "kpasswd result 4 (password change rejected): Password too short", r.String(), "Result text not as expected")
+
+	var tests = []struct {
+		name string
+		ep   func(*messages.EncAPRepPart)
+		pp   func(*messages.EncKrbPrivPart)
+	}{
+		{"AP_REP time", func(e *messages.EncAPRepPart) { e.CTime = e.CTime.Add(-time.Second) }, func(e *messages.EncKrbPrivPart) {}},
+		{"AP_REP usec", func(e *messages.EncAPRepPart) { e.Cusec++ }, func(e *messages.EncKrbPrivPart) {}},
+		{"sequence number", func(e *messages.EncAPRepPart) {}, func(e *messages.EncKrbPrivPart) { e.SequenceNumber = 2 }},
+		{"sender address", func(e *messages.EncAPRepPart) {}, func(e *messages.EncKrbPrivPart) { e.SAddress = testAddress() }},
+		{"timestamp", func(e *messages.EncAPRepPart) {}, func(e *messages.EncKrbPrivPart) { e.Timestamp = now.Add(-time.Hour) }},
+	}
+	for _, test := range tests {
+		ep, pp := validAPRep, validPriv
+		test.ep(&ep)
+		test.pp(&pp)
+		var r Reply
+		err = r.Unmarshal(testReply(t, key, ep, pp))
+		if err != nil {
+			t.Fatalf("Error unmarshalling reply: %v", err)
+		}
+		err = r.Decrypt(key, auth, testServerAddress(), cfg)
+		assert.Error(t, err, "Reply with invalid %s should not be accepted", test.name)
+	}
+}
+
+func TestReply_Unmarshal_badLength(t *testing.T) {
+	var r Reply
+	err := r.Unmarshal([]byte{0, 10, 0, 1, 0, 0})
+	assert.Error(t, err, "Reply with incorrect length should not be accepted")
+}
@@ -0,0 +1,91 @@
+// Client side of the Kerberos change and set password protocol.
+package kadmin
+
+import (
+	"fmt"
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"time"
+)
+
+// Reference: https://www.ietf.org/rfc/rfc3244.txt
+
+/*
+ChgPasswdData ::= SEQUENCE {
+	newpasswd[0]   OCTET STRING,
+	targname[1]    PrincipalName OPTIONAL,
+	targrealm[2]   Realm OPTIONAL
+}
+*/
+
+// Protocol version numbers.
+const (
+	// The new password is sent as the user data. Ref: RFC 3244 Section 1
+	VersionChangePasswd = 0x0001
+	// ChangePasswdData is sent as the user data, optionally targeting another principal.
+	VersionSetPasswd = 0xff80
+)
+
+type ChangePasswdData struct {
+	NewPasswd []byte              `asn1:"explicit,tag:0"`
+	TargName  types.PrincipalName `asn1:"explicit,optional,tag:1"`
+	TargRealm string              `asn1:"generalstring,optional,explicit,tag:2"`
+}
+
+func (c *ChangePasswdData) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*c)
+	if err != nil {
+		return b, fmt.Errorf("Error marshalling ChangePasswdData: %v", err)
+	}
+	return b, nil
+}
+
+func (c *ChangePasswdData) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, c)
+	return err
+}
+
+// Create a request to change the password of the client principal.
+// The ticket must be an initial ticket for kadmin/changepw. ctime is the client's current time, as given by the Config's
+// Now method, for the authenticator and KRB_PRIV. The authenticator sent is returned for validating and decrypting the
+// reply.
+func ChangePasswdMsg(cname types.PrincipalName, realm, newPasswd string, tkt types.Ticket, sessionKey types.EncryptionKey, sAddress types.HostAddress, ctime time.Time) (Request, types.Authenticator, error) {
+	return newRequest(VersionChangePasswd, []byte(newPasswd), cname, realm, tkt, sessionKey, sAddress, ctime)
+}
+
+// Create a request to set the password of the target principal.
+// The client principal must be authorised by the server to set the password of the target.
+func SetPasswdMsg(cname types.PrincipalName, realm string, target types.PrincipalName, targetRealm, newPasswd string, tkt types.Ticket, sessionKey types.EncryptionKey, sAddress types.HostAddress, ctime time.Time) (Request, types.Authenticator, error) {
+	d := ChangePasswdData{
+		NewPasswd: []byte(newPasswd),
+		TargName:  target,
+		TargRealm: targetRealm,
+	}
+	b, err := d.Marshal()
+	if err != nil {
+		return Request{}, types.Authenticator{}, err
+	}
+	return newRequest(VersionSetPasswd, b, cname, realm, tkt, sessionKey, sAddress, ctime)
+}
+
+func newRequest(version int, userData []byte, cname types.PrincipalName, realm string, tkt types.Ticket, sessionKey types.EncryptionKey, sAddress types.HostAddress, ctime time.Time) (Request, types.Authenticator, error) {
+	r := Request{Version: version}
+	auth := types.NewAuthenticator(realm, "")
+	auth.CName = cname
+	auth.SetTime(ctime)
+	err := messages.GenerateSubKeyAndSeqNumber(&auth, sessionKey.KeyType)
+	if err != nil {
+		return r, auth, err
+	}
+	r.APREQ, err = messages.NewAPReqWithKeyUsage(tkt, sessionKey, auth, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		return r, auth, err
+	}
+	r.KRBPriv, err = messages.NewKRBPriv(userData, auth.SeqNumber, sAddress, auth.SubKey, ctime)
+	if err != nil {
+		return r, auth, err
+	}
+	return r, auth, nil
+}
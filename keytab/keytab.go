@@ -45,15 +45,20 @@ func NewKeytab() Keytab {
 
 // Get the EncryptionKey from the Keytab for the newest entry with the required kvno, etype and matching principal.
 func (kt *Keytab) GetEncryptionKey(username, realm string, kvno, etype int) (types.EncryptionKey, error) {
+	cname, _ := types.ParsePrincipalName(username)
+	return kt.GetEncryptionKeyForPrincipal(cname, realm, kvno, etype)
+}
+
+// Get the key from the keytab for the principal name and realm specified. The principal's components must match
+// exactly. A kvno of 0 matches any version, in which case the most recent key is returned.
+func (kt *Keytab) GetEncryptionKeyForPrincipal(cname types.PrincipalName, realm string, kvno, etype int) (types.EncryptionKey, error) {
 	var key types.EncryptionKey
 	var t time.Time
 	for _, k := range kt.Entries {
-		if k.Principal.Realm == realm && int(k.Key.KeyType) == etype && (int(k.KVNO) == kvno || kvno == 0) && k.Timestamp.After(t) {
-			for _, n := range k.Principal.Components {
-				if n == username {
-					key = k.Key
-				}
-			}
+		if k.Principal.Realm == realm && cname.Equal(types.PrincipalName{NameString: k.Principal.Components}) &&
+			int(k.Key.KeyType) == etype && (int(k.KVNO) == kvno || kvno == 0) && k.Timestamp.After(t) {
+			key = k.Key
+			t = k.Timestamp
 		}
 	}
 	if len(key.KeyValue) < 1 {
@@ -3,6 +3,7 @@ package keytab
 import (
 	"encoding/hex"
 	"github.com/stretchr/testify/assert"
+	"strings"
 	"testing"
 	"time"
 )
@@ -27,3 +28,30 @@ func TestParse(t *testing.T) {
 	assert.Equal(t, "EXAMPLE.COM", kt.Entries[0].Principal.Realm, "Realm of principal not as expected")
 	assert.Equal(t, "user", kt.Entries[0].Principal.Components[0], "Component in principal not as expected")
 }
+
+func TestKeytab_GetEncryptionKeyForPrincipal(t *testing.T) {
+	kt := NewKeytab()
+	for _, c := range [][]string{{"user"}, {"user", "admin"}} {
+		e := newKeytabEntry()
+		e.Principal = Principal{NumComponents: int16(len(c)), Realm: "TEST.GOKRB5", Components: c, NameType: 1}
+		e.Timestamp = time.Now()
+		e.KVNO = 1
+		e.Key.KeyType = 18
+		e.Key.KeyValue = []byte(strings.Join(c, "/"))
+		kt.Entries = append(kt.Entries, e)
+	}
+	k, err := kt.GetEncryptionKey("user/admin", "TEST.GOKRB5", 1, 18)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, []byte("user/admin"), k.KeyValue, "Key for multi-component principal not as expected")
+	k, err = kt.GetEncryptionKey("user", "TEST.GOKRB5", 0, 18)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	assert.Equal(t, []byte("user"), k.KeyValue, "Key for single component principal not as expected")
+	_, err = kt.GetEncryptionKey("admin", "TEST.GOKRB5", 0, 18)
+	assert.Error(t, err, "Partial component match should not return a key")
+	_, err = kt.GetEncryptionKey("user", "OTHER.GOKRB5", 0, 18)
+	assert.Error(t, err, "Key from another realm should not be returned")
+}
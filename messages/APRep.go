@@ -3,7 +3,10 @@ package messages
 import (
 	"fmt"
 	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/asn1tools"
+	"github.com/jcmturner/gokrb5/crypto"
 	"github.com/jcmturner/gokrb5/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
 	"github.com/jcmturner/gokrb5/iana/msgtype"
 	"github.com/jcmturner/gokrb5/types"
 	"time"
@@ -56,3 +59,39 @@ func (a *EncAPRepPart) Unmarshal(b []byte) error {
 	}
 	return nil
 }
+
+// Decrypt the encrypted part of the AP_REP using the session key of the ticket sent in the AP_REQ.
+func (a *APRep) DecryptEncPart(sessionKey types.EncryptionKey) (EncAPRepPart, error) {
+	var e EncAPRepPart
+	etype, err := crypto.GetEtype(a.EncPart.EType)
+	if err != nil {
+		return e, fmt.Errorf("Error getting encryption type: %v", err)
+	}
+	b, err := crypto.DecryptEncPart(sessionKey.KeyValue, a.EncPart, etype, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return e, fmt.Errorf("Error decrypting AP_REP EncPart: %v", err)
+	}
+	err = e.Unmarshal(b)
+	if err != nil {
+		return e, fmt.Errorf("Error unmarshalling AP_REP encrypted part: %v", err)
+	}
+	return e, nil
+}
+
+func (a *APRep) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*a)
+	if err != nil {
+		return b, fmt.Errorf("Error marshalling AP_REP: %v", err)
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.APREP)
+	return b, nil
+}
+
+func (a *EncAPRepPart) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*a)
+	if err != nil {
+		return b, fmt.Errorf("Error marshalling AP_REP encrypted part: %v", err)
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncAPRepPart)
+	return b, nil
+}
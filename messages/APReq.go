@@ -1,6 +1,8 @@
 package messages
 
 import (
+	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/jcmturner/asn1"
@@ -11,6 +13,8 @@ import (
 	"github.com/jcmturner/gokrb5/crypto"
 	"github.com/jcmturner/gokrb5/asn1tools"
 	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/config"
+	"time"
 )
 
 /*AP-REQ          ::= [APPLICATION 14] SEQUENCE {
@@ -36,36 +40,200 @@ type marshalAPReq struct {
 }
 
 type APReq struct {
-	PVNO          int                 `asn1:"explicit,tag:0"`
-	MsgType       int                 `asn1:"explicit,tag:1"`
-	APOptions     asn1.BitString      `asn1:"explicit,tag:2"`
-	Ticket        types.Ticket        `asn1:"explicit,tag:3"`
-	Authenticator types.EncryptedData `asn1:"explicit,tag:4"`
+	PVNO                   int                 `asn1:"explicit,tag:0"`
+	MsgType                int                 `asn1:"explicit,tag:1"`
+	APOptions              asn1.BitString      `asn1:"explicit,tag:2"`
+	Ticket                 types.Ticket        `asn1:"explicit,tag:3"`
+	Authenticator          types.EncryptedData `asn1:"explicit,tag:4"`
+	DecryptedTicket        types.EncTicketPart
+	DecryptedAuthenticator types.Authenticator
 }
 
 func NewAPReq(TGT types.Ticket, sessionKey types.EncryptionKey, auth types.Authenticator) (APReq, error) {
+	return NewAPReqWithKeyUsage(TGT, sessionKey, auth, keyusage.TGS_REQ_PA_TGS_REQ_AP_REQ_AUTHENTICATOR)
+}
+
+// Create a new AP_REQ with the authenticator encrypted using the key usage provided.
+// An AP_REQ sent to an application service uses keyusage.AP_REQ_AUTHENTICATOR whereas one within the PA-TGS-REQ of a
+// TGS_REQ uses keyusage.TGS_REQ_PA_TGS_REQ_AP_REQ_AUTHENTICATOR, as NewAPReq does.
+func NewAPReqWithKeyUsage(tkt types.Ticket, sessionKey types.EncryptionKey, auth types.Authenticator, usage int) (APReq, error) {
 	var a APReq
-	ed, err := encryptAuthenticator(auth, sessionKey)
+	ed, err := encryptAuthenticatorWithKeyUsage(auth, sessionKey, usage)
 	if err != nil {
 		return a, fmt.Errorf("Error creating authenticator for AP_REQ: %v", err)
 	}
-	a = APReq{
+	return newAPReq(tkt, ed), nil
+}
+
+func newAPReq(tkt types.Ticket, ed types.EncryptedData) APReq {
+	return APReq{
 		PVNO:    iana.PVNO,
 		MsgType: msgtype.KRB_AP_REQ,
 		APOptions: types.NewKrbFlags(),
-		Ticket: TGT,
+		Ticket: tkt,
 		Authenticator: ed,
 	}
+}
+
+// Create a new AP_REQ for a user-to-user ticket.
+// The use-session-key AP option is set to tell the peer that the ticket is encrypted in the session key of its TGT.
+func NewUser2UserAPReq(tkt types.Ticket, sessionKey types.EncryptionKey, auth types.Authenticator) (APReq, error) {
+	a, err := NewAPReqWithKeyUsage(tkt, sessionKey, auth, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		return a, err
+	}
+	types.SetFlag(&a.APOptions, types.APOptionUseSessionKey)
 	return a, nil
 }
 
-func encryptAuthenticator(a types.Authenticator, sessionKey types.EncryptionKey) (types.EncryptedData, error) {
+// Generate a random sub-session key of the key type provided and a random initial sequence number in the
+// authenticator. The application protocol uses these in place of the ticket's session key and to order its messages.
+func GenerateSubKeyAndSeqNumber(auth *types.Authenticator, keyType int) error {
+	subKey, err := crypto.GenerateKey(keyType)
+	if err != nil {
+		return fmt.Errorf("Error generating sub-session key: %v", err)
+	}
+	auth.SubKey = subKey
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("Error generating sequence number: %v", err)
+	}
+	// Some implementations treat the sequence number as signed so the top bits are left clear
+	auth.SeqNumber = int(binary.BigEndian.Uint32(b) & 0x3fffffff)
+	return nil
+}
+
+// Get the key negotiated by an AP exchange for use by the application protocol.
+// This is the acceptor's sub-session key from the AP_REP if there is one, otherwise the initiator's sub-session key
+// from the authenticator, falling back to the session key of the ticket. apRep is nil if there was no AP_REP.
+func NegotiatedKey(sessionKey types.EncryptionKey, auth types.Authenticator, apRep *EncAPRepPart) types.EncryptionKey {
+	if apRep != nil && len(apRep.Subkey.KeyValue) > 0 {
+		return apRep.Subkey
+	}
+	if len(auth.SubKey.KeyValue) > 0 {
+		return auth.SubKey
+	}
+	return sessionKey
+}
+
+// Get the key negotiated by the AP_REQ once its ticket and authenticator have been decrypted.
+// This is the initiator's sub-session key if present, otherwise the session key of the ticket. If the acceptor
+// replies with its own sub-session key in an AP_REP that key is used instead.
+func (a *APReq) NegotiatedKey() types.EncryptionKey {
+	return NegotiatedKey(a.DecryptedTicket.Key, a.DecryptedAuthenticator, nil)
+}
+
+func encryptAuthenticatorWithKeyUsage(a types.Authenticator, sessionKey types.EncryptionKey, usage int) (types.EncryptedData, error) {
 	var ed types.EncryptedData
 	m, err := a.Marshal()
 	if err != nil {
 		return ed, fmt.Errorf("Error marshalling authenticator: %v", err)
 	}
-	return crypto.GetEncryptedData(m, sessionKey, keyusage.TGS_REQ_PA_TGS_REQ_AP_REQ_AUTHENTICATOR, 0)
+	return crypto.GetEncryptedData(m, sessionKey, usage, 0)
+}
+
+// Decrypt the encrypted part of the ticket within the AP_REQ using the key provided.
+// For tickets issued to a service this is the service's long term key. For user-to-user tickets this is the
+// session key of the acceptor's own TGT.
+func (a *APReq) DecryptTicket(key types.EncryptionKey) error {
+	etype, err := crypto.GetEtype(a.Ticket.EncPart.EType)
+	if err != nil {
+		return fmt.Errorf("Error getting etype to decrypt ticket: %v", err)
+	}
+	if key.KeyType != a.Ticket.EncPart.EType {
+		return fmt.Errorf("Key type of key provided does not match the ticket's encrypted part. Expected: %v; Actual: %v", a.Ticket.EncPart.EType, key.KeyType)
+	}
+	b, err := crypto.DecryptEncPart(key.KeyValue, a.Ticket.EncPart, etype, keyusage.KDC_REP_TICKET)
+	if err != nil {
+		return fmt.Errorf("Error decrypting ticket encrypted part: %v", err)
+	}
+	var denc types.EncTicketPart
+	err = denc.Unmarshal(b)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling ticket encrypted part: %v", err)
+	}
+	a.DecryptedTicket = denc
+	return nil
+}
+
+// Decrypt the authenticator of an AP_REQ sent to an application service using the session key from the ticket.
+// The ticket must be decrypted first.
+func (a *APReq) DecryptAuthenticator() error {
+	sessionKey := a.DecryptedTicket.Key
+	if len(sessionKey.KeyValue) < 1 {
+		return errors.New("Ticket must be decrypted before the authenticator")
+	}
+	etype, err := crypto.GetEtype(sessionKey.KeyType)
+	if err != nil {
+		return fmt.Errorf("Error getting etype to decrypt authenticator: %v", err)
+	}
+	b, err := crypto.DecryptEncPart(sessionKey.KeyValue, a.Authenticator, etype, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		return fmt.Errorf("Error decrypting authenticator: %v", err)
+	}
+	var auth types.Authenticator
+	err = auth.Unmarshal(b)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling authenticator: %v", err)
+	}
+	a.DecryptedAuthenticator = auth
+	return nil
+}
+
+// Validate the AP_REQ once its ticket and authenticator have been decrypted.
+// As the address the AP_REQ was received from is not known a ticket restricted to a list of addresses is not valid.
+// Use IsValidFromAddress to validate such tickets.
+func (a *APReq) IsValid(cfg *config.Config) (bool, error) {
+	if len(a.DecryptedTicket.CAddr) > 0 {
+		return false, errors.New("Ticket is restricted to client addresses but the address the AP_REQ was received from is not known")
+	}
+	return a.isValid(cfg, types.HostAddress{})
+}
+
+// Validate the AP_REQ once its ticket and authenticator have been decrypted.
+// cAddr is the address the AP_REQ was received from. If the ticket is restricted to a list of addresses this must be
+// one of them.
+func (a *APReq) IsValidFromAddress(cfg *config.Config, cAddr types.HostAddress) (bool, error) {
+	return a.isValid(cfg, cAddr)
+}
+
+func (a *APReq) isValid(cfg *config.Config, cAddr types.HostAddress) (bool, error) {
+	//Ref RFC 4120 Section 3.2.3
+	if a.DecryptedAuthenticator.CRealm != a.DecryptedTicket.CRealm {
+		return false, fmt.Errorf("CRealm in authenticator does not match ticket. Ticket: %s; Authenticator: %s", a.DecryptedTicket.CRealm, a.DecryptedAuthenticator.CRealm)
+	}
+	if len(a.DecryptedAuthenticator.CName.NameString) != len(a.DecryptedTicket.CName.NameString) {
+		return false, fmt.Errorf("CName in authenticator does not match ticket. Ticket: %+v; Authenticator: %+v", a.DecryptedTicket.CName, a.DecryptedAuthenticator.CName)
+	}
+	for i := range a.DecryptedTicket.CName.NameString {
+		if a.DecryptedAuthenticator.CName.NameString[i] != a.DecryptedTicket.CName.NameString[i] {
+			return false, fmt.Errorf("CName in authenticator does not match ticket. Ticket: %+v; Authenticator: %+v", a.DecryptedTicket.CName, a.DecryptedAuthenticator.CName)
+		}
+	}
+	if time.Since(a.DecryptedAuthenticator.CTime) > cfg.LibDefaults.Clockskew || time.Until(a.DecryptedAuthenticator.CTime) > cfg.LibDefaults.Clockskew {
+		return false, fmt.Errorf("Clock skew with client too large. Greater than %v seconds", cfg.LibDefaults.Clockskew.Seconds())
+	}
+	startTime := a.DecryptedTicket.StartTime
+	if startTime.IsZero() {
+		startTime = a.DecryptedTicket.AuthTime
+	}
+	if time.Until(startTime) > cfg.LibDefaults.Clockskew || types.IsFlagSet(&a.DecryptedTicket.Flags, types.Invalid) {
+		return false, errors.New("Ticket is not yet valid")
+	}
+	if time.Since(a.DecryptedTicket.EndTime) > cfg.LibDefaults.Clockskew {
+		return false, errors.New("Ticket has expired")
+	}
+	if len(a.DecryptedTicket.CAddr) > 0 && !types.HostAddressesContains(a.DecryptedTicket.CAddr, cAddr) {
+		return false, errors.New("Client address is not within the list contained in the ticket")
+	}
+	return true, nil
+}
+
+// Whether the ticket of the AP_REQ is a proxy ticket. This can only be determined once the ticket is decrypted.
+// A proxy ticket is presented by a party other than the client named in it, so the acceptor may wish to restrict what
+// it is used for. Ref: RFC 4120 Section 2.5
+func (a *APReq) IsProxy() bool {
+	return types.IsFlagSet(&a.DecryptedTicket.Flags, types.Proxy)
 }
 
 func (a *APReq) Unmarshal(b []byte) error {
@@ -2,10 +2,16 @@ package messages
 
 import (
 	"encoding/hex"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
 	"github.com/jcmturner/gokrb5/iana/msgtype"
 	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
 	"github.com/stretchr/testify/assert"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestUnmarshalAPReq(t *testing.T) {
@@ -48,4 +54,47 @@ func TestMarshalAPReq(t *testing.T) {
 		t.Fatalf("Marshal of ticket errored: %v", err)
 	}
 	assert.Equal(t, b, mb, "Marshal bytes of Authenticator not as expected")
-}
\ No newline at end of file
+}
+func TestNegotiatedKey(t *testing.T) {
+	sessionKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	auth := types.NewAuthenticator(testdata.TEST_REALM, "testuser1")
+	assert.Equal(t, sessionKey, NegotiatedKey(sessionKey, auth, nil), "Session key should be used without a sub-session key")
+	err := GenerateSubKeyAndSeqNumber(&auth, sessionKey.KeyType)
+	if err != nil {
+		t.Fatalf("Error generating sub-session key: %v", err)
+	}
+	assert.Equal(t, sessionKey.KeyType, auth.SubKey.KeyType, "Sub-session key type not as expected")
+	assert.NotEqual(t, sessionKey.KeyValue, auth.SubKey.KeyValue, "Sub-session key should differ from the session key")
+	assert.Equal(t, auth.SubKey, NegotiatedKey(sessionKey, auth, nil), "Initiator's sub-session key not used")
+	acceptorKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	rep := EncAPRepPart{Subkey: acceptorKey}
+	assert.Equal(t, acceptorKey, NegotiatedKey(sessionKey, auth, &rep), "Acceptor's sub-session key not used")
+}
+
+func TestAPReq_IsValid_addresses(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	now := time.Now().UTC()
+	auth := types.NewAuthenticator(testdata.TEST_REALM, "testuser1")
+	a := APReq{
+		DecryptedTicket: types.EncTicketPart{
+			Flags:    types.NewKrbFlags(),
+			CRealm:   testdata.TEST_REALM,
+			CName:    auth.CName,
+			AuthTime: now,
+			EndTime:  now.Add(time.Hour),
+		},
+		DecryptedAuthenticator: auth,
+	}
+	ok, err := a.IsValid(c)
+	assert.True(t, ok, "AP_REQ with an addressless ticket should be valid: %v", err)
+
+	addr, _ := types.NewHostAddressIPv4(net.ParseIP("10.80.88.88"))
+	other, _ := types.NewHostAddressIPv4(net.ParseIP("10.80.88.89"))
+	a.DecryptedTicket.CAddr = types.HostAddresses{addr}
+	ok, err = a.IsValid(c)
+	assert.False(t, ok, "AP_REQ with an address restricted ticket should not be valid without the client address")
+	ok, err = a.IsValidFromAddress(c, addr)
+	assert.True(t, ok, "AP_REQ from an address in the ticket should be valid: %v", err)
+	ok, _ = a.IsValidFromAddress(c, other)
+	assert.False(t, ok, "AP_REQ from an address not in the ticket should not be valid")
+}
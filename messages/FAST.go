@@ -0,0 +1,427 @@
+package messages
+
+// Reference: https://www.ietf.org/rfc/rfc6113.txt
+// Section: 5.4
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/types"
+	"time"
+)
+
+const (
+	// Armor types
+	FX_FAST_ARMOR_AP_REQUEST = 1
+	// FAST options
+	FASTOptionReserved           = 0
+	FASTOptionHideClientNames    = 1
+	FASTOptionKDCFollowReferrals = 16
+)
+
+/*
+	KrbFastArmor ::= SEQUENCE {
+		armor-type   [0] Int32,
+		armor-value  [1] OCTET STRING,
+		...
+	}
+*/
+type KrbFastArmor struct {
+	ArmorType  int    `asn1:"explicit,tag:0"`
+	ArmorValue []byte `asn1:"explicit,tag:1"`
+}
+
+/*
+	PA-FX-FAST-REQUEST ::= CHOICE {
+		armored-data [0] KrbFastArmoredReq,
+		...
+	}
+
+	KrbFastArmoredReq ::= SEQUENCE {
+		armor        [0] KrbFastArmor OPTIONAL,
+		req-checksum [1] Checksum,
+		enc-fast-req [2] EncryptedData, -- KrbFastReq --
+		...
+	}
+*/
+type KrbFastArmoredReq struct {
+	Armor       KrbFastArmor        `asn1:"explicit,optional,tag:0"`
+	ReqChecksum types.Checksum      `asn1:"explicit,tag:1"`
+	EncFastReq  types.EncryptedData `asn1:"explicit,tag:2"`
+}
+
+/*
+	KrbFastReq ::= SEQUENCE {
+		fast-options [0] FastOptions,
+		padata       [1] SEQUENCE OF PA-DATA,
+		req-body     [2] KDC-REQ-BODY,
+		...
+	}
+*/
+type marshalKrbFastReq struct {
+	FastOptions asn1.BitString       `asn1:"explicit,tag:0"`
+	PAData      types.PADataSequence `asn1:"explicit,tag:1"`
+	ReqBody     asn1.RawValue        `asn1:"explicit,tag:2"`
+}
+
+type KrbFastReq struct {
+	FastOptions asn1.BitString
+	PAData      types.PADataSequence
+	ReqBody     KDCReqBody
+}
+
+/*
+	PA-FX-FAST-REPLY ::= CHOICE {
+		armored-data [0] KrbFastArmoredRep,
+		...
+	}
+
+	KrbFastArmoredRep ::= SEQUENCE {
+		enc-fast-rep      [0] EncryptedData, -- KrbFastResponse --
+		...
+	}
+*/
+type KrbFastArmoredRep struct {
+	EncFastRep types.EncryptedData `asn1:"explicit,tag:0"`
+}
+
+/*
+	KrbFastResponse ::= SEQUENCE {
+		padata         [0] SEQUENCE OF PA-DATA,
+		strengthen-key [1] EncryptionKey OPTIONAL,
+		finished       [2] KrbFastFinished OPTIONAL,
+		nonce          [3] UInt32,
+		...
+	}
+*/
+type KrbFastResponse struct {
+	PAData        types.PADataSequence `asn1:"explicit,tag:0"`
+	StrengthenKey types.EncryptionKey  `asn1:"explicit,optional,tag:1"`
+	Finished      KrbFastFinished      `asn1:"explicit,optional,tag:2"`
+	Nonce         int                  `asn1:"explicit,tag:3"`
+}
+
+/*
+	KrbFastFinished ::= SEQUENCE {
+		timestamp       [0] KerberosTime,
+		usec            [1] Microseconds,
+		crealm          [2] Realm,
+		cname           [3] PrincipalName,
+		ticket-checksum [4] Checksum,
+		...
+	}
+*/
+type KrbFastFinished struct {
+	Timestamp      time.Time           `asn1:"generalized,explicit,tag:0"`
+	Usec           int                 `asn1:"explicit,tag:1"`
+	CRealm         string              `asn1:"generalstring,explicit,tag:2"`
+	CName          types.PrincipalName `asn1:"explicit,tag:3"`
+	TicketChecksum types.Checksum      `asn1:"explicit,tag:4"`
+}
+
+// FAST armor used to protect a KDC exchange.
+// The armor is empty when implicit TGS armor is used.
+type FASTArmor struct {
+	Key   types.EncryptionKey
+	Armor KrbFastArmor
+}
+
+// Create explicit FAST armor from an armor TGT, for example the TGT of the host obtained using its keytab.
+// A random sub-session key is carried in the authenticator of the armor AP_REQ and the armor key is derived from
+// this sub-session key and the session key of the armor TGT. The client's time in the authenticator is set to ctime.
+func NewFASTArmor(tkt types.Ticket, sessionKey types.EncryptionKey, crealm string, cname types.PrincipalName, ctime time.Time) (FASTArmor, error) {
+	var f FASTArmor
+	subKey, err := crypto.GenerateKey(sessionKey.KeyType)
+	if err != nil {
+		return f, fmt.Errorf("Error generating sub-session key for FAST armor: %v", err)
+	}
+	auth := types.NewAuthenticator(crealm, "")
+	auth.CName = cname
+	auth.SubKey = subKey
+	auth.SetTime(ctime)
+	ed, err := encryptAuthenticatorWithKeyUsage(auth, sessionKey, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		return f, fmt.Errorf("Error creating authenticator for FAST armor: %v", err)
+	}
+	apReq := newAPReq(tkt, ed)
+	b, err := apReq.Marshal()
+	if err != nil {
+		return f, fmt.Errorf("Error marshalling FAST armor AP_REQ: %v", err)
+	}
+	f.Key, err = fastArmorKey(subKey, sessionKey)
+	if err != nil {
+		return f, err
+	}
+	f.Armor = KrbFastArmor{
+		ArmorType:  FX_FAST_ARMOR_AP_REQUEST,
+		ArmorValue: b,
+	}
+	return f, nil
+}
+
+// Create implicit TGS FAST armor (RFC 6113 section 5.4.1.1).
+// The armor key is derived from the sub-session key in the authenticator of the PA-TGS-REQ and the session key of the TGT.
+func NewImplicitFASTArmor(subKey, sessionKey types.EncryptionKey) (FASTArmor, error) {
+	var f FASTArmor
+	k, err := fastArmorKey(subKey, sessionKey)
+	if err != nil {
+		return f, err
+	}
+	f.Key = k
+	return f, nil
+}
+
+func fastArmorKey(subKey, sessionKey types.EncryptionKey) (types.EncryptionKey, error) {
+	k, err := crypto.KRBFXCF2(subKey, sessionKey, "subkeyarmor", "ticketarmor")
+	if err != nil {
+		return k, fmt.Errorf("Error deriving FAST armor key: %v", err)
+	}
+	return k, nil
+}
+
+// Create the PA-FX-FAST padata that carries the inner request.
+// The request checksum is calculated over the bytes provided.
+func (f *FASTArmor) armoredPAData(pas types.PADataSequence, reqBody KDCReqBody, chksumData []byte) (types.PAData, error) {
+	var pa types.PAData
+	etype, err := crypto.GetEtype(f.Key.KeyType)
+	if err != nil {
+		return pa, fmt.Errorf("Error getting etype of FAST armor key: %v", err)
+	}
+	fr := KrbFastReq{
+		FastOptions: types.NewKrbFlags(),
+		PAData:      pas,
+		ReqBody:     reqBody,
+	}
+	b, err := fr.Marshal()
+	if err != nil {
+		return pa, err
+	}
+	ed, err := crypto.GetEncryptedData(b, f.Key, keyusage.KEY_USAGE_FAST_ENC, 0)
+	if err != nil {
+		return pa, fmt.Errorf("Error encrypting FAST request: %v", err)
+	}
+	cb, err := crypto.GetChecksumHash(chksumData, f.Key.KeyValue, keyusage.KEY_USAGE_FAST_REQ_CHKSUM, etype)
+	if err != nil {
+		return pa, fmt.Errorf("Error calculating FAST request checksum: %v", err)
+	}
+	ar := KrbFastArmoredReq{
+		Armor: f.Armor,
+		ReqChecksum: types.Checksum{
+			CksumType: etype.GetHashID(),
+			Checksum:  cb,
+		},
+		EncFastReq: ed,
+	}
+	ab, err := asn1.Marshal(ar)
+	if err != nil {
+		return pa, fmt.Errorf("Error marshalling KrbFastArmoredReq: %v", err)
+	}
+	// PA-FX-FAST-REQUEST is a CHOICE so the armored request is wrapped in its context tag
+	cb, err = asn1.Marshal(asn1.RawValue{
+		Class:      2,
+		IsCompound: true,
+		Tag:        0,
+		Bytes:      ab,
+	})
+	if err != nil {
+		return pa, fmt.Errorf("Error marshalling PA-FX-FAST-REQUEST: %v", err)
+	}
+	pa = types.PAData{
+		PADataType:  patype.PA_FX_FAST,
+		PADataValue: cb,
+	}
+	return pa, nil
+}
+
+// Decrypt the KrbFastResponse from the PA-FX-FAST in the padata provided.
+// An error is returned if the padata does not contain a FAST response so that an unprotected response is not accepted.
+func (f *FASTArmor) decryptResponse(pas types.PADataSequence, nonce int) (KrbFastResponse, error) {
+	var r KrbFastResponse
+	var v []byte
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_FX_FAST {
+			v = pa.PADataValue
+			break
+		}
+	}
+	if len(v) < 1 {
+		return r, errors.New("KDC response is not FAST protected")
+	}
+	var rep KrbFastArmoredRep
+	_, err := asn1.UnmarshalWithParams(v, &rep, "explicit,tag:0")
+	if err != nil {
+		return r, fmt.Errorf("Error unmarshalling PA-FX-FAST-REPLY: %v", err)
+	}
+	if rep.EncFastRep.EType != f.Key.KeyType {
+		return r, fmt.Errorf("FAST response is not encrypted with the armor key type. Expected: %v; Actual: %v", f.Key.KeyType, rep.EncFastRep.EType)
+	}
+	etype, err := crypto.GetEtype(f.Key.KeyType)
+	if err != nil {
+		return r, fmt.Errorf("Error getting etype of FAST armor key: %v", err)
+	}
+	b, err := crypto.DecryptEncPart(f.Key.KeyValue, rep.EncFastRep, etype, keyusage.KEY_USAGE_FAST_REP)
+	if err != nil {
+		return r, fmt.Errorf("Error decrypting FAST response: %v", err)
+	}
+	err = r.Unmarshal(b)
+	if err != nil {
+		return r, fmt.Errorf("Error unmarshalling FAST response: %v", err)
+	}
+	if r.Nonce != nonce {
+		return r, errors.New("Possible replay attack, nonce in FAST response does not match that in request")
+	}
+	return r, nil
+}
+
+// Create the PA-ENCRYPTED-CHALLENGE padata for an AS_REQ armored with this armor.
+// The time provided is encrypted in the client challenge key derived from the armor key and the reply key.
+// Ref: RFC 6113 Section 5.4.6
+func (f *FASTArmor) EncryptedChallengePAData(replyKey types.EncryptionKey, t time.Time) (types.PAData, error) {
+	var pa types.PAData
+	k, err := crypto.KRBFXCF2(f.Key, replyKey, "clientchallengearmor", "challengelongterm")
+	if err != nil {
+		return pa, fmt.Errorf("Error deriving client challenge key: %v", err)
+	}
+	b, err := types.GetPAEncTSEncAsnMarshalledAt(t)
+	if err != nil {
+		return pa, err
+	}
+	ed, err := crypto.GetEncryptedData(b, k, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT, 0)
+	if err != nil {
+		return pa, fmt.Errorf("Error encrypting client challenge: %v", err)
+	}
+	b, err = ed.Marshal()
+	if err != nil {
+		return pa, err
+	}
+	pa = types.PAData{
+		PADataType:  patype.PA_ENCRYPTED_CHALLENGE,
+		PADataValue: b,
+	}
+	return pa, nil
+}
+
+// Verify the KDC's PA-ENCRYPTED-CHALLENGE in the padata of the FAST response.
+// The KDC proves knowledge of the reply key by encrypting the current time in the KDC challenge key.
+// This must be within the clock skew of the time now.
+func (f *FASTArmor) verifyKDCChallenge(pas types.PADataSequence, replyKey types.EncryptionKey, now time.Time, clockSkew time.Duration) error {
+	var v []byte
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_ENCRYPTED_CHALLENGE {
+			v = pa.PADataValue
+		}
+	}
+	if len(v) < 1 {
+		return errors.New("KDC reply does not contain the KDC's encrypted challenge")
+	}
+	var ed types.EncryptedData
+	err := ed.Unmarshal(v)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling KDC's encrypted challenge: %v", err)
+	}
+	k, err := crypto.KRBFXCF2(f.Key, replyKey, "kdcchallengearmor", "challengelongterm")
+	if err != nil {
+		return fmt.Errorf("Error deriving KDC challenge key: %v", err)
+	}
+	etype, err := crypto.GetEtype(k.KeyType)
+	if err != nil {
+		return fmt.Errorf("Error getting etype of KDC challenge key: %v", err)
+	}
+	b, err := crypto.DecryptEncPart(k.KeyValue, ed, etype, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC)
+	if err != nil {
+		return fmt.Errorf("Error decrypting KDC's encrypted challenge: %v", err)
+	}
+	var ts types.PAEncTSEnc
+	err = ts.Unmarshal(b)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling KDC's encrypted challenge: %v", err)
+	}
+	if now.Sub(ts.PATimestamp) > clockSkew || ts.PATimestamp.Sub(now) > clockSkew {
+		return fmt.Errorf("Clock skew with KDC's encrypted challenge too large. Greater than %v seconds", clockSkew.Seconds())
+	}
+	return nil
+}
+
+// Strengthen the reply key with the strengthen key from the FAST response.
+// If the KDC did not provide a strengthen key the reply key is returned unchanged.
+func (r *KrbFastResponse) StrengthenReplyKey(key types.EncryptionKey) (types.EncryptionKey, error) {
+	if len(r.StrengthenKey.KeyValue) < 1 {
+		return key, nil
+	}
+	k, err := crypto.KRBFXCF2(r.StrengthenKey, key, "strengthenkey", "replykey")
+	if err != nil {
+		return k, fmt.Errorf("Error applying FAST strengthen key to reply key: %v", err)
+	}
+	return k, nil
+}
+
+// Verify the finished field of the FAST response for the ticket issued.
+// The ticket checksum is keyed with the armor key.
+func (r *KrbFastResponse) verifyFinished(f FASTArmor, tkt types.Ticket) error {
+	if len(r.Finished.TicketChecksum.Checksum) < 1 {
+		return errors.New("KDC FAST response does not contain the finished field")
+	}
+	etype, err := crypto.GetEtype(f.Key.KeyType)
+	if err != nil {
+		return fmt.Errorf("Error getting etype of FAST armor key: %v", err)
+	}
+	if r.Finished.TicketChecksum.CksumType != etype.GetHashID() {
+		return fmt.Errorf("FAST finished ticket checksum type not as expected. Expected: %v; Actual: %v", etype.GetHashID(), r.Finished.TicketChecksum.CksumType)
+	}
+	b, err := tkt.Marshal()
+	if err != nil {
+		return fmt.Errorf("Error marshalling ticket to verify FAST finished checksum: %v", err)
+	}
+	if !crypto.VerifyChecksum(f.Key.KeyValue, r.Finished.TicketChecksum.Checksum, b, keyusage.KEY_USAGE_FAST_FINISHED, etype) {
+		return errors.New("FAST finished ticket checksum invalid")
+	}
+	return nil
+}
+
+func (k *KrbFastReq) Marshal() ([]byte, error) {
+	m := marshalKrbFastReq{
+		FastOptions: k.FastOptions,
+		PAData:      k.PAData,
+	}
+	b, err := k.ReqBody.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling FAST request body: %v", err)
+	}
+	m.ReqBody = asn1.RawValue{
+		Class:      2,
+		IsCompound: true,
+		Tag:        2,
+		Bytes:      b,
+	}
+	mk, err := asn1.Marshal(m)
+	if err != nil {
+		return mk, fmt.Errorf("Error marshalling KrbFastReq: %v", err)
+	}
+	return mk, nil
+}
+
+func (k *KrbFastReq) Unmarshal(b []byte) error {
+	var m marshalKrbFastReq
+	_, err := asn1.Unmarshal(b, &m)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling KrbFastReq: %v", err)
+	}
+	var reqb KDCReqBody
+	err = reqb.Unmarshal(m.ReqBody.Bytes)
+	if err != nil {
+		return fmt.Errorf("Error processing FAST request body: %v", err)
+	}
+	k.FastOptions = m.FastOptions
+	k.PAData = m.PAData
+	k.ReqBody = reqb
+	return nil
+}
+
+func (k *KrbFastResponse) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, k)
+	return err
+}
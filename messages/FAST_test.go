@@ -0,0 +1,270 @@
+package messages
+
+import (
+	"encoding/hex"
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/asn1tools"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/credentials"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/keytab"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Create a FAST armored AS_REQ and process it as a KDC would, returning the armor key derived by the KDC.
+func testFASTArmoredASReq(t *testing.T) (ASReq, types.PADataSequence, types.EncryptionKey) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	a := NewASReq(c, "testuser1")
+	inner := a.PAData
+	b, _ := hex.DecodeString(testdata.TestVectors["encode_krb5_ticket"])
+	armorTkt, err := types.UnmarshalTicket(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling armor ticket: %v", err)
+	}
+	armorSessionKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	hostName := types.PrincipalName{NameType: nametype.KRB_NT_SRV_HST, NameString: []string{"host", "client.test.gokrb5"}}
+	armor, err := NewFASTArmor(armorTkt, armorSessionKey, "TEST.GOKRB5", hostName, time.Now())
+	if err != nil {
+		t.Fatalf("Error creating FAST armor: %v", err)
+	}
+	err = a.ArmorWithFAST(armor)
+	if err != nil {
+		t.Fatalf("Error armoring AS_REQ: %v", err)
+	}
+	b, err = a.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling armored AS_REQ: %v", err)
+	}
+
+	// Process the request as the KDC
+	var kdcReq ASReq
+	err = kdcReq.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling armored AS_REQ: %v", err)
+	}
+	assert.Equal(t, 1, len(kdcReq.PAData), "Number of outer padata not as expected")
+	assert.Equal(t, patype.PA_FX_FAST, kdcReq.PAData[0].PADataType, "Outer padata type not as expected")
+	var ar KrbFastArmoredReq
+	_, err = asn1.UnmarshalWithParams(kdcReq.PAData[0].PADataValue, &ar, "explicit,tag:0")
+	if err != nil {
+		t.Fatalf("Error unmarshalling KrbFastArmoredReq: %v", err)
+	}
+	assert.Equal(t, FX_FAST_ARMOR_AP_REQUEST, ar.Armor.ArmorType, "Armor type not as expected")
+	var apReq APReq
+	err = apReq.Unmarshal(ar.Armor.ArmorValue)
+	if err != nil {
+		t.Fatalf("Error unmarshalling armor AP_REQ: %v", err)
+	}
+	et, _ := crypto.GetEtype(etype.AES256_CTS_HMAC_SHA1_96)
+	ab, err := crypto.DecryptEncPart(armorSessionKey.KeyValue, apReq.Authenticator, et, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		t.Fatalf("Error decrypting armor authenticator: %v", err)
+	}
+	var auth types.Authenticator
+	err = auth.Unmarshal(ab)
+	if err != nil {
+		t.Fatalf("Error unmarshalling armor authenticator: %v", err)
+	}
+	assert.Equal(t, hostName.NameString, auth.CName.NameString, "Armor authenticator CName not as expected")
+	armorKey, err := crypto.KRBFXCF2(auth.SubKey, armorSessionKey, "subkeyarmor", "ticketarmor")
+	if err != nil {
+		t.Fatalf("Error deriving armor key: %v", err)
+	}
+	assert.Equal(t, armorKey, armor.Key, "Armor key not as expected")
+	bb, _ := kdcReq.ReqBody.Marshal()
+	assert.True(t, crypto.VerifyChecksum(armorKey.KeyValue, ar.ReqChecksum.Checksum, bb, keyusage.KEY_USAGE_FAST_REQ_CHKSUM, et), "FAST request checksum not valid")
+	fb, err := crypto.DecryptEncPart(armorKey.KeyValue, ar.EncFastReq, et, keyusage.KEY_USAGE_FAST_ENC)
+	if err != nil {
+		t.Fatalf("Error decrypting KrbFastReq: %v", err)
+	}
+	var fr KrbFastReq
+	err = fr.Unmarshal(fb)
+	if err != nil {
+		t.Fatalf("Error unmarshalling KrbFastReq: %v", err)
+	}
+	assert.Equal(t, len(inner), len(fr.PAData), "Number of inner padata not as expected")
+	assert.True(t, fr.PAData.Contains(patype.PA_REQ_ENC_PA_REP), "Inner padata does not contain PA-REQ-ENC-PA-REP")
+	assert.Equal(t, a.ReqBody.Nonce, fr.ReqBody.Nonce, "Inner request body nonce not as expected")
+	return a, inner, armorKey
+}
+
+// Create a FAST reply padata as a KDC would.
+func testFASTReplyPAData(t *testing.T, armorKey types.EncryptionKey, r KrbFastResponse) types.PAData {
+	rb, err := asn1.Marshal(r)
+	if err != nil {
+		t.Fatalf("Error marshalling KrbFastResponse: %v", err)
+	}
+	ed, err := crypto.GetEncryptedData(rb, armorKey, keyusage.KEY_USAGE_FAST_REP, 0)
+	if err != nil {
+		t.Fatalf("Error encrypting KrbFastResponse: %v", err)
+	}
+	b, _ := asn1.Marshal(KrbFastArmoredRep{EncFastRep: ed})
+	b, _ = asn1.Marshal(asn1.RawValue{Class: 2, IsCompound: true, Tag: 0, Bytes: b})
+	return types.PAData{
+		PADataType:  patype.PA_FX_FAST,
+		PADataValue: b,
+	}
+}
+
+func testFASTASRep(t *testing.T, a ASReq, armorKey types.EncryptionKey, tamper bool) (ASRep, *credentials.Credentials, types.EncryptionKey) {
+	b, _ := hex.DecodeString(testdata.TEST_AS_REP)
+	var asRep ASRep
+	err := asRep.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling AS_REP: %v", err)
+	}
+	kb, _ := hex.DecodeString(testdata.TESTUSER1_KEYTAB)
+	kt, _ := keytab.Parse(kb)
+	creds := credentials.NewCredentials("testuser1", "TEST.GOKRB5")
+	creds.WithKeytab(kt)
+	replyKey, err := kt.GetEncryptionKey("testuser1", "TEST.GOKRB5", 1, etype.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key from keytab: %v", err)
+	}
+	et, _ := crypto.GetEtype(etype.AES256_CTS_HMAC_SHA1_96)
+	tb, _ := asRep.Ticket.Marshal()
+	cb, _ := crypto.GetChecksumHash(tb, armorKey.KeyValue, keyusage.KEY_USAGE_FAST_FINISHED, et)
+	if tamper {
+		cb[0] ^= 0xff
+	}
+	strengthenKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	t1 := time.Now().UTC().Truncate(time.Second)
+	r := KrbFastResponse{
+		PAData:        types.PADataSequence{},
+		StrengthenKey: strengthenKey,
+		Finished: KrbFastFinished{
+			Timestamp: t1,
+			CRealm:    "TEST.GOKRB5",
+			CName:     a.ReqBody.CName,
+			TicketChecksum: types.Checksum{
+				CksumType: et.GetHashID(),
+				Checksum:  cb,
+			},
+		},
+		Nonce: a.ReqBody.Nonce,
+	}
+	asRep.PAData = types.PADataSequence{testFASTReplyPAData(t, armorKey, r)}
+	sessionKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	encPart := EncKDCRepPart{
+		Key:      sessionKey,
+		LastReqs: []LastReq{{LRType: 0, LRValue: t1}},
+		Nonce:    a.ReqBody.Nonce,
+		Flags:    types.NewKrbFlags(),
+		AuthTime: t1,
+		EndTime:  t1.Add(time.Hour),
+		SRealm:   "TEST.GOKRB5",
+		SName:    a.ReqBody.SName,
+	}
+	eb, err := asn1.Marshal(encPart)
+	if err != nil {
+		t.Fatalf("Error marshalling EncKDCRepPart: %v", err)
+	}
+	eb = asn1tools.AddASNAppTag(eb, asnAppTag.EncASRepPart)
+	k, _ := crypto.KRBFXCF2(strengthenKey, replyKey, "strengthenkey", "replykey")
+	asRep.EncPart, err = crypto.GetEncryptedData(eb, k, keyusage.AS_REP_ENCPART, 1)
+	if err != nil {
+		t.Fatalf("Error encrypting EncKDCRepPart: %v", err)
+	}
+	return asRep, &creds, sessionKey
+}
+
+func TestASRep_DecryptEncPartWithFAST(t *testing.T) {
+	a, _, armorKey := testFASTArmoredASReq(t)
+	asRep, creds, sessionKey := testFASTASRep(t, a, armorKey, false)
+	err := asRep.DecryptEncPartWithFAST(creds, a)
+	if err != nil {
+		t.Fatalf("Error decrypting FAST AS_REP: %v", err)
+	}
+	assert.Equal(t, sessionKey, asRep.DecryptedEncPart.Key, "Session key not as expected")
+	assert.Equal(t, a.ReqBody.Nonce, asRep.DecryptedEncPart.Nonce, "Nonce not as expected")
+	assert.Equal(t, a.ReqBody.CName.NameString, asRep.CName.NameString, "CName from FAST finished not as expected")
+}
+
+func TestASRep_DecryptEncPartWithFAST_badFinished(t *testing.T) {
+	a, _, armorKey := testFASTArmoredASReq(t)
+	asRep, creds, _ := testFASTASRep(t, a, armorKey, true)
+	err := asRep.DecryptEncPartWithFAST(creds, a)
+	assert.Error(t, err, "FAST AS_REP with an invalid finished checksum should not be accepted")
+}
+
+func TestASRep_DecryptEncPartWithFAST_unprotected(t *testing.T) {
+	a, _, armorKey := testFASTArmoredASReq(t)
+	asRep, creds, _ := testFASTASRep(t, a, armorKey, false)
+	asRep.PAData = types.PADataSequence{}
+	err := asRep.DecryptEncPartWithFAST(creds, a)
+	assert.Error(t, err, "AS_REP without a FAST response should not be accepted")
+}
+
+func TestFASTArmor_EncryptedChallengePAData(t *testing.T) {
+	armorKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	replyKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	armor := FASTArmor{Key: armorKey}
+	pa, err := armor.EncryptedChallengePAData(replyKey, time.Now())
+	if err != nil {
+		t.Fatalf("Error creating encrypted challenge: %v", err)
+	}
+	assert.Equal(t, patype.PA_ENCRYPTED_CHALLENGE, pa.PADataType, "Padata type not as expected")
+
+	// Verify the challenge as the KDC would
+	var ed types.EncryptedData
+	err = ed.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("Error unmarshalling encrypted challenge: %v", err)
+	}
+	k, _ := crypto.KRBFXCF2(armorKey, replyKey, "clientchallengearmor", "challengelongterm")
+	et, _ := crypto.GetEtype(etype.AES256_CTS_HMAC_SHA1_96)
+	b, err := crypto.DecryptEncPart(k.KeyValue, ed, et, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT)
+	if err != nil {
+		t.Fatalf("Error decrypting encrypted challenge: %v", err)
+	}
+	var ts types.PAEncTSEnc
+	err = ts.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling encrypted challenge timestamp: %v", err)
+	}
+	assert.True(t, time.Since(ts.PATimestamp) < time.Minute, "Encrypted challenge timestamp not as expected")
+}
+
+// Create the KDC's encrypted challenge padata.
+func testKDCChallengePAData(t *testing.T, armorKey, replyKey types.EncryptionKey, ts time.Time) types.PAData {
+	k, _ := crypto.KRBFXCF2(armorKey, replyKey, "kdcchallengearmor", "challengelongterm")
+	b, _ := asn1.Marshal(types.PAEncTSEnc{PATimestamp: ts})
+	ed, err := crypto.GetEncryptedData(b, k, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC, 0)
+	if err != nil {
+		t.Fatalf("Error encrypting KDC challenge: %v", err)
+	}
+	eb, _ := ed.Marshal()
+	return types.PAData{
+		PADataType:  patype.PA_ENCRYPTED_CHALLENGE,
+		PADataValue: eb,
+	}
+}
+
+func TestASRep_VerifyEncryptedChallenge(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	armorKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	replyKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	otherKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	a := NewASReq(c, "testuser1")
+	a.FASTArmor = &FASTArmor{Key: armorKey}
+	var asRep ASRep
+
+	asRep.PAData = types.PADataSequence{testKDCChallengePAData(t, armorKey, replyKey, time.Now().UTC())}
+	assert.NoError(t, asRep.VerifyEncryptedChallenge(c, a, replyKey), "KDC's encrypted challenge should be valid")
+	assert.Error(t, asRep.VerifyEncryptedChallenge(c, a, otherKey), "KDC's encrypted challenge with the wrong reply key should not be valid")
+
+	asRep.PAData = types.PADataSequence{testKDCChallengePAData(t, armorKey, replyKey, time.Now().UTC().Add(-time.Hour))}
+	assert.Error(t, asRep.VerifyEncryptedChallenge(c, a, replyKey), "KDC's encrypted challenge outside of the clock skew should not be valid")
+
+	asRep.PAData = types.PADataSequence{}
+	assert.Error(t, asRep.VerifyEncryptedChallenge(c, a, replyKey), "Missing KDC encrypted challenge should not be valid")
+}
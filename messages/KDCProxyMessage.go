@@ -0,0 +1,65 @@
+package messages
+
+// Reference: https://msdn.microsoft.com/en-us/library/hh553774.aspx
+// [MS-KKDCP]: Kerberos Key Distribution Center (KDC) Proxy Protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/jcmturner/asn1"
+)
+
+/*
+KDC-PROXY-MESSAGE ::= SEQUENCE {
+	kerb-message   [0] OCTET STRING,
+	target-domain  [1] KERB-REALM OPTIONAL,
+	dclocator-hint [2] INTEGER OPTIONAL
+}
+
+The kerb-message is the Kerberos message preceded by its 4 byte length as when sent over TCP.
+*/
+
+type KDCProxyMessage struct {
+	KerbMessage   []byte `asn1:"explicit,tag:0"`
+	TargetDomain  string `asn1:"generalstring,optional,explicit,tag:1"`
+	DCLocatorHint int    `asn1:"optional,explicit,tag:2"`
+}
+
+// Create a new KDC-PROXY-MESSAGE wrapping the Kerberos message for the KDC of the realm specified.
+func NewKDCProxyMessage(b []byte, realm string) KDCProxyMessage {
+	km := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(km, uint32(len(b)))
+	return KDCProxyMessage{
+		KerbMessage:  append(km, b...),
+		TargetDomain: realm,
+	}
+}
+
+// Get the Kerberos message wrapped in the KDC-PROXY-MESSAGE.
+func (m *KDCProxyMessage) Message() ([]byte, error) {
+	if len(m.KerbMessage) < 4 {
+		return nil, errors.New("KDC-PROXY-MESSAGE does not contain a Kerberos message")
+	}
+	l := binary.BigEndian.Uint32(m.KerbMessage[0:4])
+	if int(l) != len(m.KerbMessage)-4 {
+		return nil, fmt.Errorf("Length of Kerberos message in KDC-PROXY-MESSAGE not as expected. Expected: %d; Actual: %d", l, len(m.KerbMessage)-4)
+	}
+	return m.KerbMessage[4:], nil
+}
+
+func (m *KDCProxyMessage) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*m)
+	if err != nil {
+		return b, fmt.Errorf("Error marshalling KDC-PROXY-MESSAGE: %v", err)
+	}
+	return b, nil
+}
+
+func (m *KDCProxyMessage) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, m)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling KDC-PROXY-MESSAGE: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package messages
+
+import (
+	"encoding/hex"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestKDCProxyMessage_Marshal(t *testing.T) {
+	b, err := hex.DecodeString(testdata.TestVectors["encode_krb5_as_req"])
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	m := NewKDCProxyMessage(b, "TEST.GOKRB5")
+	mb, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling KDC-PROXY-MESSAGE: %v", err)
+	}
+	var u KDCProxyMessage
+	err = u.Unmarshal(mb)
+	if err != nil {
+		t.Fatalf("Error unmarshalling KDC-PROXY-MESSAGE: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", u.TargetDomain, "Target domain not as expected")
+	assert.Equal(t, len(b)+4, len(u.KerbMessage), "Kerberos message length not as expected")
+	kb, err := u.Message()
+	if err != nil {
+		t.Fatalf("Error getting Kerberos message: %v", err)
+	}
+	assert.Equal(t, b, kb, "Kerberos message not as expected")
+}
+
+func TestKDCProxyMessage_Message_badLength(t *testing.T) {
+	m := KDCProxyMessage{KerbMessage: []byte{0, 0, 0, 5, 1, 2}}
+	_, err := m.Message()
+	assert.Error(t, err, "Kerberos message with incorrect length should not be accepted")
+}
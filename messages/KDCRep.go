@@ -38,10 +38,12 @@ type KDCRepFields struct {
 	Ticket           types.Ticket
 	EncPart          types.EncryptedData
 	DecryptedEncPart EncKDCRepPart
+	FASTResponse     KrbFastResponse
 }
 
 type ASRep struct {
 	KDCRepFields
+	replyKey types.EncryptionKey
 }
 type TGSRep struct {
 	KDCRepFields
@@ -137,27 +139,74 @@ func (e *EncKDCRepPart) Unmarshal(b []byte) error {
 }
 
 func (k *ASRep) DecryptEncPart(c *credentials.Credentials) error {
-	var etype crypto.EType
-	var key types.EncryptionKey
-	var err error
-	if c.HasKeytab() {
-		etype, err = crypto.GetEtype(k.EncPart.EType)
-		if err != nil {
-			return fmt.Errorf("Error getting encryption type: %v", err)
-		}
-		key, err = c.Keytab.GetEncryptionKey(k.CName.NameString[0], k.CRealm, k.EncPart.KVNO, k.EncPart.EType)
-		if err != nil {
-			return fmt.Errorf("Could not get key from keytab: %v", err)
-		}
+	key, err := k.getReplyKey(c)
+	if err != nil {
+		return err
 	}
-	if c.HasPassword() {
-		key, etype, err = crypto.GetKeyFromPassword(c.Password, k.CName, k.CRealm, k.EncPart.EType, k.PAData)
-		if err != nil {
-			return fmt.Errorf("Could not derive key from password: %v", err)
-		}
+	return k.decryptEncPart(key)
+}
+
+// Decrypt the encrypted part of an AS_REP returned in response to a FAST armored AS_REQ.
+// The FAST response must be present and its finished field is verified against the ticket issued.
+// If the KDC provided a strengthen key the reply key is strengthened with it.
+func (k *ASRep) DecryptEncPartWithFAST(c *credentials.Credentials, asReq ASReq) error {
+	err := k.ProcessFASTResponse(asReq)
+	if err != nil {
+		return err
+	}
+	key, err := k.getReplyKey(c)
+	if err != nil {
+		return err
+	}
+	return k.DecryptEncPartWithKey(key)
+}
+
+// Process the FAST response of an AS_REP returned in response to a FAST armored AS_REQ.
+// This must be done before the reply key is determined from the padata of the AS_REP.
+func (k *ASRep) ProcessFASTResponse(asReq ASReq) error {
+	if asReq.FASTArmor == nil {
+		return errors.New("AS_REQ was not armored with FAST")
+	}
+	return k.processFASTResponse(*asReq.FASTArmor, asReq.ReqBody.Nonce)
+}
+
+// Verify the KDC's encrypted challenge in the reply to an AS_REQ pre-authenticated with PA-ENCRYPTED-CHALLENGE.
+// This authenticates the KDC as it must know the client's long term key, the reply key. The FAST response must
+// already have been processed. Ref: RFC 6113 Section 5.4.6
+func (k *ASRep) VerifyEncryptedChallenge(cfg *config.Config, asReq ASReq, replyKey types.EncryptionKey) error {
+	if asReq.FASTArmor == nil {
+		return errors.New("AS_REQ was not armored with FAST")
+	}
+	return asReq.FASTArmor.verifyKDCChallenge(k.PAData, replyKey, cfg.Now(), cfg.LibDefaults.Clockskew)
+}
+
+// Decrypt the encrypted part of the AS_REP with the reply key provided.
+// This is used where the reply key is not the client's long term key, for example when it is derived during
+// pre-authentication. If a FAST response has been processed the reply key is strengthened as required.
+func (k *ASRep) DecryptEncPartWithKey(key types.EncryptionKey) error {
+	key, err := k.FASTResponse.StrengthenReplyKey(key)
+	if err != nil {
+		return err
 	}
-	if !c.HasKeytab() && !c.HasPassword() {
-		return errors.New("No secret available in credentials to preform decryption")
+	return k.decryptEncPart(key)
+}
+
+// Get the client's long term key from the credentials to decrypt the AS_REP with.
+func (k *ASRep) getReplyKey(c *credentials.Credentials) (types.EncryptionKey, error) {
+	if !c.HasKey() {
+		return types.EncryptionKey{}, errors.New("No secret available in credentials to preform decryption")
+	}
+	key, err := c.GetKey(k.CName, k.CRealm, k.EncPart.EType, k.EncPart.KVNO, k.PAData)
+	if err != nil {
+		return key, fmt.Errorf("Could not get reply key from credentials: %v", err)
+	}
+	return key, nil
+}
+
+func (k *ASRep) decryptEncPart(key types.EncryptionKey) error {
+	etype, err := crypto.GetEtype(k.EncPart.EType)
+	if err != nil {
+		return fmt.Errorf("Error getting encryption type: %v", err)
 	}
 	b, err := crypto.DecryptEncPart(key.KeyValue, k.EncPart, etype, keyusage.AS_REP_ENCPART)
 	if err != nil {
@@ -169,21 +218,36 @@ func (k *ASRep) DecryptEncPart(c *credentials.Credentials) error {
 		return fmt.Errorf("Error unmarshalling encrypted part: %v", err)
 	}
 	k.DecryptedEncPart = denc
+	k.replyKey = key
 	return nil
 }
 
+// Validate the AS_REP against the AS_REQ sent.
+// The PA-REQ-ENC-PA-REP checksum over the AS_REQ is verified separately with VerifyEncPARep.
+// If kdc_timesync is enabled the auth time is not checked against the client's clock, as the client instead learns
+// the KDC's time from the valid reply.
 func (k *ASRep) IsValid(cfg *config.Config, asReq ASReq) (bool, error) {
 	//Ref RFC 4120 Section 3.1.5
-	if k.CName.NameType != asReq.ReqBody.CName.NameType || k.CName.NameString == nil {
-		return false, fmt.Errorf("CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
-	}
-	for i := range k.CName.NameString {
-		if k.CName.NameString[i] != asReq.ReqBody.CName.NameString[i] {
+	if types.IsFlagSet(&asReq.ReqBody.KDCOptions, types.RequestAnonymous) {
+		// The KDC replaces the client's name and realm with the anonymous ones. Ref: RFC 8062 Section 4.1
+		if !k.CName.IsAnonymous() || k.CRealm != types.AnonymousRealm {
+			return false, fmt.Errorf("Client in response to anonymous request is not anonymous. Reply: %+v@%s", k.CName, k.CRealm)
+		}
+		if !types.IsFlagSet(&k.DecryptedEncPart.Flags, types.Anonymous) {
+			return false, errors.New("Ticket in response to anonymous request does not have the anonymous flag set")
+		}
+	} else {
+		if k.CName.NameType != asReq.ReqBody.CName.NameType || k.CName.NameString == nil {
 			return false, fmt.Errorf("CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
 		}
-	}
-	if k.CRealm != asReq.ReqBody.Realm {
-		return false, fmt.Errorf("CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
+		for i := range k.CName.NameString {
+			if k.CName.NameString[i] != asReq.ReqBody.CName.NameString[i] {
+				return false, fmt.Errorf("CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
+			}
+		}
+		if k.CRealm != asReq.ReqBody.Realm {
+			return false, fmt.Errorf("CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
+		}
 	}
 	if k.DecryptedEncPart.Nonce != asReq.ReqBody.Nonce {
 		return false, errors.New("Possible replay attack, nonce in response does not match that in request")
@@ -199,44 +263,110 @@ func (k *ASRep) IsValid(cfg *config.Config, asReq ASReq) (bool, error) {
 	if k.DecryptedEncPart.SRealm != asReq.ReqBody.Realm {
 		return false, fmt.Errorf("SRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.DecryptedEncPart.SRealm)
 	}
-	if len(asReq.ReqBody.Addresses) > 0 {
-		//TODO compare if address list is the same
+	if len(asReq.ReqBody.Addresses) > 0 && !types.HostAddressesEqual(k.DecryptedEncPart.CAddr, asReq.ReqBody.Addresses) {
+		return false, errors.New("Addresses listed in the response do not match those requested")
 	}
-	if time.Since(k.DecryptedEncPart.AuthTime) > cfg.LibDefaults.Clockskew || time.Until(k.DecryptedEncPart.AuthTime) > cfg.LibDefaults.Clockskew {
-		return false, fmt.Errorf("Clock skew with KDC too large. Greater than %v seconds", cfg.LibDefaults.Clockskew.Seconds())
-	}
-	if asReq.PAData.Contains(patype.PA_REQ_ENC_PA_REP) {
-		if len(k.DecryptedEncPart.EncPAData) < 2 || !k.DecryptedEncPart.EncPAData.Contains(patype.PA_FX_FAST) {
-			return false, errors.New("KDC did not respond appropriately to FAST negotiation")
+	if cfg.LibDefaults.Kdc_timesync == 0 {
+		if now := cfg.Now(); now.Sub(k.DecryptedEncPart.AuthTime) > cfg.LibDefaults.Clockskew || k.DecryptedEncPart.AuthTime.Sub(now) > cfg.LibDefaults.Clockskew {
+			return false, fmt.Errorf("Clock skew with KDC too large. Greater than %v seconds", cfg.LibDefaults.Clockskew.Seconds())
 		}
-		//TODO figure out how to check hash and put back
-		//for _, pa := range k.DecryptedEncPart.EncPAData {
-		//	if pa.PADataType == patype.PA_REQ_ENC_PA_REP {
-		//		var pafast types.PAReqEncPARep
-		//		err := pafast.Unmarshal(pa.PADataValue)
-		//		if err != nil {
-		//			return false, fmt.Errorf("KDC FAST negotiation response error, could not unmarshal PA_REQ_ENC_PA_REP: %v", err)
-		//		}
-		//		etype, err := crypto.GetChksumEtype(pafast.ChksumType)
-		//		if err != nil {
-		//			return false, fmt.Errorf("KDC FAST negotiation response error, %v", err)
-		//		}
-		//		ab, _ := asReq.Marshal()
-		//		if !crypto.VerifyChecksum(k.DecryptedEncPart.Key.KeyValue, pafast.Chksum, ab, keyusage.KEY_USAGE_AS_REQ, etype) {
-		//			return false, errors.New("KDC FAST negotiation response checksum invalid")
-		//		}
-		//	}
-		//}
 	}
 	return true, nil
 }
 
+// Verify the PA-REQ-ENC-PA-REP checksum over the AS_REQ sent. Ref: RFC 6806 Section 11
+// asReqBytes must be the bytes of the AS_REQ exactly as they were sent to the KDC and the encrypted part of the AS_REP
+// must already have been decrypted.
+// If the KDC indicates, with the enc-pa-rep flag, that it supports encrypted padata the checksum must be present and
+// valid, otherwise the unprotected parts of the exchange may have been modified.
+func (k *ASRep) VerifyEncPARep(asReqBytes []byte) error {
+	var found bool
+	for _, pa := range k.DecryptedEncPart.EncPAData {
+		if pa.PADataType != patype.PA_REQ_ENC_PA_REP {
+			continue
+		}
+		found = true
+		var p types.PAReqEncPARep
+		err := p.Unmarshal(pa.PADataValue)
+		if err != nil {
+			return fmt.Errorf("Error unmarshalling PA_REQ_ENC_PA_REP: %v", err)
+		}
+		etype, err := crypto.GetChksumEtype(p.ChksumType)
+		if err != nil {
+			return fmt.Errorf("Error getting PA_REQ_ENC_PA_REP checksum type: %v", err)
+		}
+		if etype.GetETypeID() != k.replyKey.KeyType {
+			return fmt.Errorf("PA_REQ_ENC_PA_REP checksum type %d does not match the reply key type %d", p.ChksumType, k.replyKey.KeyType)
+		}
+		if !crypto.VerifyChecksum(k.replyKey.KeyValue, p.Chksum, asReqBytes, keyusage.KEY_USAGE_AS_REQ, etype) {
+			return errors.New("PA_REQ_ENC_PA_REP checksum is not valid, the AS exchange may have been modified")
+		}
+	}
+	if !found && types.IsFlagSet(&k.DecryptedEncPart.Flags, types.EncPARep) {
+		return errors.New("KDC indicated support for encrypted padata but did not return a PA_REQ_ENC_PA_REP checksum")
+	}
+	return nil
+}
+
+// Process the FAST response in the padata of the KDC reply.
+// The client name and realm from the finished field replace those in the unprotected part of the reply and the padata
+// of the reply is replaced with that from the FAST response.
+func (k *KDCRepFields) processFASTResponse(armor FASTArmor, nonce int) error {
+	r, err := armor.decryptResponse(k.PAData, nonce)
+	if err != nil {
+		return err
+	}
+	err = r.verifyFinished(armor, k.Ticket)
+	if err != nil {
+		return err
+	}
+	k.FASTResponse = r
+	k.PAData = r.PAData
+	k.CRealm = r.Finished.CRealm
+	k.CName = r.Finished.CName
+	return nil
+}
+
 func (k *TGSRep) DecryptEncPart(key types.EncryptionKey) error {
+	return k.decryptEncPart(key, keyusage.TGS_REP_ENCPART_SESSION_KEY)
+}
+
+// Decrypt the encrypted part of the TGS_REP using the sub-session key that was in the authenticator of the TGS_REQ.
+func (k *TGSRep) DecryptEncPartWithSubKey(subKey types.EncryptionKey) error {
+	return k.decryptEncPart(subKey, keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY)
+}
+
+// Decrypt the encrypted part of a TGS_REP returned in response to a FAST armored TGS_REQ.
+// The FAST response must be present and its finished field is verified against the ticket issued.
+// The reply key is the sub-session key of the TGS_REQ if present otherwise the session key provided, strengthened with
+// the strengthen key if the KDC provided one.
+func (k *TGSRep) DecryptEncPartWithFAST(tgsReq TGSReq, sessionKey types.EncryptionKey) error {
+	if tgsReq.FASTArmor == nil {
+		return errors.New("TGS_REQ was not armored with FAST")
+	}
+	err := k.processFASTResponse(*tgsReq.FASTArmor, tgsReq.ReqBody.Nonce)
+	if err != nil {
+		return err
+	}
+	key := sessionKey
+	var usage uint32 = keyusage.TGS_REP_ENCPART_SESSION_KEY
+	if len(tgsReq.SubKey.KeyValue) > 0 {
+		key = tgsReq.SubKey
+		usage = keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY
+	}
+	key, err = k.FASTResponse.StrengthenReplyKey(key)
+	if err != nil {
+		return err
+	}
+	return k.decryptEncPart(key, usage)
+}
+
+func (k *TGSRep) decryptEncPart(key types.EncryptionKey, usage uint32) error {
 	etype, err := crypto.GetEtype(key.KeyType)
 	if err != nil {
 		return fmt.Errorf("Could not get etype: %v", err)
 	}
-	b, err := crypto.DecryptEncPart(key.KeyValue, k.EncPart, etype, keyusage.TGS_REP_ENCPART_SESSION_KEY)
+	b, err := crypto.DecryptEncPart(key.KeyValue, k.EncPart, etype, usage)
 	if err != nil {
 		return fmt.Errorf("Error decrypting KDC_REP EncPart: %v", err)
 	}
@@ -283,10 +413,12 @@ func (k *TGSRep) IsValid(cfg *config.Config, tgsReq TGSReq) (bool, error) {
 	if k.DecryptedEncPart.SRealm != tgsReq.ReqBody.Realm {
 		return false, fmt.Errorf("SRealm in response does not match what was requested. Requested: %s; Reply: %s", tgsReq.ReqBody.Realm, k.DecryptedEncPart.SRealm)
 	}
-	if len(tgsReq.ReqBody.Addresses) > 0 {
-		//TODO compare if address list is the same
+	if len(tgsReq.ReqBody.Addresses) > 0 && !types.HostAddressesEqual(k.DecryptedEncPart.CAddr, tgsReq.ReqBody.Addresses) {
+		return false, errors.New("Addresses listed in the response do not match those requested")
 	}
-	if !tgsReq.Renewal && (time.Since(k.DecryptedEncPart.AuthTime) > cfg.LibDefaults.Clockskew || time.Until(k.DecryptedEncPart.AuthTime) > cfg.LibDefaults.Clockskew) {
+	// The auth time of a renewed or validated ticket is that of the original ticket
+	validate := types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, types.Validate)
+	if now := cfg.Now(); !tgsReq.Renewal && !validate && (now.Sub(k.DecryptedEncPart.AuthTime) > cfg.LibDefaults.Clockskew || k.DecryptedEncPart.AuthTime.Sub(now) > cfg.LibDefaults.Clockskew) {
 		return false, fmt.Errorf("Clock skew with KDC too large. Greater than %v seconds", cfg.LibDefaults.Clockskew.Seconds())
 	}
 	return true, nil
@@ -6,8 +6,10 @@ import (
 	"github.com/jcmturner/gokrb5/credentials"
 	"github.com/jcmturner/gokrb5/iana/etype"
 	"github.com/jcmturner/gokrb5/iana/msgtype"
+	"github.com/jcmturner/gokrb5/iana/patype"
 	"github.com/jcmturner/gokrb5/keytab"
 	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -355,3 +357,57 @@ func TestUnmarshalASRepDecodeAndDecrypt_withPassword(t *testing.T) {
 //	}
 //	t.Log("AS REP validation tests finished")
 //}
+
+func testDecryptedASRep(t *testing.T) ASRep {
+	var asRep ASRep
+	b, _ := hex.DecodeString(testdata.TEST_AS_REP)
+	err := asRep.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("AS REP Unmarshal error: %v\n", err)
+	}
+	ktb, _ := hex.DecodeString(testdata.TESTUSER1_KEYTAB)
+	kt, err := keytab.Parse(ktb)
+	if err != nil {
+		t.Fatalf("keytab parse error: %v\n", err)
+	}
+	cred := credentials.NewCredentials(test_user, test_realm)
+	err = asRep.DecryptEncPart(cred.WithKeytab(kt))
+	if err != nil {
+		t.Fatalf("Decryption of AS_REP EncPart failed: %v", err)
+	}
+	return asRep
+}
+
+func TestASRep_VerifyEncPARep(t *testing.T) {
+	asRep := testDecryptedASRep(t)
+	assert.True(t, asRep.DecryptedEncPart.EncPAData.Contains(patype.PA_REQ_ENC_PA_REP), "Encrypted padata does not contain PA_REQ_ENC_PA_REP")
+	assert.True(t, types.IsFlagSet(&asRep.DecryptedEncPart.Flags, types.EncPARep), "enc-pa-rep flag not set")
+	b, _ := hex.DecodeString(testdata.TEST_AS_REQ)
+	err := asRep.VerifyEncPARep(b)
+	if err != nil {
+		t.Fatalf("Error verifying PA_REQ_ENC_PA_REP: %v", err)
+	}
+}
+
+func TestASRep_VerifyEncPARep_modifiedReq(t *testing.T) {
+	asRep := testDecryptedASRep(t)
+	b, _ := hex.DecodeString(testdata.TEST_AS_REQ)
+	// Remove an etype from the end of the list as a man in the middle might to weaken the etypes requested
+	b = b[:len(b)-5]
+	err := asRep.VerifyEncPARep(b)
+	assert.Error(t, err, "Checksum over a modified AS_REQ should not be valid")
+}
+
+func TestASRep_VerifyEncPARep_missing(t *testing.T) {
+	asRep := testDecryptedASRep(t)
+	var pas types.PADataSequence
+	for _, pa := range asRep.DecryptedEncPart.EncPAData {
+		if pa.PADataType != patype.PA_REQ_ENC_PA_REP {
+			pas = append(pas, pa)
+		}
+	}
+	asRep.DecryptedEncPart.EncPAData = pas
+	b, _ := hex.DecodeString(testdata.TEST_AS_REQ)
+	err := asRep.VerifyEncPARep(b)
+	assert.Error(t, err, "Missing PA_REQ_ENC_PA_REP should not be accepted when the enc-pa-rep flag is set")
+}
@@ -4,6 +4,7 @@ package messages
 // Section: 5.4.1
 
 import (
+	"errors"
 	"fmt"
 	"github.com/jcmturner/asn1"
 	"github.com/jcmturner/gokrb5/asn1tools"
@@ -28,11 +29,15 @@ type marshalKDCReq struct {
 }
 
 type KDCReqFields struct {
-	PVNO    int
-	MsgType int
-	PAData  types.PADataSequence
-	ReqBody KDCReqBody
-	Renewal bool
+	PVNO      int
+	MsgType   int
+	PAData    types.PADataSequence
+	ReqBody   KDCReqBody
+	Renewal   bool
+	SubKey    types.EncryptionKey
+	FASTArmor *FASTArmor
+	// Padata carried in the inner request when armored with FAST.
+	fastPAData types.PADataSequence
 }
 
 type ASReq struct {
@@ -74,14 +79,103 @@ type KDCReqBody struct {
 	AdditionalTickets []types.Ticket      `asn1:"explicit,optional,tag:11"`
 }
 
+// Options for the ticket requested, overriding the defaults from the configuration for a single request.
+// Zero values and nil pointers leave the configured default in place.
+// A start time in the future requests a postdated ticket, which is issued invalid and must be validated with the
+// Validate option once the start time has been reached. AllowPostdate requests a TGT from which postdated tickets can
+// be obtained. Proxy requests a proxy ticket, usable only from the addresses provided, from a proxiable TGT.
+// Forwarded requests a TGT, usable only from the addresses provided, to forward to another host.
+// SubKey places a random sub-session key in the authenticator of a TGS_REQ so that the KDC encrypts the reply in it
+// rather than in the session key of the TGT.
+type TicketOptions struct {
+	Lifetime      time.Duration
+	RenewLifetime time.Duration
+	StartTime     time.Time
+	Forwardable   *bool
+	Proxiable     *bool
+	Canonicalize  *bool
+	AllowPostdate bool
+	Validate      bool
+	Proxy         bool
+	Forwarded     bool
+	SubKey        bool
+	ETypes        []int
+	Addresses     []types.HostAddress
+}
+
+// Apply the options to the request body. The lifetimes are relative to the start time if set, otherwise to now.
+// For a TGS_REQ this must be done before the authenticator checksum is calculated over the body.
+func (o TicketOptions) Apply(b *KDCReqBody, c *config.Config) {
+	t := c.Now()
+	if !o.StartTime.IsZero() {
+		if o.StartTime.After(t) {
+			types.SetFlag(&b.KDCOptions, types.AllowPostDate)
+			types.SetFlag(&b.KDCOptions, types.PostDated)
+		}
+		t = o.StartTime
+		b.From = o.StartTime
+	}
+	if o.AllowPostdate {
+		types.SetFlag(&b.KDCOptions, types.AllowPostDate)
+	}
+	if o.Validate {
+		types.SetFlag(&b.KDCOptions, types.Validate)
+	}
+	if o.Proxy {
+		types.SetFlag(&b.KDCOptions, types.Proxy)
+	}
+	if o.Forwarded {
+		types.SetFlag(&b.KDCOptions, types.Forwarded)
+	}
+	if o.Lifetime > 0 {
+		b.Till = t.Add(o.Lifetime)
+	} else if !o.StartTime.IsZero() {
+		b.Till = t.Add(c.LibDefaults.Ticket_lifetime)
+	}
+	if o.RenewLifetime > 0 {
+		types.SetFlag(&b.KDCOptions, types.Renewable)
+		b.RTime = t.Add(o.RenewLifetime)
+	} else if !o.StartTime.IsZero() && c.LibDefaults.Renew_lifetime != 0 {
+		b.RTime = t.Add(c.LibDefaults.Renew_lifetime)
+	}
+	setOption(&b.KDCOptions, types.Forwardable, o.Forwardable)
+	setOption(&b.KDCOptions, types.Proxiable, o.Proxiable)
+	setOption(&b.KDCOptions, types.Canonicalize, o.Canonicalize)
+	if len(o.ETypes) > 0 {
+		b.EType = o.ETypes
+	}
+	if o.Addresses != nil {
+		b.Addresses = o.Addresses
+	}
+}
+
+func setOption(f *asn1.BitString, i int, v *bool) {
+	if v == nil {
+		return
+	}
+	if *v {
+		types.SetFlag(f, i)
+	} else {
+		types.UnsetFlag(f, i)
+	}
+}
+
+// Create a new AS_REQ for the client. The username may have multiple components separated by '/'.
 func NewASReq(c *config.Config, username string) ASReq {
+	cname, _ := types.ParsePrincipalName(username)
 	pas := types.PADataSequence{
 		types.PAData{
 			PADataType: patype.PA_REQ_ENC_PA_REP,
 		},
 	}
 	nonce := int(rand.Int31())
-	t := time.Now()
+	t := c.Now()
+	// Copy the default options so that setting flags on the request does not change the configuration
+	opts := asn1.BitString{
+		Bytes:     make([]byte, len(c.LibDefaults.Kdc_default_options.Bytes)),
+		BitLength: c.LibDefaults.Kdc_default_options.BitLength,
+	}
+	copy(opts.Bytes, c.LibDefaults.Kdc_default_options.Bytes)
 
 	a := ASReq{
 		KDCReqFields{
@@ -89,12 +183,9 @@ func NewASReq(c *config.Config, username string) ASReq {
 			MsgType: msgtype.KRB_AS_REQ,
 			PAData:  pas,
 			ReqBody: KDCReqBody{
-				KDCOptions: c.LibDefaults.Kdc_default_options,
+				KDCOptions: opts,
 				Realm:      c.LibDefaults.Default_realm,
-				CName: types.PrincipalName{
-					NameType:   nametype.KRB_NT_PRINCIPAL,
-					NameString: []string{username},
-				},
+				CName:      cname,
 				SName: types.PrincipalName{
 					NameType:   nametype.KRB_NT_SRV_INST,
 					NameString: []string{"krbtgt", c.LibDefaults.Default_realm},
@@ -118,12 +209,105 @@ func NewASReq(c *config.Config, username string) ASReq {
 		types.SetFlag(&a.ReqBody.KDCOptions, types.Renewable)
 		a.ReqBody.RTime = t.Add(c.LibDefaults.Renew_lifetime)
 	}
+	a.ReqBody.Addresses = requestAddresses(c)
+	return a
+}
+
+// Get the addresses to place in a request so that the ticket issued can only be used from them.
+// None are used if noaddresses is set, otherwise the addresses of the local interfaces are used along with any
+// extra_addresses configured. If the local addresses cannot be determined only the extra addresses are used.
+func requestAddresses(c *config.Config) []types.HostAddress {
+	if c.LibDefaults.Noaddresses {
+		return nil
+	}
+	h, _ := types.LocalHostAddresses()
+	for _, ip := range c.LibDefaults.Extra_addresses {
+		a, err := types.HostAddressFromNetIP(ip)
+		if err == nil && !types.HostAddressesContains(h, a) {
+			h = append(h, a)
+		}
+	}
+	return h
+}
+
+// Create a new AS_REQ for an anonymous ticket from the realm specified. Ref: RFC 8062
+// The client is the well-known anonymous principal and the request-anonymous option is set.
+// Anonymous PKINIT pre-authentication data must be added to the request.
+func NewAnonymousASReq(c *config.Config, realm string) ASReq {
+	a := NewASReq(c, "")
+	a.ReqBody.Realm = realm
+	a.ReqBody.CName = types.NewAnonymousPrincipalName()
+	a.ReqBody.SName = types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"krbtgt", realm},
+	}
+	types.SetFlag(&a.ReqBody.KDCOptions, types.RequestAnonymous)
 	return a
 }
 
 func NewTGSReq(username string, c *config.Config, TGT types.Ticket, sessionKey types.EncryptionKey, spn types.PrincipalName, renewal bool) (TGSReq, error) {
+	return NewTGSReqWithOptions(username, c, TGT, sessionKey, spn, renewal, TicketOptions{})
+}
+
+// Create a new TGS_REQ with ticket options overriding the defaults from the configuration.
+func NewTGSReqWithOptions(username string, c *config.Config, TGT types.Ticket, sessionKey types.EncryptionKey, spn types.PrincipalName, renewal bool, o TicketOptions) (TGSReq, error) {
+	cname, _ := types.ParsePrincipalName(username)
+	return NewTGSReqWithPrincipal(cname, c.LibDefaults.Default_realm, c, TGT, sessionKey, spn, renewal, o)
+}
+
+// Create a new TGS_REQ for the client principal provided, which must be the client of the TGT.
+// The realm is the client's realm from the TGT session and may differ from the default realm.
+func NewTGSReqWithPrincipal(cname types.PrincipalName, crealm string, c *config.Config, TGT types.Ticket, sessionKey types.EncryptionKey, spn types.PrincipalName, renewal bool, o TicketOptions) (TGSReq, error) {
+	return newTGSReq(cname, crealm, c, TGT, sessionKey, spn, renewal, nil, types.EncryptionKey{}, o)
+}
+
+// Create a new TGS_REQ protected by FAST using implicit TGS armor.
+// A random sub-session key is placed in the authenticator of the PA-TGS-REQ from which, along with the TGT session
+// key, the armor key is derived. The KDC will encrypt the reply with the sub-session key.
+func NewFASTTGSReq(username string, c *config.Config, TGT types.Ticket, sessionKey types.EncryptionKey, spn types.PrincipalName, renewal bool) (TGSReq, error) {
+	return NewFASTTGSReqWithOptions(username, c, TGT, sessionKey, spn, renewal, TicketOptions{})
+}
+
+// Create a new TGS_REQ protected by FAST with ticket options overriding the defaults from the configuration.
+func NewFASTTGSReqWithOptions(username string, c *config.Config, TGT types.Ticket, sessionKey types.EncryptionKey, spn types.PrincipalName, renewal bool, o TicketOptions) (TGSReq, error) {
+	cname, _ := types.ParsePrincipalName(username)
+	return NewFASTTGSReqWithPrincipal(cname, c.LibDefaults.Default_realm, c, TGT, sessionKey, spn, renewal, o)
+}
+
+// Create a new TGS_REQ protected by FAST for the client principal provided, which must be the client of the TGT.
+func NewFASTTGSReqWithPrincipal(cname types.PrincipalName, crealm string, c *config.Config, TGT types.Ticket, sessionKey types.EncryptionKey, spn types.PrincipalName, renewal bool, o TicketOptions) (TGSReq, error) {
+	subKey, err := crypto.GenerateKey(sessionKey.KeyType)
+	if err != nil {
+		return TGSReq{}, fmt.Errorf("Error generating sub-session key: %v", err)
+	}
+	a, err := newTGSReq(cname, crealm, c, TGT, sessionKey, spn, renewal, nil, subKey, o)
+	if err != nil {
+		return a, err
+	}
+	armor, err := NewImplicitFASTArmor(subKey, sessionKey)
+	if err != nil {
+		return a, err
+	}
+	err = a.ArmorWithFAST(armor)
+	return a, err
+}
+
+// Create a new TGS_REQ for a user-to-user ticket.
+// The verifying TGT is the TGT of the peer being authenticated to and the ticket issued by the KDC will be encrypted
+// in the session key of that TGT rather than in the long term key of the peer.
+func NewUser2UserTGSReq(username string, c *config.Config, TGT types.Ticket, sessionKey types.EncryptionKey, spn types.PrincipalName, renewal bool, verifyingTGT types.Ticket) (TGSReq, error) {
+	cname, _ := types.ParsePrincipalName(username)
+	return NewUser2UserTGSReqWithPrincipal(cname, c.LibDefaults.Default_realm, c, TGT, sessionKey, spn, renewal, verifyingTGT)
+}
+
+// Create a new TGS_REQ for a user-to-user ticket for the client principal provided, which must be the client of the TGT.
+func NewUser2UserTGSReqWithPrincipal(cname types.PrincipalName, crealm string, c *config.Config, TGT types.Ticket, sessionKey types.EncryptionKey, spn types.PrincipalName, renewal bool, verifyingTGT types.Ticket) (TGSReq, error) {
+	return newTGSReq(cname, crealm, c, TGT, sessionKey, spn, renewal, []types.Ticket{verifyingTGT}, types.EncryptionKey{}, TicketOptions{})
+}
+
+func newTGSReq(cname types.PrincipalName, crealm string, c *config.Config, TGT types.Ticket, sessionKey types.EncryptionKey, spn types.PrincipalName, renewal bool, additionalTkts []types.Ticket, subKey types.EncryptionKey, o TicketOptions) (TGSReq, error) {
 	nonce := int(rand.Int31())
-	t := time.Now()
+	t := c.Now()
 	a := TGSReq{
 		KDCReqFields{
 			PVNO:    iana.PVNO,
@@ -156,7 +340,25 @@ func NewTGSReq(username string, c *config.Config, TGT types.Ticket, sessionKey t
 		types.SetFlag(&a.ReqBody.KDCOptions, types.Renew)
 		types.SetFlag(&a.ReqBody.KDCOptions, types.Renewable)
 	}
-	auth := types.NewAuthenticator(c.LibDefaults.Default_realm, username)
+	if len(additionalTkts) > 0 {
+		types.SetFlag(&a.ReqBody.KDCOptions, types.EncTktInSkey)
+		a.ReqBody.AdditionalTickets = additionalTkts
+	}
+	o.Apply(&a.ReqBody, c)
+	// The authenticator's client must match the client of the TGT
+	auth := types.NewAuthenticator(crealm, "")
+	auth.CName = cname
+	auth.SetTime(t)
+	if len(subKey.KeyValue) > 0 {
+		auth.SubKey = subKey
+	} else if o.SubKey {
+		k, err := crypto.GenerateKey(sessionKey.KeyType)
+		if err != nil {
+			return a, fmt.Errorf("Error generating sub-session key: %v", err)
+		}
+		auth.SubKey = k
+	}
+	a.SubKey = auth.SubKey
 	// Add the CName to make validation of the reply easier
 	a.ReqBody.CName = auth.CName
 	b, err := a.ReqBody.Marshal()
@@ -186,6 +388,90 @@ func NewTGSReq(username string, c *config.Config, TGT types.Ticket, sessionKey t
 	return a, nil
 }
 
+// Protect the AS_REQ with FAST using the armor provided.
+// The padata of the request is moved into the encrypted inner request and replaced with the PA-FX-FAST padata.
+func (k *ASReq) ArmorWithFAST(armor FASTArmor) error {
+	b, err := k.ReqBody.Marshal()
+	if err != nil {
+		return fmt.Errorf("Error marshalling request body: %v", err)
+	}
+	pa, err := armor.armoredPAData(k.PAData, k.ReqBody, b)
+	if err != nil {
+		return fmt.Errorf("Error armoring AS_REQ with FAST: %v", err)
+	}
+	k.fastPAData = k.PAData
+	k.PAData = types.PADataSequence{pa}
+	k.FASTArmor = &armor
+	return nil
+}
+
+// Set PA-PAC-REQUEST on the AS_REQ to ask the KDC to include, or leave out, the PAC in the ticket issued.
+// If the request is already armored with FAST it is armored again so that the padata is within the inner request.
+func (k *ASReq) SetPACRequest(includePAC bool) error {
+	pa, err := types.NewPACRequestPAData(includePAC)
+	if err != nil {
+		return err
+	}
+	if k.FASTArmor == nil {
+		k.PAData.Set(pa)
+		return nil
+	}
+	k.PAData = append(types.PADataSequence{}, k.fastPAData...)
+	k.PAData.Set(pa)
+	return k.ArmorWithFAST(*k.FASTArmor)
+}
+
+// Protect the TGS_REQ with FAST using the armor provided.
+// The PA-TGS-REQ remains in the outer request and the request checksum is calculated over its AP_REQ.
+// Any other padata is moved into the encrypted inner request.
+func (k *TGSReq) ArmorWithFAST(armor FASTArmor) error {
+	var apb []byte
+	var pas types.PADataSequence
+	for _, pa := range k.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			apb = pa.PADataValue
+			continue
+		}
+		pas = append(pas, pa)
+	}
+	if len(apb) < 1 {
+		return errors.New("TGS_REQ does not contain a PA-TGS-REQ to armor with FAST")
+	}
+	pa, err := armor.armoredPAData(pas, k.ReqBody, apb)
+	if err != nil {
+		return fmt.Errorf("Error armoring TGS_REQ with FAST: %v", err)
+	}
+	k.fastPAData = pas
+	k.PAData = types.PADataSequence{
+		types.PAData{
+			PADataType:  patype.PA_TGS_REQ,
+			PADataValue: apb,
+		},
+		pa,
+	}
+	k.FASTArmor = &armor
+	return nil
+}
+
+// Set PA-PAC-OPTIONS on the TGS_REQ, for example to request claims or resource-based constrained delegation.
+// The flags are set with types.SetFlag using the types.PACOption constants.
+// If the request is already armored with FAST it is armored again so that the padata is within the inner request.
+func (k *TGSReq) SetPACOptions(flags asn1.BitString) error {
+	pa, err := types.NewPACOptionsPAData(flags)
+	if err != nil {
+		return err
+	}
+	if k.FASTArmor == nil {
+		k.PAData.Set(pa)
+		return nil
+	}
+	pas := types.PADataSequence{k.PAData[0]}
+	pas = append(pas, k.fastPAData...)
+	pas.Set(pa)
+	k.PAData = pas
+	return k.ArmorWithFAST(*k.FASTArmor)
+}
+
 func (k *ASReq) Unmarshal(b []byte) error {
 	var m marshalKDCReq
 	_, err := asn1.UnmarshalWithParams(b, &m, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.ASREQ))
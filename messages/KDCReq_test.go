@@ -4,9 +4,16 @@ import (
 	"encoding/hex"
 	"fmt"
 	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/config"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
 	"github.com/jcmturner/gokrb5/iana/msgtype"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/iana/patype"
 	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
 	"github.com/stretchr/testify/assert"
+	"net"
 	"testing"
 	"time"
 )
@@ -425,3 +432,128 @@ func TestMarshalTGSReq(t *testing.T) {
 	assert.Equal(t, b, mb, "Marshal bytes of TGSReq not as expected")
 }
 
+
+func TestNewAnonymousASReq(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	a := NewAnonymousASReq(c, "TEST.GOKRB5")
+	assert.True(t, a.ReqBody.CName.IsAnonymous(), "CName is not the anonymous principal")
+	assert.Equal(t, "TEST.GOKRB5", a.ReqBody.Realm, "Realm not as expected")
+	assert.Equal(t, []string{"krbtgt", "TEST.GOKRB5"}, a.ReqBody.SName.NameString, "SName not as expected")
+	assert.True(t, types.IsFlagSet(&a.ReqBody.KDCOptions, types.RequestAnonymous), "Request anonymous option not set")
+	assert.False(t, types.IsFlagSet(&c.LibDefaults.Kdc_default_options, types.RequestAnonymous), "Request anonymous option set in the configuration's default options")
+}
+
+func TestNewASReq_addresses(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	a := NewASReq(c, "testuser1")
+	assert.Equal(t, 0, len(a.ReqBody.Addresses), "Addresses should not be set when noaddresses is true")
+	c.LibDefaults.Noaddresses = false
+	c.LibDefaults.Extra_addresses = []net.IP{net.ParseIP("10.80.88.1")}
+	a = NewASReq(c, "testuser1")
+	h, _ := types.NewHostAddressIPv4(net.ParseIP("10.80.88.1"))
+	assert.True(t, types.HostAddressesContains(a.ReqBody.Addresses, h), "Extra address not in request")
+}
+
+func TestASReq_SetPACRequest(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	a := NewASReq(c, "testuser1")
+	err := a.SetPACRequest(false)
+	if err != nil {
+		t.Fatalf("Error setting PA-PAC-REQUEST: %v", err)
+	}
+	assert.True(t, a.PAData.Contains(patype.PA_PAC_REQUEST), "PA-PAC-REQUEST not in request")
+	assert.True(t, a.PAData.Contains(patype.PA_REQ_ENC_PA_REP), "PA-REQ-ENC-PA-REP no longer in request")
+}
+
+func TestTGSReq_SetPACOptions_FAST(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	key, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	spn := types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"HTTP", "host.test.gokrb5"}}
+	tkt := types.Ticket{TktVNO: 5, Realm: "TEST.GOKRB5", SName: spn}
+	a, err := NewFASTTGSReq("testuser1", c, tkt, key, spn, false)
+	if err != nil {
+		t.Fatalf("Error creating TGS_REQ: %v", err)
+	}
+	flags := types.NewKrbFlags()
+	types.SetFlag(&flags, types.PACOptionClaims)
+	err = a.SetPACOptions(flags)
+	if err != nil {
+		t.Fatalf("Error setting PA-PAC-OPTIONS: %v", err)
+	}
+	assert.Equal(t, 2, len(a.PAData), "Outer padata not as expected")
+	assert.Equal(t, patype.PA_TGS_REQ, a.PAData[0].PADataType, "PA-TGS-REQ not first in outer padata")
+	assert.Equal(t, patype.PA_FX_FAST, a.PAData[1].PADataType, "PA-FX-FAST not in outer padata")
+	assert.True(t, a.fastPAData.Contains(patype.PA_PAC_OPTIONS), "PA-PAC-OPTIONS not in inner request")
+}
+
+func TestTicketOptions_Apply(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	c.LibDefaults.Forwardable = true
+	f := false
+	st := time.Now().Add(time.Hour).Truncate(time.Second)
+	o := TicketOptions{
+		Lifetime:      time.Minute * 10,
+		RenewLifetime: time.Hour * 2,
+		StartTime:     st,
+		Forwardable:   &f,
+		ETypes:        []int{etype.AES128_CTS_HMAC_SHA1_96},
+	}
+	a := NewASReq(c, "testuser1")
+	assert.True(t, types.IsFlagSet(&a.ReqBody.KDCOptions, types.Forwardable), "Forwardable option not set from configuration")
+	o.Apply(&a.ReqBody, c)
+	assert.False(t, types.IsFlagSet(&a.ReqBody.KDCOptions, types.Forwardable), "Forwardable option not overridden")
+	assert.True(t, types.IsFlagSet(&a.ReqBody.KDCOptions, types.Renewable), "Renewable option not set")
+	assert.Equal(t, st, a.ReqBody.From, "From not as expected")
+	assert.Equal(t, st.Add(time.Minute*10), a.ReqBody.Till, "Till not as expected")
+	assert.Equal(t, st.Add(time.Hour*2), a.ReqBody.RTime, "RTime not as expected")
+	assert.Equal(t, []int{etype.AES128_CTS_HMAC_SHA1_96}, a.ReqBody.EType, "ETypes not as expected")
+	assert.False(t, types.IsFlagSet(&c.LibDefaults.Kdc_default_options, types.Forwardable), "Options applied to the configuration's default options")
+}
+
+func TestTicketOptions_Apply_postdated(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	a := NewASReq(c, "testuser1")
+	TicketOptions{StartTime: time.Now().Add(time.Hour * 8)}.Apply(&a.ReqBody, c)
+	assert.True(t, types.IsFlagSet(&a.ReqBody.KDCOptions, types.PostDated), "Postdated option not set")
+	assert.True(t, types.IsFlagSet(&a.ReqBody.KDCOptions, types.AllowPostDate), "Allow postdate option not set")
+	a = NewASReq(c, "testuser1")
+	TicketOptions{Validate: true}.Apply(&a.ReqBody, c)
+	assert.False(t, types.IsFlagSet(&a.ReqBody.KDCOptions, types.PostDated), "Postdated option should not be set")
+	assert.True(t, types.IsFlagSet(&a.ReqBody.KDCOptions, types.Validate), "Validate option not set")
+}
+
+func TestTicketOptions_Apply_forwarded(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	a := NewASReq(c, "testuser1")
+	h, _ := types.NewHostAddressIPv4(net.ParseIP("10.80.88.1"))
+	TicketOptions{Forwarded: true, Addresses: []types.HostAddress{h}}.Apply(&a.ReqBody, c)
+	assert.True(t, types.IsFlagSet(&a.ReqBody.KDCOptions, types.Forwarded), "Forwarded option not set")
+	assert.False(t, types.IsFlagSet(&a.ReqBody.KDCOptions, types.Proxy), "Proxy option should not be set")
+	assert.Equal(t, []types.HostAddress{h}, a.ReqBody.Addresses, "Addresses not as expected")
+}
+
+func TestNewUser2UserTGSReq(t *testing.T) {
+	c, _ := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	key, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	tgt := types.Ticket{TktVNO: 5, Realm: "TEST.GOKRB5", SName: types.PrincipalName{NameType: nametype.KRB_NT_SRV_INST, NameString: []string{"krbtgt", "TEST.GOKRB5"}}}
+	peerTGT := types.Ticket{TktVNO: 5, Realm: "TEST.GOKRB5", SName: tgt.SName, EncPart: types.EncryptedData{EType: etype.AES256_CTS_HMAC_SHA1_96, Cipher: []byte("peer")}}
+	spn := types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"testuser2"}}
+	a, err := NewUser2UserTGSReq("testuser1", c, tgt, key, spn, false, peerTGT)
+	if err != nil {
+		t.Fatalf("Error creating user-to-user TGS_REQ: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&a.ReqBody.KDCOptions, types.EncTktInSkey), "ENC-TKT-IN-SKEY option not set")
+	assert.Equal(t, 1, len(a.ReqBody.AdditionalTickets), "Additional tickets not as expected")
+	assert.Equal(t, peerTGT.EncPart.Cipher, a.ReqBody.AdditionalTickets[0].EncPart.Cipher, "Peer's TGT not in the additional tickets")
+	b, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling user-to-user TGS_REQ: %v", err)
+	}
+	var u TGSReq
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling user-to-user TGS_REQ: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&u.ReqBody.KDCOptions, types.EncTktInSkey), "ENC-TKT-IN-SKEY option not set after marshalling")
+	assert.Equal(t, 1, len(u.ReqBody.AdditionalTickets), "Additional tickets not as expected after marshalling")
+}
@@ -3,7 +3,9 @@ package messages
 import (
 	"fmt"
 	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/asn1tools"
 	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana"
 	"github.com/jcmturner/gokrb5/iana/asnAppTag"
 	"github.com/jcmturner/gokrb5/iana/keyusage"
 	"github.com/jcmturner/gokrb5/iana/msgtype"
@@ -44,11 +46,56 @@ type KrbCredInfo struct {
 	StartTime time.Time           `asn1:"generalized,optional,explicit,tag:5"`
 	EndTime   time.Time           `asn1:"generalized,optional,explicit,tag:6"`
 	RenewTill time.Time           `asn1:"generalized,optional,explicit,tag:7"`
-	SRealm    string              `asn1:"optional,explicit,ia5,tag:8"`
+	SRealm    string              `asn1:"generalstring,optional,explicit,tag:8"`
 	SName     types.PrincipalName `asn1:"optional,explicit,tag:9"`
 	CAddr     types.HostAddresses `asn1:"optional,explicit,tag:10"`
 }
 
+// Create a new KRB_CRED to pass the tickets provided to another party.
+// The KrbCredInfo for each ticket, carrying its session key, is encrypted in the key provided, for example the session
+// or sub-session key of the AP exchange with the party receiving the credentials. The timestamp is set to the time
+// provided, which should be the current time as given by the Config's Now method. Ref: RFC 4120 Section 3.6
+func NewKRBCred(tkts []types.Ticket, info []KrbCredInfo, key types.EncryptionKey, ctime time.Time) (KRBCred, error) {
+	t := ctime.UTC()
+	k := KRBCred{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_CRED,
+		Tickets: tkts,
+		DecryptedEncPart: EncKrbCredPart{
+			TicketInfo: info,
+			Timestamp:  t,
+			Usec:       int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
+		},
+	}
+	b, err := k.DecryptedEncPart.Marshal()
+	if err != nil {
+		return k, err
+	}
+	k.EncPart, err = crypto.GetEncryptedData(b, key, keyusage.KRB_CRED_ENCPART, 0)
+	if err != nil {
+		return k, fmt.Errorf("Error encrypting KRB_CRED encrypted part: %v", err)
+	}
+	return k, nil
+}
+
+// Create the KrbCredInfo for a ticket from the client's principal and the encrypted part of the KDC reply it was
+// issued in.
+func NewKrbCredInfo(crealm string, cname types.PrincipalName, encPart EncKDCRepPart) KrbCredInfo {
+	return KrbCredInfo{
+		Key:       encPart.Key,
+		PRealm:    crealm,
+		PName:     cname,
+		Flags:     encPart.Flags,
+		AuthTime:  encPart.AuthTime,
+		StartTime: encPart.StartTime,
+		EndTime:   encPart.EndTime,
+		RenewTill: encPart.RenewTill,
+		SRealm:    encPart.SRealm,
+		SName:     encPart.SName,
+		CAddr:     encPart.CAddr,
+	}
+}
+
 func (k *KRBCred) Unmarshal(b []byte) error {
 	var m marshalKRBCred
 	_, err := asn1.UnmarshalWithParams(b, &m, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.KRBCred))
@@ -96,3 +143,33 @@ func (k *EncKrbCredPart) Unmarshal(b []byte) error {
 	}
 	return nil
 }
+
+func (k *KRBCred) Marshal() ([]byte, error) {
+	m := marshalKRBCred{
+		PVNO:    k.PVNO,
+		MsgType: k.MsgType,
+		EncPart: k.EncPart,
+	}
+	rawtkts, err := types.MarshalTicketSequence(k.Tickets)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling tickets within KRB_CRED: %v", err)
+	}
+	//The asn1.rawValue needs the tag setting on it for where it is in the KRB_CRED
+	rawtkts.Tag = 2
+	m.Tickets = rawtkts
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return b, fmt.Errorf("Error marshalling KRB_CRED: %v", err)
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.KRBCred)
+	return b, nil
+}
+
+func (k *EncKrbCredPart) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return b, fmt.Errorf("Error marshalling KRB_CRED encrypted part: %v", err)
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncKrbCredPart)
+	return b, nil
+}
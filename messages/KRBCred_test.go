@@ -3,8 +3,12 @@ package messages
 import (
 	"encoding/hex"
 	"fmt"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
 	"github.com/jcmturner/gokrb5/iana/msgtype"
+	"github.com/jcmturner/gokrb5/iana/nametype"
 	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -126,3 +130,61 @@ func TestUnmarshalEncCredPart_optionalsNULL(t *testing.T) {
 		assert.Equal(t, "12d00023", hex.EncodeToString(addr.Address), fmt.Sprintf("Host address not as expected for address item %d within ticket info %d", j+1, i+1))
 	}
 }
+
+func TestMarshalKRBCred(t *testing.T) {
+	var a KRBCred
+	v := "encode_krb5_cred"
+	b, err := hex.DecodeString(testdata.TestVectors[v])
+	if err != nil {
+		t.Fatalf("Test vector read error of %s: %v\n", v, err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal of %s errored: %v", v, err)
+	}
+	assert.Equal(t, b, mb, "Marshal bytes of KRB_CRED not as expected")
+}
+
+func TestNewKRBCred(t *testing.T) {
+	var a KRBCred
+	v := "encode_krb5_cred"
+	b, _ := hex.DecodeString(testdata.TestVectors[v])
+	err := a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error of %s: %v\n", v, err)
+	}
+	key, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	tktKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	info := KrbCredInfo{
+		Key:    tktKey,
+		PRealm: testdata.TEST_REALM,
+		PName:  types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"testuser1"}},
+		SRealm: testdata.TEST_REALM,
+		SName:  a.Tickets[0].SName,
+	}
+	k, err := NewKRBCred(a.Tickets[:1], []KrbCredInfo{info}, key, time.Now())
+	if err != nil {
+		t.Fatalf("Error creating KRB_CRED: %v", err)
+	}
+	mb, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling KRB_CRED: %v", err)
+	}
+	var u KRBCred
+	err = u.Unmarshal(mb)
+	if err != nil {
+		t.Fatalf("Error unmarshalling KRB_CRED: %v", err)
+	}
+	err = u.DecryptEncPart(key.KeyValue)
+	if err != nil {
+		t.Fatalf("Error decrypting KRB_CRED: %v", err)
+	}
+	assert.Equal(t, 1, len(u.Tickets), "Number of tickets not as expected")
+	assert.Equal(t, 1, len(u.DecryptedEncPart.TicketInfo), "Number of ticket info items not as expected")
+	assert.Equal(t, tktKey, u.DecryptedEncPart.TicketInfo[0].Key, "Ticket session key not as expected")
+	assert.Equal(t, testdata.TEST_REALM, u.DecryptedEncPart.TicketInfo[0].SRealm, "SRealm not as expected")
+}
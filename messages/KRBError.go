@@ -5,6 +5,7 @@ import (
 	"github.com/jcmturner/asn1"
 	"github.com/jcmturner/gokrb5/iana/asnAppTag"
 	"github.com/jcmturner/gokrb5/iana/msgtype"
+	"github.com/jcmturner/gokrb5/iana/patype"
 	"github.com/jcmturner/gokrb5/types"
 	"time"
 )
@@ -40,3 +41,41 @@ func (k *KRBError) Unmarshal(b []byte) error {
 func (k KRBError) Error() string {
 	return fmt.Sprintf("KRB Error: %d - %s", k.ErrorCode, k.EText)
 }
+
+// Get the error returned by the KDC in response to a FAST armored request.
+// A KDC returns the actual error in the PA-FX-ERROR of the FAST response within the e-data of the outer KRB_ERROR.
+// The e-data of the error returned is set to the padata from the FAST response, such as PA-FX-COOKIE and
+// PA-ETYPE-INFO2, so that it can be processed as METHOD-DATA.
+func (k *KRBError) UnwrapFAST(armor FASTArmor, nonce int) (KRBError, error) {
+	var krberr KRBError
+	var pas types.PADataSequence
+	err := pas.Unmarshal(k.EData)
+	if err != nil {
+		return krberr, fmt.Errorf("KRB_ERROR is not FAST protected, could not unmarshal e-data: %v. %v", err, *k)
+	}
+	r, err := armor.decryptResponse(pas, nonce)
+	if err != nil {
+		return krberr, fmt.Errorf("Error processing FAST protected KRB_ERROR: %v. %v", err, *k)
+	}
+	var eb []byte
+	var mpas types.PADataSequence
+	for _, pa := range r.PAData {
+		if pa.PADataType == patype.PA_FX_ERROR {
+			eb = pa.PADataValue
+			continue
+		}
+		mpas = append(mpas, pa)
+	}
+	if len(eb) < 1 {
+		return krberr, fmt.Errorf("FAST response does not contain a PA-FX-ERROR. %v", *k)
+	}
+	err = krberr.Unmarshal(eb)
+	if err != nil {
+		return krberr, fmt.Errorf("Error unmarshalling PA-FX-ERROR: %v", err)
+	}
+	krberr.EData, err = asn1.Marshal(mpas)
+	if err != nil {
+		return krberr, fmt.Errorf("Error marshalling FAST response padata: %v", err)
+	}
+	return krberr, nil
+}
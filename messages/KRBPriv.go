@@ -3,7 +3,11 @@ package messages
 import (
 	"fmt"
 	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/asn1tools"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana"
 	"github.com/jcmturner/gokrb5/iana/asnAppTag"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
 	"github.com/jcmturner/gokrb5/iana/msgtype"
 	"github.com/jcmturner/gokrb5/types"
 	"time"
@@ -43,3 +47,66 @@ func (k *EncKrbPrivPart) Unmarshal(b []byte) error {
 	}
 	return nil
 }
+
+// Create a new KRB_PRIV carrying the user data encrypted in the key provided.
+// The sequence number and sender's address are set in the encrypted part along with the time provided, which should
+// be the current time as given by the Config's Now method.
+func NewKRBPriv(userData []byte, seq int, sAddress types.HostAddress, key types.EncryptionKey, ctime time.Time) (KRBPriv, error) {
+	k := KRBPriv{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_PRIV,
+	}
+	t := ctime.UTC()
+	e := EncKrbPrivPart{
+		UserData:       userData,
+		Timestamp:      t,
+		Usec:           int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
+		SequenceNumber: seq,
+		SAddress:       sAddress,
+	}
+	b, err := e.Marshal()
+	if err != nil {
+		return k, err
+	}
+	k.EncPart, err = crypto.GetEncryptedData(b, key, keyusage.KRB_PRIV_ENCPART, 0)
+	if err != nil {
+		return k, fmt.Errorf("Error encrypting KRB_PRIV encrypted part: %v", err)
+	}
+	return k, nil
+}
+
+// Decrypt the encrypted part of the KRB_PRIV with the key provided.
+func (k *KRBPriv) DecryptEncPart(key types.EncryptionKey) (EncKrbPrivPart, error) {
+	var e EncKrbPrivPart
+	etype, err := crypto.GetEtype(k.EncPart.EType)
+	if err != nil {
+		return e, fmt.Errorf("Error getting encryption type: %v", err)
+	}
+	b, err := crypto.DecryptEncPart(key.KeyValue, k.EncPart, etype, keyusage.KRB_PRIV_ENCPART)
+	if err != nil {
+		return e, fmt.Errorf("Error decrypting KRB_PRIV EncPart: %v", err)
+	}
+	err = e.Unmarshal(b)
+	if err != nil {
+		return e, fmt.Errorf("Error unmarshalling KRB_PRIV encrypted part: %v", err)
+	}
+	return e, nil
+}
+
+func (k *KRBPriv) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return b, fmt.Errorf("Error marshalling KRB_PRIV: %v", err)
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.KRBPriv)
+	return b, nil
+}
+
+func (k *EncKrbPrivPart) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return b, fmt.Errorf("Error marshalling KRB_PRIV encrypted part: %v", err)
+	}
+	b = asn1tools.AddASNAppTag(b, asnAppTag.EncKrbPrivPart)
+	return b, nil
+}
@@ -2,8 +2,11 @@ package messages
 
 import (
 	"encoding/hex"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
 	"github.com/jcmturner/gokrb5/iana/msgtype"
 	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
 	"github.com/stretchr/testify/assert"
 	"testing"
 	"time"
@@ -66,3 +69,29 @@ func TestUnmarshalEncPrivPart_optionalsNULL(t *testing.T) {
 	assert.Equal(t, 2, a.SAddress.AddrType, "SAddress type not as expected")
 	assert.Equal(t, "12d00023", hex.EncodeToString(a.SAddress.Address), "Address not as expected for SAddress")
 }
+
+func TestNewKRBPriv(t *testing.T) {
+	key, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	addr := types.HostAddress{AddrType: 2, Address: []byte{10, 80, 88, 88}}
+	p, err := NewKRBPriv([]byte("krb5data"), 17, addr, key, time.Now())
+	if err != nil {
+		t.Fatalf("Error creating KRB_PRIV: %v", err)
+	}
+	b, err := p.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling KRB_PRIV: %v", err)
+	}
+	var u KRBPriv
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling KRB_PRIV: %v", err)
+	}
+	e, err := u.DecryptEncPart(key)
+	if err != nil {
+		t.Fatalf("Error decrypting KRB_PRIV: %v", err)
+	}
+	assert.Equal(t, "krb5data", string(e.UserData), "User data not as expected")
+	assert.Equal(t, 17, e.SequenceNumber, "Sequence number not as expected")
+	assert.Equal(t, addr, e.SAddress, "SAddress not as expected")
+	assert.True(t, time.Since(e.Timestamp) < time.Minute, "Timestamp not as expected")
+}
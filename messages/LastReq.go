@@ -0,0 +1,51 @@
+package messages
+
+import (
+	"github.com/jcmturner/gokrb5/iana/lrtype"
+	"time"
+)
+
+// Last request information from the encrypted part of a KDC reply interpreted into typed values.
+// A zero time means the KDC did not provide the value.
+type LastReqInfo struct {
+	LastInitialTGTRequest time.Time
+	LastInitialRequest    time.Time
+	NewestTGTIssue        time.Time
+	LastRenewal           time.Time
+	LastRequest           time.Time
+	PasswordExpiration    time.Time
+	AccountExpiration     time.Time
+}
+
+// Interpret the last request information in the encrypted part of the KDC reply.
+// Information for only the responding server, indicated by a negative type, is included.
+// If the KDC did not provide a password expiration the key expiration is used in its place. Ref: RFC 4120 Section 5.4.2
+func (e *EncKDCRepPart) LastReqInfo() LastReqInfo {
+	var l LastReqInfo
+	for _, lr := range e.LastReqs {
+		t := lr.LRType
+		if t < 0 {
+			t = -t
+		}
+		switch t {
+		case lrtype.LAST_INITIAL_TGT_REQ:
+			l.LastInitialTGTRequest = lr.LRValue
+		case lrtype.LAST_INITIAL_REQ:
+			l.LastInitialRequest = lr.LRValue
+		case lrtype.NEWEST_TGT_ISSUE:
+			l.NewestTGTIssue = lr.LRValue
+		case lrtype.LAST_RENEWAL:
+			l.LastRenewal = lr.LRValue
+		case lrtype.LAST_REQ:
+			l.LastRequest = lr.LRValue
+		case lrtype.PW_EXPTIME:
+			l.PasswordExpiration = lr.LRValue
+		case lrtype.ACCT_EXPTIME:
+			l.AccountExpiration = lr.LRValue
+		}
+	}
+	if l.PasswordExpiration.IsZero() {
+		l.PasswordExpiration = e.KeyExpiration
+	}
+	return l
+}
@@ -0,0 +1,32 @@
+package messages
+
+import (
+	"github.com/jcmturner/gokrb5/iana/lrtype"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEncKDCRepPart_LastReqInfo(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	e := EncKDCRepPart{
+		LastReqs: []LastReq{
+			{LRType: lrtype.NONE, LRValue: now},
+			{LRType: lrtype.LAST_INITIAL_TGT_REQ, LRValue: now.Add(-time.Hour)},
+			{LRType: -lrtype.LAST_REQ, LRValue: now.Add(-time.Minute)},
+			{LRType: lrtype.PW_EXPTIME, LRValue: now.Add(72 * time.Hour)},
+			{LRType: lrtype.ACCT_EXPTIME, LRValue: now.Add(720 * time.Hour)},
+		},
+		KeyExpiration: now.Add(24 * time.Hour),
+	}
+	l := e.LastReqInfo()
+	assert.Equal(t, now.Add(-time.Hour), l.LastInitialTGTRequest, "Last initial TGT request not as expected")
+	assert.Equal(t, now.Add(-time.Minute), l.LastRequest, "Last request for the server not as expected")
+	assert.Equal(t, now.Add(72*time.Hour), l.PasswordExpiration, "Password expiration not as expected")
+	assert.Equal(t, now.Add(720*time.Hour), l.AccountExpiration, "Account expiration not as expected")
+	assert.True(t, l.LastRenewal.IsZero(), "Last renewal should not be set")
+
+	e.LastReqs = nil
+	l = e.LastReqInfo()
+	assert.Equal(t, now.Add(24*time.Hour), l.PasswordExpiration, "Key expiration should be used for the password expiration")
+}
@@ -0,0 +1,206 @@
+// One-time password (OTP) pre-authentication for Kerberos clients.
+// OTP pre-authentication must be carried within FAST and the armor key is used as the reply key.
+// Ref: RFC 6560
+package otp
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/types"
+	"time"
+)
+
+// OTP flags.
+const (
+	FlagReserved            = 0
+	FlagNextOTP             = 1
+	FlagCombine             = 2
+	FlagCollectPIN          = 3
+	FlagDoNotCollectPIN     = 4
+	FlagMustEncryptNonce    = 5
+	FlagSeparatePINRequired = 6
+	FlagCheckDigit          = 7
+)
+
+// OTP formats.
+const (
+	FormatDecimal      = 0
+	FormatHexadecimal  = 1
+	FormatAlphanumeric = 2
+	FormatBinary       = 3
+	FormatBase64       = 4
+)
+
+type PAOTPChallenge struct {
+	Nonce     []byte      `asn1:"explicit,tag:0"`
+	Service   string      `asn1:"utf8,explicit,optional,tag:1"`
+	TokenInfo []TokenInfo `asn1:"explicit,tag:2"`
+	Salt      string      `asn1:"generalstring,explicit,optional,tag:3"`
+	S2KParams []byte      `asn1:"explicit,optional,tag:4"`
+}
+
+// Information about an OTP token the KDC will accept.
+// Optional integer fields that are absent are zero.
+type TokenInfo struct {
+	Flags            asn1.BitString        `asn1:"explicit,tag:0"`
+	Vendor           string                `asn1:"utf8,explicit,optional,tag:1"`
+	Challenge        []byte                `asn1:"explicit,optional,tag:2"`
+	Length           int                   `asn1:"explicit,optional,tag:3"`
+	Format           int                   `asn1:"explicit,optional,tag:4"`
+	TokenID          []byte                `asn1:"explicit,optional,tag:5"`
+	AlgID            string                `asn1:"utf8,explicit,optional,tag:6"`
+	SupportedHashAlg []algorithmIdentifier `asn1:"explicit,optional,tag:7"`
+	IterationCount   int                   `asn1:"explicit,optional,tag:8"`
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+// PA-OTP-REQUEST. The hash, iteration count, time and counter fields are not used by this client.
+type PAOTPRequest struct {
+	Flags     asn1.BitString      `asn1:"explicit,tag:0"`
+	Nonce     []byte              `asn1:"explicit,optional,tag:1"`
+	EncData   types.EncryptedData `asn1:"explicit,tag:2"`
+	Value     []byte              `asn1:"explicit,optional,tag:5"`
+	PIN       string              `asn1:"utf8,explicit,optional,tag:6"`
+	Challenge []byte              `asn1:"explicit,optional,tag:7"`
+	Format    int                 `asn1:"explicit,optional,tag:10"`
+	TokenID   []byte              `asn1:"explicit,optional,tag:11"`
+	AlgID     string              `asn1:"utf8,explicit,optional,tag:12"`
+	Vendor    string              `asn1:"utf8,explicit,optional,tag:13"`
+}
+
+type PAOTPEncRequest struct {
+	Nonce []byte `asn1:"explicit,tag:0"`
+}
+
+// The user's response to the OTP challenge.
+type Response struct {
+	// Index of the token the value is for within the tokens passed to the Prompter.
+	Token int
+	// The one-time password.
+	Value string
+	// The token's PIN. This must be set for tokens with the collect-pin or separate-pin-required flag and must not be
+	// set for tokens with the do-not-collect-pin flag.
+	PIN string
+}
+
+// Callback to get the one-time password from the user.
+// The service name from the KDC's challenge and the tokens the KDC will accept are provided. The prompter selects the
+// token to use, for example by asking the user, and returns its value.
+// The token flags indicate if a PIN is to be collected.
+type Prompter func(service string, tokens []TokenInfo) (Response, error)
+
+// Unmarshal bytes b into the PAOTPChallenge struct.
+func (c *PAOTPChallenge) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, c)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling PA-OTP-CHALLENGE: %v", err)
+	}
+	return nil
+}
+
+// Unmarshal bytes b into the PAOTPRequest struct.
+func (r *PAOTPRequest) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, r)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling PA-OTP-REQUEST: %v", err)
+	}
+	return nil
+}
+
+// Create the PA-OTP-REQUEST padata in response to the PA-OTP-CHALLENGE value from the KDC.
+// The prompter is called with the tokens the KDC offers for the one-time password. Tokens with the must-encrypt-nonce
+// flag set are not supported and are not offered to the prompter. The KDC's nonce, or the current time if the KDC did
+// not send a nonce, is encrypted in the FAST armor key.
+func NewRequestPAData(challenge []byte, armorKey types.EncryptionKey, prompter Prompter) (types.PAData, error) {
+	return NewRequestPADataAt(challenge, armorKey, prompter, time.Now())
+}
+
+// Create the PA-OTP-REQUEST padata as NewRequestPAData does, encrypting the time provided rather than the current time
+// if the KDC did not send a nonce. This is for example the current time corrected by the offset of the KDC's clock.
+func NewRequestPADataAt(challenge []byte, armorKey types.EncryptionKey, prompter Prompter, now time.Time) (types.PAData, error) {
+	var pa types.PAData
+	var c PAOTPChallenge
+	err := c.Unmarshal(challenge)
+	if err != nil {
+		return pa, err
+	}
+	if len(c.TokenInfo) < 1 {
+		return pa, errors.New("PA-OTP-CHALLENGE does not contain any token information")
+	}
+	var tokens []TokenInfo
+	for _, ti := range c.TokenInfo {
+		// The OTP value would need to be generated from the nonce encrypted in the client's long term key
+		if !types.IsFlagSet(&ti.Flags, FlagMustEncryptNonce) {
+			tokens = append(tokens, ti)
+		}
+	}
+	if len(tokens) < 1 {
+		return pa, errors.New("PA-OTP-CHALLENGE only offers tokens with the must-encrypt-nonce flag, which is not supported")
+	}
+	resp, err := prompter(c.Service, tokens)
+	if err != nil {
+		return pa, fmt.Errorf("Error getting one-time password: %v", err)
+	}
+	if resp.Token < 0 || resp.Token >= len(tokens) {
+		return pa, fmt.Errorf("OTP prompter selected token %d but only %d tokens were offered", resp.Token, len(tokens))
+	}
+	ti := tokens[resp.Token]
+	err = checkPIN(ti, resp.PIN)
+	if err != nil {
+		return pa, err
+	}
+	var b []byte
+	if len(c.Nonce) > 0 {
+		b, err = asn1.Marshal(PAOTPEncRequest{Nonce: c.Nonce})
+		if err != nil {
+			return pa, fmt.Errorf("Error marshalling PA-OTP-ENC-REQUEST: %v", err)
+		}
+	} else {
+		b, err = types.GetPAEncTSEncAsnMarshalledAt(now)
+		if err != nil {
+			return pa, err
+		}
+	}
+	ed, err := crypto.GetEncryptedData(b, armorKey, keyusage.KEY_USAGE_PA_OTP_REQUEST, 0)
+	if err != nil {
+		return pa, fmt.Errorf("Error encrypting PA-OTP-REQUEST nonce: %v", err)
+	}
+	r := PAOTPRequest{
+		Flags:   types.NewKrbFlags(),
+		EncData: ed,
+		Value:   []byte(resp.Value),
+		PIN:     resp.PIN,
+		Format:  ti.Format,
+		TokenID: ti.TokenID,
+		AlgID:   ti.AlgID,
+		Vendor:  ti.Vendor,
+	}
+	b, err = asn1.Marshal(r)
+	if err != nil {
+		return pa, fmt.Errorf("Error marshalling PA-OTP-REQUEST: %v", err)
+	}
+	pa = types.PAData{
+		PADataType:  patype.PA_OTP_REQUEST,
+		PADataValue: b,
+	}
+	return pa, nil
+}
+
+// Check the PIN provided satisfies the token's flags.
+func checkPIN(ti TokenInfo, pin string) error {
+	if pin == "" && (types.IsFlagSet(&ti.Flags, FlagCollectPIN) || types.IsFlagSet(&ti.Flags, FlagSeparatePINRequired)) {
+		return errors.New("OTP token requires a PIN but none was provided")
+	}
+	if pin != "" && types.IsFlagSet(&ti.Flags, FlagDoNotCollectPIN) {
+		return errors.New("OTP token does not accept a PIN but one was provided")
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package otp
+
+import (
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func testChallenge(t *testing.T, nonce []byte, tis []TokenInfo) []byte {
+	b, err := asn1.Marshal(PAOTPChallenge{
+		Nonce:     nonce,
+		Service:   "Test OTP service",
+		TokenInfo: tis,
+	})
+	if err != nil {
+		t.Fatalf("Error marshalling PA-OTP-CHALLENGE: %v", err)
+	}
+	return b
+}
+
+// Process the PA-OTP-REQUEST as the KDC would and return the request and decrypted data.
+func testKDC(t *testing.T, pa types.PAData, armorKey types.EncryptionKey) (PAOTPRequest, []byte) {
+	assert.Equal(t, patype.PA_OTP_REQUEST, pa.PADataType, "Padata type not as expected")
+	var r PAOTPRequest
+	err := r.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("Error unmarshalling PA-OTP-REQUEST: %v", err)
+	}
+	et, _ := crypto.GetEtype(armorKey.KeyType)
+	b, err := crypto.DecryptEncPart(armorKey.KeyValue, r.EncData, et, keyusage.KEY_USAGE_PA_OTP_REQUEST)
+	if err != nil {
+		t.Fatalf("Error decrypting PA-OTP-REQUEST encData: %v", err)
+	}
+	return r, b
+}
+
+func TestNewRequestPAData(t *testing.T) {
+	armorKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	flags := types.NewKrbFlags()
+	types.SetFlag(&flags, FlagCollectPIN)
+	ti := TokenInfo{
+		Flags:   flags,
+		Vendor:  "Test vendor",
+		Length:  6,
+		Format:  FormatHexadecimal,
+		TokenID: []byte("token1"),
+	}
+	nonce := []byte("kdc nonce")
+	unsupported := types.NewKrbFlags()
+	types.SetFlag(&unsupported, FlagMustEncryptNonce)
+	var service string
+	var hints []TokenInfo
+	prompter := func(s string, tis []TokenInfo) (Response, error) {
+		service, hints = s, tis
+		return Response{Value: "123456", PIN: "1234"}, nil
+	}
+	pa, err := NewRequestPAData(testChallenge(t, nonce, []TokenInfo{{Flags: unsupported}, ti}), armorKey, prompter)
+	if err != nil {
+		t.Fatalf("Error creating PA-OTP-REQUEST: %v", err)
+	}
+	assert.Equal(t, "Test OTP service", service, "Service hint not as expected")
+	if len(hints) != 1 {
+		t.Fatalf("Only the supported token should be offered to the prompter, got %d", len(hints))
+	}
+	hint := hints[0]
+	assert.Equal(t, "Test vendor", hint.Vendor, "Vendor hint not as expected")
+	assert.Equal(t, FormatHexadecimal, hint.Format, "Format hint not as expected")
+	assert.Equal(t, 6, hint.Length, "Length hint not as expected")
+	assert.True(t, types.IsFlagSet(&hint.Flags, FlagCollectPIN), "Collect PIN flag not set in hint")
+
+	r, b := testKDC(t, pa, armorKey)
+	assert.Equal(t, []byte("123456"), r.Value, "OTP value not as expected")
+	assert.Equal(t, "1234", r.PIN, "PIN not as expected")
+	assert.Equal(t, []byte("token1"), r.TokenID, "Token ID not as expected")
+	assert.Equal(t, "Test vendor", r.Vendor, "Vendor not as expected")
+	assert.Equal(t, FormatHexadecimal, r.Format, "Format not as expected")
+	var er PAOTPEncRequest
+	_, err = asn1.Unmarshal(b, &er)
+	if err != nil {
+		t.Fatalf("Error unmarshalling PA-OTP-ENC-REQUEST: %v", err)
+	}
+	assert.Equal(t, nonce, er.Nonce, "Encrypted nonce not as expected")
+}
+
+func TestNewRequestPAData_noNonce(t *testing.T) {
+	armorKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	prompter := func(s string, tis []TokenInfo) (Response, error) {
+		return Response{Value: "123456"}, nil
+	}
+	pa, err := NewRequestPAData(testChallenge(t, nil, []TokenInfo{{Flags: types.NewKrbFlags()}}), armorKey, prompter)
+	if err != nil {
+		t.Fatalf("Error creating PA-OTP-REQUEST: %v", err)
+	}
+	_, b := testKDC(t, pa, armorKey)
+	var ts types.PAEncTSEnc
+	err = ts.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling encrypted timestamp: %v", err)
+	}
+	assert.True(t, time.Since(ts.PATimestamp) < time.Minute, "Encrypted timestamp not as expected")
+}
+
+func TestNewRequestPADataAt(t *testing.T) {
+	armorKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	prompter := func(s string, tis []TokenInfo) (Response, error) {
+		return Response{Value: "123456"}, nil
+	}
+	// The KDC's clock is an hour ahead
+	kdcTime := time.Now().Add(time.Hour)
+	pa, err := NewRequestPADataAt(testChallenge(t, nil, []TokenInfo{{Flags: types.NewKrbFlags()}}), armorKey, prompter, kdcTime)
+	if err != nil {
+		t.Fatalf("Error creating PA-OTP-REQUEST: %v", err)
+	}
+	_, b := testKDC(t, pa, armorKey)
+	var ts types.PAEncTSEnc
+	err = ts.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling encrypted timestamp: %v", err)
+	}
+	assert.True(t, ts.PATimestamp.Sub(kdcTime) < time.Second && kdcTime.Sub(ts.PATimestamp) < time.Second, "Encrypted timestamp not the time provided")
+}
+
+func TestNewRequestPAData_noTokenInfo(t *testing.T) {
+	armorKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	prompter := func(s string, tis []TokenInfo) (Response, error) {
+		t.Errorf("Prompter should not be called")
+		return Response{}, nil
+	}
+	_, err := NewRequestPAData(testChallenge(t, []byte("nonce"), []TokenInfo{}), armorKey, prompter)
+	assert.Error(t, err, "Challenge without token information should not be accepted")
+}
+
+func TestNewRequestPAData_mustEncryptNonce(t *testing.T) {
+	armorKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	flags := types.NewKrbFlags()
+	types.SetFlag(&flags, FlagMustEncryptNonce)
+	prompter := func(s string, tis []TokenInfo) (Response, error) {
+		t.Errorf("Prompter should not be called")
+		return Response{}, nil
+	}
+	_, err := NewRequestPAData(testChallenge(t, []byte("nonce"), []TokenInfo{{Flags: flags}}), armorKey, prompter)
+	assert.Error(t, err, "Challenge with only must-encrypt-nonce tokens should not be accepted")
+}
+
+func TestNewRequestPAData_pin(t *testing.T) {
+	armorKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	var tests = []struct {
+		flag  int
+		pin   string
+		valid bool
+	}{
+		{FlagSeparatePINRequired, "1234", true},
+		{FlagSeparatePINRequired, "", false},
+		{FlagCollectPIN, "", false},
+		{FlagDoNotCollectPIN, "1234", false},
+		{FlagDoNotCollectPIN, "", true},
+	}
+	for _, test := range tests {
+		flags := types.NewKrbFlags()
+		types.SetFlag(&flags, test.flag)
+		prompter := func(s string, tis []TokenInfo) (Response, error) {
+			return Response{Value: "123456", PIN: test.pin}, nil
+		}
+		pa, err := NewRequestPAData(testChallenge(t, []byte("nonce"), []TokenInfo{{Flags: flags}}), armorKey, prompter)
+		if !test.valid {
+			assert.Error(t, err, "PIN %q should not be accepted with flag %d", test.pin, test.flag)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Error creating PA-OTP-REQUEST: %v", err)
+		}
+		r, _ := testKDC(t, pa, armorKey)
+		assert.Equal(t, test.pin, r.PIN, "PIN not as expected with flag %d", test.flag)
+	}
+}
+
+func TestNewRequestPAData_invalidToken(t *testing.T) {
+	armorKey, _ := crypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	prompter := func(s string, tis []TokenInfo) (Response, error) {
+		return Response{Token: 1, Value: "123456"}, nil
+	}
+	_, err := NewRequestPAData(testChallenge(t, []byte("nonce"), []TokenInfo{{Flags: types.NewKrbFlags()}}), armorKey, prompter)
+	assert.Error(t, err, "Selection of a token not offered should not be accepted")
+}
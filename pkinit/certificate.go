@@ -0,0 +1,145 @@
+package pkinit
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/jcmturner/asn1"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	oidPKINITKPKdc    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 5}
+	oidPKINITSAN      = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 2}
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+)
+
+type otherName struct {
+	TypeID asn1.ObjectIdentifier
+	Value  asn1.RawValue // [0] EXPLICIT
+}
+
+// Load the trusted anchors for validating the KDC's certificate.
+// Each anchor is either FILE:path to a file or DIR:path to a directory of PEM encoded certificates.
+func LoadAnchors(anchors []string) (*x509.CertPool, error) {
+	if len(anchors) < 1 {
+		return nil, errors.New("No PKINIT anchors configured")
+	}
+	pool := x509.NewCertPool()
+	for _, a := range anchors {
+		var files []string
+		switch {
+		case strings.HasPrefix(a, "FILE:"):
+			files = append(files, strings.TrimPrefix(a, "FILE:"))
+		case strings.HasPrefix(a, "DIR:"):
+			m, err := filepath.Glob(filepath.Join(strings.TrimPrefix(a, "DIR:"), "*"))
+			if err != nil {
+				return nil, fmt.Errorf("Error listing PKINIT anchors directory %s: %v", a, err)
+			}
+			files = append(files, m...)
+		default:
+			return nil, fmt.Errorf("Unsupported PKINIT anchor type: %s", a)
+		}
+		for _, f := range files {
+			b, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("Error reading PKINIT anchor %s: %v", f, err)
+			}
+			if !pool.AppendCertsFromPEM(b) && strings.HasPrefix(a, "FILE:") {
+				return nil, fmt.Errorf("No certificates found in PKINIT anchor %s", f)
+			}
+		}
+	}
+	return pool, nil
+}
+
+// Verify the KDC's certificate chains to a trusted anchor and that it identifies the KDC of the realm.
+// The certificate must have the id-pkinit-KPKdc extended key usage and either an id-pkinit-san of the realm's krbtgt
+// principal or a DNS name that matches one of the hostnames configured.
+// Ref: RFC 4556 Section 3.2.4
+func verifyKDCCertificate(cert *x509.Certificate, intermediates []*x509.Certificate, anchors *x509.CertPool, realm string, hostnames []string) error {
+	if anchors == nil {
+		return errors.New("No PKINIT anchors to verify the KDC's certificate against")
+	}
+	pool := x509.NewCertPool()
+	for _, c := range intermediates {
+		pool.AddCert(c)
+	}
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         anchors,
+		Intermediates: pool,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("KDC's certificate is not trusted: %v", err)
+	}
+	var kpKdc bool
+	for _, eku := range cert.UnknownExtKeyUsage {
+		if oidPKINITKPKdc.Equal(asn1.ObjectIdentifier(eku)) {
+			kpKdc = true
+		}
+	}
+	if !kpKdc {
+		return errors.New("KDC's certificate does not have the id-pkinit-KPKdc extended key usage")
+	}
+	names, err := pkinitSANs(cert)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if n.Realm == realm && len(n.PrincipalName.NameString) == 2 &&
+			n.PrincipalName.NameString[0] == "krbtgt" && n.PrincipalName.NameString[1] == realm {
+			return nil
+		}
+	}
+	for _, h := range hostnames {
+		for _, d := range cert.DNSNames {
+			if strings.EqualFold(d, h) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("KDC's certificate does not identify the KDC for realm %s", realm)
+}
+
+// Get the Kerberos principal names from the id-pkinit-san subject alternative names of the certificate.
+func pkinitSANs(cert *x509.Certificate) ([]KRB5PrincipalName, error) {
+	var names []KRB5PrincipalName
+	for _, ext := range cert.Extensions {
+		if !oidSubjectAltName.Equal(asn1.ObjectIdentifier(ext.Id)) {
+			continue
+		}
+		// The GeneralNames are context tagged so cannot be unmarshalled into a slice of asn1.RawValue.
+		// Ref: https://github.com/golang/go/issues/17321
+		var seq asn1.RawValue
+		_, err := asn1.Unmarshal(ext.Value, &seq)
+		if err != nil {
+			return nil, fmt.Errorf("Error unmarshalling certificate subject alternative names: %v", err)
+		}
+		for b := seq.Bytes; len(b) > 0; {
+			var gn asn1.RawValue
+			b, err = asn1.Unmarshal(b, &gn)
+			if err != nil {
+				return nil, fmt.Errorf("Error unmarshalling certificate subject alternative name: %v", err)
+			}
+			// otherName [0] IMPLICIT
+			if gn.Class != 2 || gn.Tag != 0 {
+				continue
+			}
+			var on otherName
+			_, err = asn1.UnmarshalWithParams(gn.FullBytes, &on, "tag:0")
+			if err != nil || !on.TypeID.Equal(oidPKINITSAN) {
+				continue
+			}
+			var n KRB5PrincipalName
+			_, err = asn1.Unmarshal(on.Value.Bytes, &n)
+			if err != nil {
+				return nil, fmt.Errorf("Error unmarshalling id-pkinit-san: %v", err)
+			}
+			names = append(names, n)
+		}
+	}
+	return names, nil
+}
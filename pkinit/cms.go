@@ -0,0 +1,403 @@
+package pkinit
+
+// Reference: https://www.ietf.org/rfc/rfc5652.txt
+// Section: 5
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/jcmturner/asn1"
+	"math/big"
+	"sort"
+)
+
+var (
+	oidSignedData           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttributeContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMsgDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA1                 = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512               = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSAEncryption        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA1WithRSA          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECPublicKey          = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA1        = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSAWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512      = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue // SET OF AlgorithmIdentifier
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     []asn1.RawValue `asn1:"optional,set,tag:0"`
+	CRLs             []asn1.RawValue `asn1:"optional,set,tag:1"`
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    algorithmIdentifier
+	SignedAttrs        []asn1.RawValue `asn1:"optional,set,tag:0"`
+	SignatureAlgorithm algorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      []asn1.RawValue `asn1:"optional,set,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue // SET OF
+}
+
+// Create a CMS SignedData ContentInfo encapsulating the content provided.
+// If a certificate and private key are provided the content is signed by them using SHA256. Otherwise the SignedData
+// has no signers, as is used by anonymous PKINIT.
+func signData(content []byte, contentType asn1.ObjectIdentifier, cert *x509.Certificate, key crypto.Signer) ([]byte, error) {
+	sd := signedData{
+		Version: 3,
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: contentType,
+			EContent:     content,
+		},
+		DigestAlgorithms: asn1.RawValue{Tag: 17, IsCompound: true},
+		SignerInfos:      []asn1.RawValue{},
+	}
+	if cert != nil && key != nil {
+		si, err := newSignerInfo(content, contentType, cert, key)
+		if err != nil {
+			return nil, err
+		}
+		// The fork of asn1 would apply the set parameter to each AlgorithmIdentifier so the SET OF is built explicitly
+		da, err := asn1.Marshal(si.DigestAlgorithm)
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling CMS digest algorithm: %v", err)
+		}
+		sd.DigestAlgorithms.Bytes = da
+		sd.Certificates = []asn1.RawValue{{FullBytes: cert.Raw}}
+		b, err := asn1.Marshal(si)
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling CMS SignerInfo: %v", err)
+		}
+		sd.SignerInfos = append(sd.SignerInfos, asn1.RawValue{FullBytes: b})
+	}
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling CMS SignedData: %v", err)
+	}
+	b, err = asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content: asn1.RawValue{
+			Class:      2,
+			IsCompound: true,
+			Tag:        0,
+			Bytes:      b,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling CMS ContentInfo: %v", err)
+	}
+	return b, nil
+}
+
+// Create the SignerInfo for the content signed with the private key provided.
+func newSignerInfo(content []byte, contentType asn1.ObjectIdentifier, cert *x509.Certificate, key crypto.Signer) (signerInfo, error) {
+	var si signerInfo
+	var sigAlg algorithmIdentifier
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = algorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1.RawValue{Tag: 5}}
+	case *ecdsa.PublicKey:
+		sigAlg = algorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	default:
+		return si, fmt.Errorf("Unsupported private key type for signing: %T", key.Public())
+	}
+	ias, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	})
+	if err != nil {
+		return si, fmt.Errorf("Error marshalling signer identifier: %v", err)
+	}
+	d := crypto.SHA256.New()
+	d.Write(content)
+	attrs, err := newSignedAttributes(contentType, d.Sum(nil))
+	if err != nil {
+		return si, err
+	}
+	h := crypto.SHA256.New()
+	h.Write(signedAttributesBytes(attrs))
+	sig, err := key.Sign(rand.Reader, h.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return si, fmt.Errorf("Error signing content: %v", err)
+	}
+	si = signerInfo{
+		Version:            1,
+		SID:                asn1.RawValue{FullBytes: ias},
+		DigestAlgorithm:    algorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        attrs,
+		SignatureAlgorithm: sigAlg,
+		Signature:          sig,
+	}
+	return si, nil
+}
+
+// Create the content type and message digest signed attributes, sorted as required for a DER SET OF.
+func newSignedAttributes(contentType asn1.ObjectIdentifier, digest []byte) ([]asn1.RawValue, error) {
+	ct, err := asn1.Marshal(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling content type attribute: %v", err)
+	}
+	md, err := asn1.Marshal(digest)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling message digest attribute: %v", err)
+	}
+	var encoded [][]byte
+	for _, a := range []attribute{
+		{Type: oidAttributeContentType, Values: asn1.RawValue{Tag: 17, IsCompound: true, Bytes: ct}},
+		{Type: oidAttributeMsgDigest, Values: asn1.RawValue{Tag: 17, IsCompound: true, Bytes: md}},
+	} {
+		b, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, fmt.Errorf("Error marshalling signed attribute: %v", err)
+		}
+		encoded = append(encoded, b)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	attrs := make([]asn1.RawValue, len(encoded))
+	for i, b := range encoded {
+		attrs[i] = asn1.RawValue{FullBytes: b}
+	}
+	return attrs, nil
+}
+
+// Get the bytes over which the signature is calculated. This is the DER encoding of the signed attributes with the
+// SET OF tag rather than the implicit tag they have within the SignerInfo.
+func signedAttributesBytes(attrs []asn1.RawValue) []byte {
+	var b []byte
+	for _, a := range attrs {
+		b = append(b, a.FullBytes...)
+	}
+	sb, _ := asn1.Marshal(asn1.RawValue{Tag: 17, IsCompound: true, Bytes: b})
+	return sb
+}
+
+// Verify the signature of a CMS SignedData ContentInfo.
+// The encapsulated content, the signer's certificate and all the certificates included in the SignedData are returned.
+// Only the signature is verified, the signer's certificate must be validated by the caller.
+func verifySignedData(b []byte, contentType asn1.ObjectIdentifier) ([]byte, *x509.Certificate, []*x509.Certificate, error) {
+	var ci contentInfo
+	_, err := asn1.Unmarshal(b, &ci)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Error unmarshalling CMS ContentInfo: %v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) || ci.Content.Class != 2 || ci.Content.Tag != 0 {
+		return nil, nil, nil, fmt.Errorf("CMS content is not SignedData: %v", ci.ContentType)
+	}
+	var sd signedData
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Error unmarshalling CMS SignedData: %v", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(contentType) {
+		return nil, nil, nil, fmt.Errorf("CMS SignedData content type not as expected. Expected: %v; Actual: %v", contentType, sd.EncapContentInfo.EContentType)
+	}
+	content := sd.EncapContentInfo.EContent
+	var certs []*x509.Certificate
+	for _, c := range sd.Certificates {
+		cert, err := x509.ParseCertificate(c.FullBytes)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Error parsing certificate in CMS SignedData: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(sd.SignerInfos) < 1 {
+		return nil, nil, nil, errors.New("CMS SignedData is not signed")
+	}
+	var si signerInfo
+	_, err = asn1.Unmarshal(sd.SignerInfos[0].FullBytes, &si)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Error unmarshalling CMS SignerInfo: %v", err)
+	}
+	signer, err := findSigner(si.SID, certs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hash, err := getHash(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = verifySignedAttributes(si.SignedAttrs, contentType, hash, content)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sigAlg, err := getSignatureAlgorithm(si.SignatureAlgorithm.Algorithm, hash)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	err = signer.CheckSignature(sigAlg, signedAttributesBytes(si.SignedAttrs), si.Signature)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("CMS SignedData signature is not valid: %v", err)
+	}
+	return content, signer, certs, nil
+}
+
+// Find the signer's certificate identified by the SignerIdentifier.
+func findSigner(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if sid.Class == 2 && sid.Tag == 0 {
+		// subjectKeyIdentifier
+		for _, c := range certs {
+			if len(c.SubjectKeyId) > 0 && bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c, nil
+			}
+		}
+		return nil, errors.New("Signer's certificate not found in CMS SignedData")
+	}
+	var ias issuerAndSerialNumber
+	_, err := asn1.Unmarshal(sid.FullBytes, &ias)
+	if err != nil {
+		return nil, fmt.Errorf("Error unmarshalling CMS signer identifier: %v", err)
+	}
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+			return c, nil
+		}
+	}
+	return nil, errors.New("Signer's certificate not found in CMS SignedData")
+}
+
+// Verify the content type and message digest signed attributes against the content.
+func verifySignedAttributes(attrs []asn1.RawValue, contentType asn1.ObjectIdentifier, hash crypto.Hash, content []byte) error {
+	if len(attrs) < 1 {
+		return errors.New("CMS SignerInfo does not contain signed attributes")
+	}
+	var ctOK, mdOK bool
+	for _, rv := range attrs {
+		var a attribute
+		_, err := asn1.Unmarshal(rv.FullBytes, &a)
+		if err != nil {
+			return fmt.Errorf("Error unmarshalling CMS signed attribute: %v", err)
+		}
+		switch {
+		case a.Type.Equal(oidAttributeContentType):
+			var ct asn1.ObjectIdentifier
+			_, err = asn1.Unmarshal(a.Values.Bytes, &ct)
+			if err != nil {
+				return fmt.Errorf("Error unmarshalling CMS content type attribute: %v", err)
+			}
+			if !ct.Equal(contentType) {
+				return errors.New("CMS content type attribute does not match the content type")
+			}
+			ctOK = true
+		case a.Type.Equal(oidAttributeMsgDigest):
+			var md []byte
+			_, err = asn1.Unmarshal(a.Values.Bytes, &md)
+			if err != nil {
+				return fmt.Errorf("Error unmarshalling CMS message digest attribute: %v", err)
+			}
+			h := hash.New()
+			h.Write(content)
+			if !bytes.Equal(md, h.Sum(nil)) {
+				return errors.New("CMS message digest attribute does not match the content")
+			}
+			mdOK = true
+		}
+	}
+	if !ctOK || !mdOK {
+		return errors.New("CMS SignerInfo is missing the content type or message digest signed attribute")
+	}
+	return nil
+}
+
+// Get the hash function for the digest algorithm identifier.
+func getHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("Unsupported digest algorithm: %v", oid)
+}
+
+// Get the X.509 signature algorithm for the signature algorithm identifier.
+// Some implementations identify the signature algorithm by the public key algorithm alone in which case the digest
+// algorithm is used to determine the signature algorithm.
+func getSignatureAlgorithm(oid asn1.ObjectIdentifier, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch {
+	case oid.Equal(oidSHA1WithRSA):
+		return x509.SHA1WithRSA, nil
+	case oid.Equal(oidSHA256WithRSA):
+		return x509.SHA256WithRSA, nil
+	case oid.Equal(oidSHA384WithRSA):
+		return x509.SHA384WithRSA, nil
+	case oid.Equal(oidSHA512WithRSA):
+		return x509.SHA512WithRSA, nil
+	case oid.Equal(oidECDSAWithSHA1):
+		return x509.ECDSAWithSHA1, nil
+	case oid.Equal(oidECDSAWithSHA256):
+		return x509.ECDSAWithSHA256, nil
+	case oid.Equal(oidECDSAWithSHA384):
+		return x509.ECDSAWithSHA384, nil
+	case oid.Equal(oidECDSAWithSHA512):
+		return x509.ECDSAWithSHA512, nil
+	case oid.Equal(oidRSAEncryption):
+		switch hash {
+		case crypto.SHA1:
+			return x509.SHA1WithRSA, nil
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case oid.Equal(oidECPublicKey):
+		switch hash {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("Unsupported signature algorithm: %v", oid)
+}
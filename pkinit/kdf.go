@@ -0,0 +1,111 @@
+package pkinit
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/types"
+)
+
+// Key derivation functions from RFC 8636.
+var (
+	oidKDFSHA1   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 6, 1}
+	oidKDFSHA256 = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 6, 2}
+	oidKDFSHA512 = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 6, 3}
+)
+
+// Key derivation functions offered to the KDC in order of preference.
+var supportedKDFs = []asn1.ObjectIdentifier{oidKDFSHA256, oidKDFSHA512, oidKDFSHA1}
+
+// Principal name as used in PKINIT certificates and key derivation.
+type KRB5PrincipalName struct {
+	Realm         string              `asn1:"generalstring,explicit,tag:0"`
+	PrincipalName types.PrincipalName `asn1:"explicit,tag:1"`
+}
+
+type otherInfo struct {
+	AlgorithmID algorithmIdentifier
+	PartyUInfo  []byte `asn1:"explicit,tag:0"`
+	PartyVInfo  []byte `asn1:"explicit,tag:1"`
+	SuppPubInfo []byte `asn1:"explicit,optional,tag:2"`
+}
+
+type pkinitSuppPubInfo struct {
+	EncType int    `asn1:"explicit,tag:0"`
+	ASReq   []byte `asn1:"explicit,tag:1"`
+	PKASRep []byte `asn1:"explicit,tag:2"`
+}
+
+// The octetstring2key function used where the KDC does not select a key derivation function.
+// Ref: RFC 4556 Section 3.2.3.1
+func octetString2Key(x []byte, keyLen int) []byte {
+	var k []byte
+	for i := 0; len(k) < keyLen; i++ {
+		h := sha1.New()
+		h.Write([]byte{byte(i)})
+		h.Write(x)
+		k = h.Sum(k)
+	}
+	return k[:keyLen]
+}
+
+// Get the hash function for the key derivation function identifier.
+func kdfHash(kdfID asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case kdfID.Equal(oidKDFSHA1):
+		return crypto.SHA1, nil
+	case kdfID.Equal(oidKDFSHA256):
+		return crypto.SHA256, nil
+	case kdfID.Equal(oidKDFSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("Unsupported PKINIT key derivation function: %v", kdfID)
+}
+
+// The algorithm agility key derivation function.
+// z is the shared secret, asReq the AS_REQ as sent and pkASRep the PA-PK-AS-REP as received.
+// Ref: RFC 8636 Section 5
+func kdf(kdfID asn1.ObjectIdentifier, z []byte, keyLen int, client, server KRB5PrincipalName, etypeID int, asReq, pkASRep []byte) ([]byte, error) {
+	hash, err := kdfHash(kdfID)
+	if err != nil {
+		return nil, err
+	}
+	u, err := asn1.Marshal(client)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling client principal name for key derivation: %v", err)
+	}
+	v, err := asn1.Marshal(server)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling server principal name for key derivation: %v", err)
+	}
+	spi, err := asn1.Marshal(pkinitSuppPubInfo{
+		EncType: etypeID,
+		ASReq:   asReq,
+		PKASRep: pkASRep,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling supplementary public information for key derivation: %v", err)
+	}
+	oi, err := asn1.Marshal(otherInfo{
+		AlgorithmID: algorithmIdentifier{Algorithm: kdfID},
+		PartyUInfo:  u,
+		PartyVInfo:  v,
+		SuppPubInfo: spi,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling other information for key derivation: %v", err)
+	}
+	var k []byte
+	c := make([]byte, 4)
+	for i := uint32(1); len(k) < keyLen; i++ {
+		binary.BigEndian.PutUint32(c, i)
+		h := hash.New()
+		h.Write(c)
+		h.Write(z)
+		h.Write(oi)
+		k = h.Sum(k)
+	}
+	return k[:keyLen], nil
+}
@@ -0,0 +1,254 @@
+package pkinit
+
+// Reference: https://www.ietf.org/rfc/rfc4556.txt
+// Section: 3.2.3.1
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/jcmturner/asn1"
+	"math/big"
+)
+
+var (
+	oidDHPublicNumber = asn1.ObjectIdentifier{1, 2, 840, 10046, 2, 1}
+	oidP256           = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidP384           = asn1.ObjectIdentifier{1, 3, 132, 0, 34}
+	oidP521           = asn1.ObjectIdentifier{1, 3, 132, 0, 35}
+)
+
+// MODP groups from RFC 3526.
+var (
+	modpGroup14 = newDHGroup(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74" +
+			"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437" +
+			"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05" +
+			"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB" +
+			"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+			"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718" +
+			"3995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF")
+	modpGroup16 = newDHGroup(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74" +
+			"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F1437" +
+			"4FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF05" +
+			"98DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB" +
+			"9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+			"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF695581718" +
+			"3995497CEA956AE515D2261898FA051015728E5A8AAAC42DAD33170D04507A33" +
+			"A85521ABDF1CBA64ECFB850458DBEF0A8AEA71575D060C7DB3970F85A6E1E4C7" +
+			"ABF5AE8CDB0933D71E8C94E04A25619DCEE3D2261AD2EE6BF12FFA06D98A0864" +
+			"D87602733EC86A64521F2B18177B200CBBE117577A615D6C770988C0BAD946E2" +
+			"08E24FA074E5AB3143DB5BFCE0FD108E4B82D120A92108011A723C12A787E6D7" +
+			"88719A10BDBA5B2699C327186AF4E23C1A946834B6150BDA2583E9CA2AD44CE8" +
+			"DBBBC2DB04DE8EF92E8EFC141FBECAA6287C59474E6BC05D99B2964FA090C3A2" +
+			"233BA186515BE7ED1F612970CEE2D7AFB81BDD762170481CD0069127D5B05AA9" +
+			"93B4EA988D8FDDC186FFB7DC90A6C08F4DF435C934063199FFFFFFFFFFFFFFFF")
+)
+
+type subjectPublicKeyInfo struct {
+	Algorithm algorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type domainParameters struct {
+	P *big.Int
+	G *big.Int
+	Q *big.Int
+}
+
+// Key agreement used to establish a shared secret with the KDC.
+type keyAgreement interface {
+	// Get the client's public value to send to the KDC.
+	publicKeyInfo() (subjectPublicKeyInfo, error)
+	// Get the shared secret from the KDC's public value.
+	sharedSecret(kdcPublicValue []byte) ([]byte, error)
+}
+
+// Key agreement groups supported in order of strength.
+// The strength is the size of the MODP group equivalent in bits, as used by pkinit_dh_min_bits.
+var keyAgreementGroups = []keyAgreementGroup{
+	{bits: 2048, dh: &modpGroup14},
+	{bits: 3072, curve: ecdh.P256(), oid: oidP256},
+	{bits: 4096, dh: &modpGroup16},
+	{bits: 7680, curve: ecdh.P384(), oid: oidP384},
+	{bits: 15360, curve: ecdh.P521(), oid: oidP521},
+}
+
+// A Diffie-Hellman or elliptic curve Diffie-Hellman key agreement group.
+type keyAgreementGroup struct {
+	bits  int
+	dh    *dhGroup
+	curve ecdh.Curve
+	oid   asn1.ObjectIdentifier
+}
+
+func (g keyAgreementGroup) newKeyAgreement() (keyAgreement, error) {
+	if g.dh != nil {
+		return newDHKeyAgreement(*g.dh)
+	}
+	return newECDHKeyAgreement(g.curve)
+}
+
+// Check if the algorithm identifier, as offered by the KDC, identifies the group.
+func (g keyAgreementGroup) matches(a algorithmIdentifier) bool {
+	if g.dh != nil {
+		if !a.Algorithm.Equal(oidDHPublicNumber) {
+			return false
+		}
+		var params domainParameters
+		_, err := asn1.Unmarshal(a.Parameters.FullBytes, &params)
+		return err == nil && params.P != nil && params.G != nil && params.P.Cmp(g.dh.p) == 0 && params.G.Cmp(g.dh.g) == 0
+	}
+	if !a.Algorithm.Equal(oidECPublicKey) {
+		return false
+	}
+	var oid asn1.ObjectIdentifier
+	_, err := asn1.Unmarshal(a.Parameters.FullBytes, &oid)
+	return err == nil && oid.Equal(g.oid)
+}
+
+// Create a new key agreement with a fresh private key.
+// The weakest group that is at least minBits strong, as configured by pkinit_dh_min_bits, is used.
+func newKeyAgreement(minBits int) (keyAgreement, error) {
+	for _, g := range keyAgreementGroups {
+		if g.bits >= minBits {
+			return g.newKeyAgreement()
+		}
+	}
+	return nil, fmt.Errorf("No PKINIT key agreement group is at least %d bits strong", minBits)
+}
+
+// Create a new key agreement with a fresh private key using a group offered by the KDC.
+// The offered groups are in the KDC's order of preference and the first supported one that is at least minBits strong
+// is used.
+func newOfferedKeyAgreement(offered []algorithmIdentifier, minBits int) (keyAgreement, error) {
+	for _, a := range offered {
+		for _, g := range keyAgreementGroups {
+			if g.bits >= minBits && g.matches(a) {
+				return g.newKeyAgreement()
+			}
+		}
+	}
+	return nil, fmt.Errorf("KDC did not offer a supported PKINIT key agreement group at least %d bits strong", minBits)
+}
+
+// Diffie-Hellman group with a safe prime modulus.
+type dhGroup struct {
+	p *big.Int
+	g *big.Int
+	q *big.Int
+}
+
+func newDHGroup(prime string) dhGroup {
+	p, _ := new(big.Int).SetString(prime, 16)
+	q := new(big.Int).Rsh(p, 1)
+	return dhGroup{
+		p: p,
+		g: big.NewInt(2),
+		q: q,
+	}
+}
+
+type dhKeyAgreement struct {
+	group dhGroup
+	x     *big.Int
+	y     *big.Int
+}
+
+func newDHKeyAgreement(group dhGroup) (*dhKeyAgreement, error) {
+	// Private exponent in the range 2 to q-1
+	x, err := rand.Int(rand.Reader, new(big.Int).Sub(group.q, big.NewInt(2)))
+	if err != nil {
+		return nil, fmt.Errorf("Error generating Diffie-Hellman private key: %v", err)
+	}
+	x.Add(x, big.NewInt(2))
+	return &dhKeyAgreement{
+		group: group,
+		x:     x,
+		y:     new(big.Int).Exp(group.g, x, group.p),
+	}, nil
+}
+
+func (d *dhKeyAgreement) publicKeyInfo() (subjectPublicKeyInfo, error) {
+	var spki subjectPublicKeyInfo
+	params, err := asn1.Marshal(domainParameters{P: d.group.p, G: d.group.g, Q: d.group.q})
+	if err != nil {
+		return spki, fmt.Errorf("Error marshalling Diffie-Hellman domain parameters: %v", err)
+	}
+	y, err := asn1.Marshal(d.y)
+	if err != nil {
+		return spki, fmt.Errorf("Error marshalling Diffie-Hellman public value: %v", err)
+	}
+	spki = subjectPublicKeyInfo{
+		Algorithm: algorithmIdentifier{
+			Algorithm:  oidDHPublicNumber,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PublicKey: asn1.BitString{
+			Bytes:     y,
+			BitLength: len(y) * 8,
+		},
+	}
+	return spki, nil
+}
+
+// The shared secret is left padded with zeros to the size of the modulus. Ref: RFC 4556 Section 3.2.3.1
+func (d *dhKeyAgreement) sharedSecret(kdcPublicValue []byte) ([]byte, error) {
+	y := new(big.Int)
+	_, err := asn1.Unmarshal(kdcPublicValue, &y)
+	if err != nil {
+		return nil, fmt.Errorf("Error unmarshalling KDC's Diffie-Hellman public value: %v", err)
+	}
+	// The public value must be in the range 2 to p-2 and in the subgroup of order q
+	pMinus1 := new(big.Int).Sub(d.group.p, big.NewInt(1))
+	if y.Cmp(big.NewInt(1)) <= 0 || y.Cmp(pMinus1) >= 0 || new(big.Int).Exp(y, d.group.q, d.group.p).Cmp(big.NewInt(1)) != 0 {
+		return nil, errors.New("KDC's Diffie-Hellman public value is not valid")
+	}
+	z := new(big.Int).Exp(y, d.x, d.group.p)
+	b := make([]byte, (d.group.p.BitLen()+7)/8)
+	return z.FillBytes(b), nil
+}
+
+type ecdhKeyAgreement struct {
+	key *ecdh.PrivateKey
+}
+
+func newECDHKeyAgreement(c ecdh.Curve) (*ecdhKeyAgreement, error) {
+	key, err := c.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("Error generating ECDH private key: %v", err)
+	}
+	return &ecdhKeyAgreement{key: key}, nil
+}
+
+func (e *ecdhKeyAgreement) publicKeyInfo() (subjectPublicKeyInfo, error) {
+	var spki subjectPublicKeyInfo
+	b, err := x509.MarshalPKIXPublicKey(e.key.PublicKey())
+	if err != nil {
+		return spki, fmt.Errorf("Error marshalling ECDH public key: %v", err)
+	}
+	_, err = asn1.Unmarshal(b, &spki)
+	if err != nil {
+		return spki, fmt.Errorf("Error unmarshalling ECDH public key: %v", err)
+	}
+	return spki, nil
+}
+
+// The KDC's public value is an uncompressed elliptic curve point and the shared secret is its x-coordinate.
+// Ref: RFC 5349 Section 4
+func (e *ecdhKeyAgreement) sharedSecret(kdcPublicValue []byte) ([]byte, error) {
+	pub, err := e.key.Curve().NewPublicKey(kdcPublicValue)
+	if err != nil {
+		return nil, fmt.Errorf("KDC's ECDH public value is not valid: %v", err)
+	}
+	z, err := e.key.ECDH(pub)
+	if err != nil {
+		return nil, fmt.Errorf("Error calculating ECDH shared secret: %v", err)
+	}
+	return z, nil
+}
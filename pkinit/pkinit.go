@@ -0,0 +1,312 @@
+// Public key cryptography for initial authentication (PKINIT) pre-authentication for Kerberos clients.
+// Diffie-Hellman and elliptic curve Diffie-Hellman key agreement are supported.
+// Ref: RFC 4556, RFC 5349 and RFC 8636
+package pkinit
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/config"
+	krbcrypto "github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+	"time"
+)
+
+var (
+	oidPKINITAuthData  = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 1}
+	oidPKINITDHKeyData = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 2}
+)
+
+type PAPKASReq struct {
+	SignedAuthPack []byte `asn1:"tag:0"`
+	KDCPkID        []byte `asn1:"optional,tag:2"`
+}
+
+type AuthPack struct {
+	PKAuthenticator   PKAuthenticator       `asn1:"explicit,tag:0"`
+	ClientPublicValue subjectPublicKeyInfo  `asn1:"explicit,optional,tag:1"`
+	SupportedCMSTypes []algorithmIdentifier `asn1:"explicit,optional,tag:2"`
+	ClientDHNonce     []byte                `asn1:"explicit,optional,tag:3"`
+	SupportedKDFs     []KDFAlgorithmID      `asn1:"explicit,optional,tag:4"`
+}
+
+type PKAuthenticator struct {
+	Cusec      int       `asn1:"explicit,tag:0"`
+	CTime      time.Time `asn1:"generalized,explicit,tag:1"`
+	Nonce      int       `asn1:"explicit,tag:2"`
+	PAChecksum []byte    `asn1:"explicit,optional,tag:3"`
+}
+
+type KDFAlgorithmID struct {
+	KDFID asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+}
+
+// PA-PK-AS-REP is a CHOICE of DHRepInfo or EncKeyPack.
+type PAPKASRep struct {
+	DHInfo     DHRepInfo
+	EncKeyPack []byte
+}
+
+type DHRepInfo struct {
+	DHSignedData  []byte         `asn1:"tag:0"`
+	ServerDHNonce []byte         `asn1:"explicit,optional,tag:1"`
+	KDF           KDFAlgorithmID `asn1:"explicit,optional,tag:2"`
+}
+
+type KDCDHKeyInfo struct {
+	SubjectPublicKey asn1.BitString `asn1:"explicit,tag:0"`
+	Nonce            int            `asn1:"explicit,tag:1"`
+	DHKeyExpiration  time.Time      `asn1:"generalized,explicit,optional,tag:2"`
+}
+
+// Unmarshal bytes b into the PAPKASRep struct.
+func (p *PAPKASRep) Unmarshal(b []byte) error {
+	var rv asn1.RawValue
+	_, err := asn1.Unmarshal(b, &rv)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling PA-PK-AS-REP: %v", err)
+	}
+	if rv.Class != 2 {
+		return errors.New("PA-PK-AS-REP is not a context specific choice")
+	}
+	switch rv.Tag {
+	case 0:
+		_, err = asn1.Unmarshal(rv.Bytes, &p.DHInfo)
+		if err != nil {
+			return fmt.Errorf("Error unmarshalling PA-PK-AS-REP DHRepInfo: %v", err)
+		}
+	case 1:
+		p.EncKeyPack = rv.Bytes
+	default:
+		return fmt.Errorf("Unknown PA-PK-AS-REP choice: %d", rv.Tag)
+	}
+	return nil
+}
+
+// The client's state of a PKINIT exchange.
+// This holds the private key agreement value between the AS_REQ being sent and the AS_REP being received.
+type Request struct {
+	PAData       types.PAData
+	nonce        int
+	keyAgreement keyAgreement
+	reqBody      messages.KDCReqBody
+	anchors      *x509.CertPool
+	kdcHostnames []string
+}
+
+// Create the PKINIT pre-authentication data for the AS_REQ.
+// The AuthPack is signed with the certificate and private key provided. If these are nil the AuthPack is not signed,
+// as is required for anonymous PKINIT.
+// The AS_REQ's body must not be changed after this as the AuthPack contains a checksum of it.
+func NewRequest(cfg *config.Config, asReq messages.ASReq, cert *x509.Certificate, key crypto.Signer) (*Request, error) {
+	ka, err := newKeyAgreement(cfg.LibDefaults.Pkinit_dh_min_bits)
+	if err != nil {
+		return nil, err
+	}
+	return newRequest(cfg, asReq, cert, key, ka)
+}
+
+// Create the PKINIT pre-authentication data for the AS_REQ using a key agreement group offered by the KDC.
+// edata is the e-data of the KDC_ERR_DH_KEY_PARAMETERS_NOT_ACCEPTED error returned when the KDC did not accept the
+// group of a previous request. The first group offered that is at least as strong as pkinit_dh_min_bits is used.
+// Ref: RFC 4556 Section 3.2.2
+func NewRequestWithKDCParameters(cfg *config.Config, asReq messages.ASReq, cert *x509.Certificate, key crypto.Signer, edata []byte) (*Request, error) {
+	var tds types.TypedDataSequence
+	err := tds.Unmarshal(edata)
+	if err != nil {
+		return nil, fmt.Errorf("Error unmarshalling TYPED-DATA from KDC_ERR_DH_KEY_PARAMETERS_NOT_ACCEPTED: %v", err)
+	}
+	var offered []algorithmIdentifier
+	for _, td := range tds {
+		if td.DataType == patype.TD_DH_PARAMETERS {
+			_, err = asn1.Unmarshal(td.DataValue, &offered)
+			if err != nil {
+				return nil, fmt.Errorf("Error unmarshalling TD-DH-PARAMETERS: %v", err)
+			}
+		}
+	}
+	ka, err := newOfferedKeyAgreement(offered, cfg.LibDefaults.Pkinit_dh_min_bits)
+	if err != nil {
+		return nil, err
+	}
+	return newRequest(cfg, asReq, cert, key, ka)
+}
+
+func newRequest(cfg *config.Config, asReq messages.ASReq, cert *x509.Certificate, key crypto.Signer, ka keyAgreement) (*Request, error) {
+	anchors, err := LoadAnchors(cfg.LibDefaults.Pkinit_anchors)
+	if err != nil {
+		return nil, err
+	}
+	spki, err := ka.publicKeyInfo()
+	if err != nil {
+		return nil, err
+	}
+	b, err := asReq.ReqBody.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling AS_REQ body: %v", err)
+	}
+	cksum := sha1.Sum(b)
+	// The client's time is corrected by the offset of the KDC's clock if kdc_timesync is enabled
+	t := cfg.Now().UTC()
+	ap := AuthPack{
+		PKAuthenticator: PKAuthenticator{
+			Cusec:      int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
+			CTime:      t,
+			Nonce:      asReq.ReqBody.Nonce,
+			PAChecksum: cksum[:],
+		},
+		ClientPublicValue: spki,
+	}
+	for _, id := range supportedKDFs {
+		ap.SupportedKDFs = append(ap.SupportedKDFs, KDFAlgorithmID{KDFID: id})
+	}
+	b, err = asn1.Marshal(ap)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling AuthPack: %v", err)
+	}
+	sd, err := signData(b, oidPKINITAuthData, cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating signed AuthPack: %v", err)
+	}
+	b, err = asn1.Marshal(PAPKASReq{SignedAuthPack: sd})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling PA-PK-AS-REQ: %v", err)
+	}
+	return &Request{
+		PAData: types.PAData{
+			PADataType:  patype.PA_PK_AS_REQ,
+			PADataValue: b,
+		},
+		nonce:        asReq.ReqBody.Nonce,
+		keyAgreement: ka,
+		reqBody:      asReq.ReqBody,
+		anchors:      anchors,
+		kdcHostnames: cfg.LibDefaults.Pkinit_kdc_hostname,
+	}, nil
+}
+
+// Get the reply key from the PA-PK-AS-REP in the AS_REP.
+// The KDC's signature and certificate are verified before the reply key is derived from the key agreement.
+// asReqBytes must be the AS_REQ exactly as it was sent to the KDC. If the AS_REQ was armored with FAST the FAST
+// response must already have been processed.
+func (r *Request) ReplyKey(asReqBytes []byte, asRep messages.ASRep) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	var pab []byte
+	for _, pa := range asRep.PAData {
+		if pa.PADataType == patype.PA_PK_AS_REP {
+			pab = pa.PADataValue
+		}
+	}
+	if pab == nil {
+		return key, errors.New("AS_REP does not contain PA-PK-AS-REP")
+	}
+	var rep PAPKASRep
+	err := rep.Unmarshal(pab)
+	if err != nil {
+		return key, err
+	}
+	if rep.EncKeyPack != nil {
+		return key, errors.New("KDC used public key encryption for PKINIT, only Diffie-Hellman key agreement is supported")
+	}
+	content, signer, certs, err := verifySignedData(rep.DHInfo.DHSignedData, oidPKINITDHKeyData)
+	if err != nil {
+		return key, fmt.Errorf("Error verifying KDC's signed Diffie-Hellman key data: %v", err)
+	}
+	err = verifyKDCCertificate(signer, certs, r.anchors, r.reqBody.Realm, r.kdcHostnames)
+	if err != nil {
+		return key, err
+	}
+	var ki KDCDHKeyInfo
+	_, err = asn1.Unmarshal(content, &ki)
+	if err != nil {
+		return key, fmt.Errorf("Error unmarshalling KDCDHKeyInfo: %v", err)
+	}
+	if ki.Nonce != r.nonce {
+		return key, errors.New("Possible replay attack, nonce in KDC's Diffie-Hellman key data does not match that in request")
+	}
+	z, err := r.keyAgreement.sharedSecret(ki.SubjectPublicKey.Bytes)
+	if err != nil {
+		return key, err
+	}
+	et, err := krbcrypto.GetEtype(asRep.EncPart.EType)
+	if err != nil {
+		return key, fmt.Errorf("Error getting encryption type of AS_REP: %v", err)
+	}
+	keyLen := et.GetKeySeedBitLength() / 8
+	var kb []byte
+	if len(rep.DHInfo.KDF.KDFID) > 0 {
+		var offered bool
+		for _, id := range supportedKDFs {
+			if id.Equal(rep.DHInfo.KDF.KDFID) {
+				offered = true
+			}
+		}
+		if !offered {
+			return key, fmt.Errorf("KDC selected a key derivation function that was not offered: %v", rep.DHInfo.KDF.KDFID)
+		}
+		client := KRB5PrincipalName{Realm: r.reqBody.Realm, PrincipalName: r.reqBody.CName}
+		server := KRB5PrincipalName{Realm: r.reqBody.Realm, PrincipalName: r.reqBody.SName}
+		kb, err = kdf(rep.DHInfo.KDF.KDFID, z, keyLen, client, server, et.GetETypeID(), asReqBytes, pab)
+		if err != nil {
+			return key, err
+		}
+	} else {
+		kb = octetString2Key(z, keyLen)
+	}
+	key = types.EncryptionKey{
+		KeyType:  et.GetETypeID(),
+		KeyValue: et.RandomToKey(kb),
+	}
+	return key, nil
+}
+
+// Verify that the KDC contributed to the ticket session key in the reply to an anonymous PKINIT request.
+// The PA-PKINIT-KX padata of the AS_REP holds the KDC's contribution key encrypted in the reply key, and the session
+// key must be KRB-FX-CF2(contribution key, reply key, "PKINIT", "KEYEXCHANGE"). The encrypted part of the AS_REP must
+// already have been decrypted. Ref: RFC 8062 Section 7
+func VerifyKeyExchange(asRep messages.ASRep, replyKey types.EncryptionKey) error {
+	var kxb []byte
+	for _, pa := range asRep.PAData {
+		if pa.PADataType == patype.PA_PKINIT_KX {
+			kxb = pa.PADataValue
+		}
+	}
+	if kxb == nil {
+		return errors.New("AS_REP to anonymous PKINIT request does not contain PA-PKINIT-KX")
+	}
+	var ed types.EncryptedData
+	err := ed.Unmarshal(kxb)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling PA-PKINIT-KX: %v", err)
+	}
+	et, err := krbcrypto.GetEtype(replyKey.KeyType)
+	if err != nil {
+		return fmt.Errorf("Error getting encryption type of reply key: %v", err)
+	}
+	b, err := krbcrypto.DecryptEncPart(replyKey.KeyValue, ed, et, keyusage.KEY_USAGE_PA_PKINIT_KX)
+	if err != nil {
+		return fmt.Errorf("Error decrypting PA-PKINIT-KX: %v", err)
+	}
+	var ck types.EncryptionKey
+	err = ck.Unmarshal(b)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling KDC contribution key: %v", err)
+	}
+	sk, err := krbcrypto.KRBFXCF2(ck, replyKey, "PKINIT", "KEYEXCHANGE")
+	if err != nil {
+		return fmt.Errorf("Error combining KDC contribution key with reply key: %v", err)
+	}
+	key := asRep.DecryptedEncPart.Key
+	if sk.KeyType != key.KeyType || !hmac.Equal(sk.KeyValue, key.KeyValue) {
+		return errors.New("Ticket session key is not derived from the KDC contribution key in PA-PKINIT-KX")
+	}
+	return nil
+}
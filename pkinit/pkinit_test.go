@@ -0,0 +1,620 @@
+package pkinit
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	stdasn1 "encoding/asn1"
+	"encoding/pem"
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/config"
+	krbcrypto "github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testRealm = "TEST.GOKRB5"
+
+type testPKI struct {
+	caCert     *x509.Certificate
+	kdcCert    *x509.Certificate
+	kdcKey     crypto.Signer
+	clientCert *x509.Certificate
+	clientKey  crypto.Signer
+	anchorDir  string
+}
+
+// Create a certificate signed by the issuer provided, or self signed if the issuer is nil.
+func testCertificate(t *testing.T, tmpl *x509.Certificate, key crypto.Signer, issuer *x509.Certificate, issuerKey crypto.Signer) *x509.Certificate {
+	sn, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl.SerialNumber = sn
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if issuer == nil {
+		issuer = tmpl
+		issuerKey = key
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, issuer, key.Public(), issuerKey)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("Error parsing certificate: %v", err)
+	}
+	return cert
+}
+
+// Create the subject alternative name extension with the id-pkinit-san for the principal.
+func testPKINITSAN(t *testing.T, realm string, pn types.PrincipalName) pkix.Extension {
+	kn, err := asn1.Marshal(KRB5PrincipalName{Realm: realm, PrincipalName: pn})
+	if err != nil {
+		t.Fatalf("Error marshalling KRB5PrincipalName: %v", err)
+	}
+	on, err := asn1.Marshal(otherName{TypeID: oidPKINITSAN, Value: asn1.RawValue{Class: 2, IsCompound: true, Tag: 0, Bytes: kn}})
+	if err != nil {
+		t.Fatalf("Error marshalling otherName: %v", err)
+	}
+	// otherName is [0] IMPLICIT within GeneralName
+	on[0] = 0xa0
+	san, err := asn1.Marshal([]asn1.RawValue{{FullBytes: on}})
+	if err != nil {
+		t.Fatalf("Error marshalling subject alternative names: %v", err)
+	}
+	return pkix.Extension{Id: stdasn1.ObjectIdentifier(oidSubjectAltName), Value: san}
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	var p testPKI
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p.caCert = testCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "gokrb5 test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, caKey, nil, nil)
+	kdcKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p.kdcKey = kdcKey
+	p.kdcCert = testCertificate(t, &x509.Certificate{
+		Subject:            pkix.Name{CommonName: "kdc.test.gokrb5"},
+		KeyUsage:           x509.KeyUsageDigitalSignature,
+		UnknownExtKeyUsage: []stdasn1.ObjectIdentifier{stdasn1.ObjectIdentifier(oidPKINITKPKdc)},
+		ExtraExtensions: []pkix.Extension{testPKINITSAN(t, testRealm, types.PrincipalName{
+			NameType:   nametype.KRB_NT_SRV_INST,
+			NameString: []string{"krbtgt", testRealm},
+		})},
+	}, kdcKey, p.caCert, caKey)
+	clientKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p.clientKey = clientKey
+	p.clientCert = testCertificate(t, &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "testuser1"},
+		KeyUsage: x509.KeyUsageDigitalSignature,
+	}, clientKey, p.caCert, caKey)
+	d, err := ioutil.TempDir(os.TempDir(), "TEST-gokrb5-pkinit")
+	if err != nil {
+		t.Fatalf("Error creating anchors directory: %v", err)
+	}
+	p.anchorDir = d
+	err = ioutil.WriteFile(filepath.Join(d, "ca.pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.caCert.Raw}), 0600)
+	if err != nil {
+		t.Fatalf("Error writing anchor: %v", err)
+	}
+	return p
+}
+
+func testConfig(t *testing.T, p testPKI, bits int) *config.Config {
+	c, err := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	c.LibDefaults.Pkinit_anchors = []string{"FILE:" + filepath.Join(p.anchorDir, "ca.pem")}
+	c.LibDefaults.Pkinit_dh_min_bits = bits
+	return c
+}
+
+type testKDCOptions struct {
+	kdf       asn1.ObjectIdentifier
+	cert      *x509.Certificate
+	key       crypto.Signer
+	badNonce  bool
+	anonymous bool
+}
+
+// Process the PA-PK-AS-REQ as the KDC would and return the AS_REP padata along with the reply key the KDC derives.
+func testKDC(t *testing.T, p testPKI, asReq messages.ASReq, asReqBytes []byte, opts testKDCOptions) (types.PADataSequence, types.EncryptionKey) {
+	var key types.EncryptionKey
+	var pa types.PAData
+	for _, d := range asReq.PAData {
+		if d.PADataType == patype.PA_PK_AS_REQ {
+			pa = d
+		}
+	}
+	var req PAPKASReq
+	_, err := asn1.Unmarshal(pa.PADataValue, &req)
+	if err != nil {
+		t.Fatalf("Error unmarshalling PA-PK-AS-REQ: %v", err)
+	}
+	var content []byte
+	if opts.anonymous {
+		// Anonymous PKINIT AuthPacks are unsigned
+		_, _, _, err = verifySignedData(req.SignedAuthPack, oidPKINITAuthData)
+		assert.Error(t, err, "Anonymous AuthPack should not be signed")
+		var ci contentInfo
+		_, err = asn1.Unmarshal(req.SignedAuthPack, &ci)
+		if err != nil {
+			t.Fatalf("Error unmarshalling CMS ContentInfo: %v", err)
+		}
+		var sd signedData
+		_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+		if err != nil {
+			t.Fatalf("Error unmarshalling CMS SignedData: %v", err)
+		}
+		assert.Equal(t, 0, len(sd.SignerInfos), "Anonymous AuthPack should have no signers")
+		content = sd.EncapContentInfo.EContent
+	} else {
+		var signer *x509.Certificate
+		content, signer, _, err = verifySignedData(req.SignedAuthPack, oidPKINITAuthData)
+		if err != nil {
+			t.Fatalf("Error verifying signed AuthPack: %v", err)
+		}
+		assert.Equal(t, p.clientCert.Raw, signer.Raw, "AuthPack signer not as expected")
+	}
+	var ap AuthPack
+	_, err = asn1.Unmarshal(content, &ap)
+	if err != nil {
+		t.Fatalf("Error unmarshalling AuthPack: %v", err)
+	}
+	bb, _ := asReq.ReqBody.Marshal()
+	cksum := sha1.Sum(bb)
+	assert.Equal(t, cksum[:], ap.PKAuthenticator.PAChecksum, "PKAuthenticator checksum not as expected")
+	assert.Equal(t, asReq.ReqBody.Nonce, ap.PKAuthenticator.Nonce, "PKAuthenticator nonce not as expected")
+	assert.Equal(t, len(supportedKDFs), len(ap.SupportedKDFs), "Number of supported KDFs not as expected")
+
+	var z, kdcPub []byte
+	if ap.ClientPublicValue.Algorithm.Algorithm.Equal(oidDHPublicNumber) {
+		var params domainParameters
+		_, err = asn1.Unmarshal(ap.ClientPublicValue.Algorithm.Parameters.FullBytes, &params)
+		if err != nil {
+			t.Fatalf("Error unmarshalling DH domain parameters: %v", err)
+		}
+		y := new(big.Int)
+		_, err = asn1.Unmarshal(ap.ClientPublicValue.PublicKey.Bytes, &y)
+		if err != nil {
+			t.Fatalf("Error unmarshalling client DH public value: %v", err)
+		}
+		x, _ := rand.Int(rand.Reader, params.Q)
+		kdcPub, _ = asn1.Marshal(new(big.Int).Exp(params.G, x, params.P))
+		z = new(big.Int).Exp(y, x, params.P).FillBytes(make([]byte, (params.P.BitLen()+7)/8))
+	} else {
+		spki, _ := asn1.Marshal(ap.ClientPublicValue)
+		pub, err := x509.ParsePKIXPublicKey(spki)
+		if err != nil {
+			t.Fatalf("Error parsing client ECDH public value: %v", err)
+		}
+		cpub, err := pub.(*ecdsa.PublicKey).ECDH()
+		if err != nil {
+			t.Fatalf("Error converting client ECDH public value: %v", err)
+		}
+		kdcKey, _ := cpub.Curve().GenerateKey(rand.Reader)
+		kdcPub = kdcKey.PublicKey().Bytes()
+		z, _ = kdcKey.ECDH(cpub)
+	}
+
+	nonce := ap.PKAuthenticator.Nonce
+	if opts.badNonce {
+		nonce++
+	}
+	kb, err := asn1.Marshal(KDCDHKeyInfo{
+		SubjectPublicKey: asn1.BitString{Bytes: kdcPub, BitLength: len(kdcPub) * 8},
+		Nonce:            nonce,
+	})
+	if err != nil {
+		t.Fatalf("Error marshalling KDCDHKeyInfo: %v", err)
+	}
+	cert, signKey := p.kdcCert, p.kdcKey
+	if opts.cert != nil {
+		cert, signKey = opts.cert, opts.key
+	}
+	sd, err := signData(kb, oidPKINITDHKeyData, cert, signKey)
+	if err != nil {
+		t.Fatalf("Error signing KDCDHKeyInfo: %v", err)
+	}
+	di := DHRepInfo{DHSignedData: sd}
+	if opts.kdf != nil {
+		di.KDF = KDFAlgorithmID{KDFID: opts.kdf}
+	}
+	db, err := asn1.Marshal(di)
+	if err != nil {
+		t.Fatalf("Error marshalling DHRepInfo: %v", err)
+	}
+	pab, _ := asn1.Marshal(asn1.RawValue{Class: 2, IsCompound: true, Tag: 0, Bytes: db})
+
+	var k []byte
+	if opts.kdf != nil {
+		client := KRB5PrincipalName{Realm: asReq.ReqBody.Realm, PrincipalName: asReq.ReqBody.CName}
+		server := KRB5PrincipalName{Realm: asReq.ReqBody.Realm, PrincipalName: asReq.ReqBody.SName}
+		k, err = kdf(opts.kdf, z, 32, client, server, etype.AES256_CTS_HMAC_SHA1_96, asReqBytes, pab)
+		if err != nil {
+			t.Fatalf("Error deriving reply key: %v", err)
+		}
+	} else {
+		k = octetString2Key(z, 32)
+	}
+	key = types.EncryptionKey{KeyType: etype.AES256_CTS_HMAC_SHA1_96, KeyValue: k}
+	return types.PADataSequence{{PADataType: patype.PA_PK_AS_REP, PADataValue: pab}}, key
+}
+
+func testReplyKey(t *testing.T, bits int, opts testKDCOptions) (types.EncryptionKey, types.EncryptionKey, error) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.anchorDir)
+	c := testConfig(t, p, bits)
+	a := messages.NewASReq(c, "testuser1")
+	cert, signKey := p.clientCert, p.clientKey
+	if opts.anonymous {
+		a = messages.NewAnonymousASReq(c, c.LibDefaults.Default_realm)
+		cert, signKey = nil, nil
+	}
+	pk, err := NewRequest(c, a, cert, signKey)
+	if err != nil {
+		t.Fatalf("Error creating PKINIT request: %v", err)
+	}
+	a.PAData = append(a.PAData, pk.PAData)
+	b, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling AS_REQ: %v", err)
+	}
+	pas, expected := testKDC(t, p, a, b, opts)
+	var asRep messages.ASRep
+	asRep.PAData = pas
+	asRep.EncPart.EType = etype.AES256_CTS_HMAC_SHA1_96
+	key, err := pk.ReplyKey(b, asRep)
+	return expected, key, err
+}
+
+func TestRequest_ReplyKey_DH(t *testing.T) {
+	expected, key, err := testReplyKey(t, 2048, testKDCOptions{kdf: oidKDFSHA256})
+	if err != nil {
+		t.Fatalf("Error getting reply key: %v", err)
+	}
+	assert.Equal(t, expected, key, "Reply key not as expected")
+}
+
+func TestRequest_ReplyKey_ECDH(t *testing.T) {
+	for _, bits := range []int{3072, 7680, 15360} {
+		expected, key, err := testReplyKey(t, bits, testKDCOptions{kdf: oidKDFSHA512})
+		if err != nil {
+			t.Fatalf("Error getting reply key for %d bits: %v", bits, err)
+		}
+		assert.Equal(t, expected, key, "Reply key not as expected")
+	}
+}
+
+func TestRequest_ReplyKey_noKDF(t *testing.T) {
+	expected, key, err := testReplyKey(t, 3072, testKDCOptions{})
+	if err != nil {
+		t.Fatalf("Error getting reply key: %v", err)
+	}
+	assert.Equal(t, expected, key, "Reply key not as expected")
+}
+
+func TestRequest_ReplyKey_untrustedKDC(t *testing.T) {
+	other := newTestPKI(t)
+	defer os.RemoveAll(other.anchorDir)
+	_, _, err := testReplyKey(t, 3072, testKDCOptions{cert: other.kdcCert, key: other.kdcKey})
+	assert.Error(t, err, "KDC certificate from an untrusted CA should not be accepted")
+}
+
+func TestRequest_ReplyKey_notKDCCertificate(t *testing.T) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.anchorDir)
+	c := testConfig(t, p, 3072)
+	a := messages.NewASReq(c, "testuser1")
+	pk, err := NewRequest(c, a, p.clientCert, p.clientKey)
+	if err != nil {
+		t.Fatalf("Error creating PKINIT request: %v", err)
+	}
+	a.PAData = append(a.PAData, pk.PAData)
+	b, _ := a.Marshal()
+	// A certificate issued by the trusted CA but not to the KDC
+	pas, _ := testKDC(t, p, a, b, testKDCOptions{cert: p.clientCert, key: p.clientKey})
+	var asRep messages.ASRep
+	asRep.PAData = pas
+	asRep.EncPart.EType = etype.AES256_CTS_HMAC_SHA1_96
+	_, err = pk.ReplyKey(b, asRep)
+	assert.Error(t, err, "Certificate that does not identify the KDC should not be accepted")
+}
+
+func TestRequest_ReplyKey_badNonce(t *testing.T) {
+	_, _, err := testReplyKey(t, 3072, testKDCOptions{badNonce: true})
+	assert.Error(t, err, "KDCDHKeyInfo with a different nonce should not be accepted")
+}
+
+func TestRequest_ReplyKey_anonymous(t *testing.T) {
+	expected, key, err := testReplyKey(t, 2048, testKDCOptions{kdf: oidKDFSHA256, anonymous: true})
+	if err != nil {
+		t.Fatalf("Error getting reply key: %v", err)
+	}
+	assert.Equal(t, expected, key, "Reply key not as expected")
+}
+
+// Build an AS_REP to an anonymous request with PA-PKINIT-KX holding the contribution key encrypted in the reply key.
+// The ticket session key is set to the session key given.
+func testKXReply(t *testing.T, replyKey, contribution, sessionKey types.EncryptionKey) messages.ASRep {
+	cb, err := asn1.Marshal(contribution)
+	if err != nil {
+		t.Fatalf("Error marshalling contribution key: %v", err)
+	}
+	ed, err := krbcrypto.GetEncryptedData(cb, replyKey, keyusage.KEY_USAGE_PA_PKINIT_KX, 0)
+	if err != nil {
+		t.Fatalf("Error encrypting contribution key: %v", err)
+	}
+	eb, err := ed.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling PA-PKINIT-KX: %v", err)
+	}
+	var asRep messages.ASRep
+	asRep.PAData = types.PADataSequence{{PADataType: patype.PA_PKINIT_KX, PADataValue: eb}}
+	asRep.DecryptedEncPart.Key = sessionKey
+	return asRep
+}
+
+func TestVerifyKeyExchange(t *testing.T) {
+	replyKey, _ := krbcrypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	contribution, _ := krbcrypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, err := krbcrypto.KRBFXCF2(contribution, replyKey, "PKINIT", "KEYEXCHANGE")
+	if err != nil {
+		t.Fatalf("Error deriving session key: %v", err)
+	}
+	err = VerifyKeyExchange(testKXReply(t, replyKey, contribution, sessionKey), replyKey)
+	assert.NoError(t, err, "Session key derived from the KDC contribution key should be accepted")
+}
+
+func TestVerifyKeyExchange_missing(t *testing.T) {
+	replyKey, _ := krbcrypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	var asRep messages.ASRep
+	asRep.DecryptedEncPart.Key = replyKey
+	err := VerifyKeyExchange(asRep, replyKey)
+	assert.Error(t, err, "Reply to an anonymous request without PA-PKINIT-KX should not be accepted")
+}
+
+func TestVerifyKeyExchange_wrongKey(t *testing.T) {
+	replyKey, _ := krbcrypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	contribution, _ := krbcrypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	other, _ := krbcrypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, _ := krbcrypto.KRBFXCF2(contribution, replyKey, "PKINIT", "KEYEXCHANGE")
+	// The session key was not derived from the contribution key in the padata
+	err := VerifyKeyExchange(testKXReply(t, replyKey, other, sessionKey), replyKey)
+	assert.Error(t, err, "Session key not derived from the PA-PKINIT-KX contribution key should not be accepted")
+	// The contribution key is encrypted in a key other than the reply key
+	err = VerifyKeyExchange(testKXReply(t, other, contribution, sessionKey), replyKey)
+	assert.Error(t, err, "PA-PKINIT-KX not encrypted in the reply key should not be accepted")
+}
+
+func TestNewRequest_kdcTimeOffset(t *testing.T) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.anchorDir)
+	c := testConfig(t, p, 3072)
+	// The KDC's clock is an hour ahead
+	kdcTime := time.Now().Add(time.Hour)
+	if !c.SetKDCTime(kdcTime) {
+		t.Fatalf("KDC time not recorded")
+	}
+	pk, err := NewRequest(c, messages.NewAnonymousASReq(c, c.LibDefaults.Default_realm), nil, nil)
+	if err != nil {
+		t.Fatalf("Error creating PKINIT request: %v", err)
+	}
+	var req PAPKASReq
+	_, err = asn1.Unmarshal(pk.PAData.PADataValue, &req)
+	if err != nil {
+		t.Fatalf("Error unmarshalling PA-PK-AS-REQ: %v", err)
+	}
+	var ci contentInfo
+	_, err = asn1.Unmarshal(req.SignedAuthPack, &ci)
+	if err != nil {
+		t.Fatalf("Error unmarshalling CMS ContentInfo: %v", err)
+	}
+	var sd signedData
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		t.Fatalf("Error unmarshalling CMS SignedData: %v", err)
+	}
+	var ap AuthPack
+	_, err = asn1.Unmarshal(sd.EncapContentInfo.EContent, &ap)
+	if err != nil {
+		t.Fatalf("Error unmarshalling AuthPack: %v", err)
+	}
+	ctime := ap.PKAuthenticator.CTime
+	assert.True(t, ctime.Sub(kdcTime) < time.Minute && kdcTime.Sub(ctime) < time.Minute, "PKAuthenticator time not corrected by the KDC's clock offset")
+}
+
+func TestVerifySignedData_tampered(t *testing.T) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.anchorDir)
+	content := []byte("gokrb5 signed content")
+	b, err := signData(content, oidPKINITDHKeyData, p.kdcCert, p.kdcKey)
+	if err != nil {
+		t.Fatalf("Error signing data: %v", err)
+	}
+	c, signer, _, err := verifySignedData(b, oidPKINITDHKeyData)
+	if err != nil {
+		t.Fatalf("Error verifying signed data: %v", err)
+	}
+	assert.Equal(t, content, c, "Content not as expected")
+	assert.Equal(t, p.kdcCert.Raw, signer.Raw, "Signer not as expected")
+	_, _, _, err = verifySignedData(b, oidPKINITAuthData)
+	assert.Error(t, err, "Signed data with a different content type should not be accepted")
+	i := len(b) - 1
+	b[i] ^= 0xff
+	_, _, _, err = verifySignedData(b, oidPKINITDHKeyData)
+	assert.Error(t, err, "Tampered signed data should not be accepted")
+}
+
+func TestSignData_digestAlgorithms(t *testing.T) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.anchorDir)
+	b, err := signData([]byte("gokrb5 signed content"), oidPKINITAuthData, p.kdcCert, p.kdcKey)
+	if err != nil {
+		t.Fatalf("Error signing data: %v", err)
+	}
+	// Parse with the standard library as an independent check of the SET OF AlgorithmIdentifier encoding
+	var ci struct {
+		ContentType stdasn1.ObjectIdentifier
+		Content     stdasn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	_, err = stdasn1.Unmarshal(b, &ci)
+	if err != nil {
+		t.Fatalf("Error unmarshalling ContentInfo: %v", err)
+	}
+	var sd struct {
+		Version          int
+		DigestAlgorithms stdasn1.RawValue
+	}
+	_, err = stdasn1.Unmarshal(ci.Content.Bytes, &sd)
+	if err != nil {
+		t.Fatalf("Error unmarshalling SignedData: %v", err)
+	}
+	assert.Equal(t, stdasn1.TagSet, sd.DigestAlgorithms.Tag, "Digest algorithms are not a SET OF")
+	var alg pkix.AlgorithmIdentifier
+	rest, err := stdasn1.Unmarshal(sd.DigestAlgorithms.Bytes, &alg)
+	if err != nil {
+		t.Fatalf("Error unmarshalling digest algorithm: %v", err)
+	}
+	assert.Equal(t, byte(0x30), sd.DigestAlgorithms.Bytes[0], "Digest algorithm is not a SEQUENCE")
+	assert.True(t, alg.Algorithm.Equal(stdasn1.ObjectIdentifier(oidSHA256)), "Digest algorithm not as expected")
+	assert.Equal(t, 0, len(rest), "Number of digest algorithms not as expected")
+}
+
+func TestDHGroups(t *testing.T) {
+	for bits, g := range map[int]dhGroup{2048: modpGroup14, 4096: modpGroup16} {
+		assert.Equal(t, bits, g.p.BitLen(), "Prime size not as expected")
+		assert.True(t, g.p.ProbablyPrime(20), "Group modulus is not prime")
+		assert.True(t, g.q.ProbablyPrime(20), "Group modulus is not a safe prime")
+	}
+}
+
+func TestDHKeyAgreement_invalidPublicValue(t *testing.T) {
+	ka, err := newDHKeyAgreement(modpGroup14)
+	if err != nil {
+		t.Fatalf("Error creating key agreement: %v", err)
+	}
+	for _, y := range []*big.Int{big.NewInt(1), new(big.Int).Sub(modpGroup14.p, big.NewInt(1)), modpGroup14.p} {
+		b, _ := asn1.Marshal(y)
+		_, err = ka.sharedSecret(b)
+		assert.Error(t, err, "Invalid Diffie-Hellman public value should not be accepted")
+	}
+	e, err := newECDHKeyAgreement(ecdh.P256())
+	if err != nil {
+		t.Fatalf("Error creating key agreement: %v", err)
+	}
+	_, err = e.sharedSecret([]byte{0x04, 0x01})
+	assert.Error(t, err, "Invalid ECDH public value should not be accepted")
+}
+
+func TestLoadAnchors(t *testing.T) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.anchorDir)
+	for _, a := range []string{"FILE:" + filepath.Join(p.anchorDir, "ca.pem"), "DIR:" + p.anchorDir} {
+		pool, err := LoadAnchors([]string{a})
+		if err != nil {
+			t.Fatalf("Error loading anchors %s: %v", a, err)
+		}
+		_, err = p.kdcCert.Verify(x509.VerifyOptions{Roots: pool, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		assert.NoError(t, err, "KDC certificate not verified with anchors loaded")
+	}
+	_, err := LoadAnchors([]string{"ENV:X509_ANCHORS"})
+	assert.Error(t, err, "Unsupported anchor type should return an error")
+	_, err = LoadAnchors(nil)
+	assert.Error(t, err, "No anchors should return an error")
+}
+
+func TestNewKeyAgreement_minBits(t *testing.T) {
+	var tests = []struct {
+		minBits int
+		bits    int
+		curve   ecdh.Curve
+	}{
+		{2048, 2048, nil},
+		{2500, 0, ecdh.P256()},
+		{3072, 0, ecdh.P256()},
+		{4000, 4096, nil},
+		{5000, 0, ecdh.P384()},
+		{15360, 0, ecdh.P521()},
+	}
+	for _, test := range tests {
+		ka, err := newKeyAgreement(test.minBits)
+		if err != nil {
+			t.Fatalf("Error creating key agreement at least %d bits strong: %v", test.minBits, err)
+		}
+		assertKeyAgreementGroup(t, ka, test.bits, test.curve)
+	}
+	_, err := newKeyAgreement(16384)
+	assert.Error(t, err, "There should be no key agreement group stronger than 15360 bits")
+}
+
+func TestNewRequestWithKDCParameters(t *testing.T) {
+	p := newTestPKI(t)
+	defer os.RemoveAll(p.anchorDir)
+	var offered []algorithmIdentifier
+	for _, i := range []int{1, 0, 4} {
+		ka, _ := keyAgreementGroups[i].newKeyAgreement()
+		spki, err := ka.publicKeyInfo()
+		if err != nil {
+			t.Fatalf("Error getting public key info: %v", err)
+		}
+		offered = append(offered, spki.Algorithm)
+	}
+	b, _ := asn1.Marshal(offered)
+	edata, _ := asn1.Marshal(types.TypedDataSequence{{DataType: patype.TD_DH_PARAMETERS, DataValue: b}})
+	var tests = []struct {
+		minBits int
+		bits    int
+		curve   ecdh.Curve
+	}{
+		{2048, 0, ecdh.P256()},
+		{4096, 0, ecdh.P521()},
+	}
+	for _, test := range tests {
+		c := testConfig(t, p, test.minBits)
+		a := messages.NewASReq(c, "testuser1")
+		pk, err := NewRequestWithKDCParameters(c, a, p.clientCert, p.clientKey, edata)
+		if err != nil {
+			t.Fatalf("Error creating PKINIT request with a minimum of %d bits: %v", test.minBits, err)
+		}
+		assertKeyAgreementGroup(t, pk.keyAgreement, test.bits, test.curve)
+	}
+	// Only the 2048 bit group and P-256 are offered
+	b, _ = asn1.Marshal(offered[:2])
+	edata, _ = asn1.Marshal(types.TypedDataSequence{{DataType: patype.TD_DH_PARAMETERS, DataValue: b}})
+	c := testConfig(t, p, 7680)
+	_, err := NewRequestWithKDCParameters(c, messages.NewASReq(c, "testuser1"), p.clientCert, p.clientKey, edata)
+	assert.Error(t, err, "Groups weaker than the minimum should not be used")
+}
+
+func assertKeyAgreementGroup(t *testing.T, ka keyAgreement, bits int, curve ecdh.Curve) {
+	switch ka := ka.(type) {
+	case *dhKeyAgreement:
+		assert.Equal(t, bits, ka.group.p.BitLen(), "Diffie-Hellman group not as expected")
+	case *ecdhKeyAgreement:
+		assert.True(t, curve == ka.key.Curve(), "ECDH curve not as expected, %v but expected %v", ka.key.Curve(), curve)
+	}
+	_, isDH := ka.(*dhKeyAgreement)
+	assert.Equal(t, curve == nil, isDH, "Type of key agreement not as expected")
+}
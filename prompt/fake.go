@@ -0,0 +1,37 @@
+package prompt
+
+import (
+	"fmt"
+)
+
+// Fake is a Prompter for tests. It returns a fixed response for each prompt type and records the prompts made.
+type Fake struct {
+	Responses map[Type]string
+	Prompts   []Prompt
+}
+
+// Create a new Fake prompter with the responses provided for each prompt type.
+func NewFake(responses map[Type]string) *Fake {
+	return &Fake{Responses: responses}
+}
+
+// Record the prompt and return the response for its type. An error is returned if there is no response for the type.
+func (f *Fake) Prompt(p Prompt) (string, error) {
+	f.Prompts = append(f.Prompts, p)
+	r, ok := f.Responses[p.Type]
+	if !ok {
+		return "", fmt.Errorf("No response for %v prompt", p.Type)
+	}
+	return r, nil
+}
+
+// Get the number of prompts made of the type specified.
+func (f *Fake) Count(t Type) int {
+	var n int
+	for _, p := range f.Prompts {
+		if p.Type == t {
+			n++
+		}
+	}
+	return n
+}
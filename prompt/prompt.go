@@ -0,0 +1,58 @@
+// Prompting for secret input, such as passwords and one-time passwords, when it is needed during authentication.
+package prompt
+
+import (
+	"fmt"
+)
+
+// Type of input a prompt asks for.
+type Type int
+
+const (
+	// The client's password.
+	Password Type = iota
+	// A new password for the client, when its password has expired.
+	NewPassword
+	// A one-time password for OTP pre-authentication.
+	OTP
+	// Input for a SPAKE second factor.
+	SecondFactor
+)
+
+// String returns the name of the prompt type.
+func (t Type) String() string {
+	switch t {
+	case Password:
+		return "password"
+	case NewPassword:
+		return "new password"
+	case OTP:
+		return "one-time password"
+	case SecondFactor:
+		return "second factor"
+	}
+	return fmt.Sprintf("prompt type %d", int(t))
+}
+
+// A request for input.
+type Prompt struct {
+	Type Type
+	// Text to display to the user.
+	Text string
+	// Whether the input may be echoed as it is entered.
+	Echo bool
+}
+
+// Prompter gets input from the user when it is needed during authentication.
+type Prompter interface {
+	// Get the user's response to the prompt.
+	Prompt(p Prompt) (string, error)
+}
+
+// PrompterFunc allows an ordinary function to be used as a Prompter.
+type PrompterFunc func(p Prompt) (string, error)
+
+// Get the response by calling the function.
+func (f PrompterFunc) Prompt(p Prompt) (string, error) {
+	return f(p)
+}
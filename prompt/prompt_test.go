@@ -0,0 +1,50 @@
+package prompt
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestTerminal_Prompt(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Error creating pipe: %v", err)
+	}
+	defer r.Close()
+	w.Write([]byte("1234\r\n123456\n"))
+	w.Close()
+	var out bytes.Buffer
+	term := NewTerminal(r, &out)
+	// Echo cannot be turned off for a pipe
+	_, err = term.Prompt(Prompt{Type: Password, Text: "Password for testuser1@TEST.GOKRB5"})
+	assert.Error(t, err, "Prompting for a password should fail when echo cannot be turned off")
+	assert.Equal(t, "", out.String(), "Prompt should not be written when it cannot be answered")
+	s, err := term.Prompt(Prompt{Type: OTP, Text: "Enter OTP token PIN", Echo: true})
+	if err != nil {
+		t.Fatalf("Error prompting: %v", err)
+	}
+	assert.Equal(t, "1234", s, "Response not as expected")
+	assert.Equal(t, "Enter OTP token PIN: ", out.String(), "Prompt written not as expected")
+	s, err = term.Prompt(Prompt{Type: OTP, Text: "Enter OTP token value", Echo: true})
+	if err != nil {
+		t.Fatalf("Error prompting: %v", err)
+	}
+	assert.Equal(t, "123456", s, "Second response not as expected")
+	_, err = term.Prompt(Prompt{Type: OTP, Text: "Enter OTP token value", Echo: true})
+	assert.Error(t, err, "Prompting with no more input should fail")
+}
+
+func TestFake_Prompt(t *testing.T) {
+	f := NewFake(map[Type]string{Password: "passwordvalue"})
+	s, err := f.Prompt(Prompt{Type: Password, Text: "Password"})
+	if err != nil {
+		t.Fatalf("Error prompting: %v", err)
+	}
+	assert.Equal(t, "passwordvalue", s, "Response not as expected")
+	_, err = f.Prompt(Prompt{Type: OTP, Text: "OTP"})
+	assert.Error(t, err, "Prompt without a response should fail")
+	assert.Equal(t, 1, f.Count(Password), "Number of password prompts not as expected")
+	assert.Equal(t, 2, len(f.Prompts), "Prompts not recorded")
+}
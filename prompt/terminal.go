@@ -0,0 +1,81 @@
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+)
+
+// Terminal is a Prompter that reads responses from a terminal.
+// Echo is turned off for input that must not be echoed. If the input is not a terminal, so echo cannot be turned off,
+// prompting for such input fails rather than reading it with echo on.
+type Terminal struct {
+	in  *os.File
+	out io.Writer
+}
+
+// Create a new Terminal prompter reading responses from in and writing prompts to out.
+func NewTerminal(in *os.File, out io.Writer) *Terminal {
+	return &Terminal{
+		in:  in,
+		out: out,
+	}
+}
+
+// Create a new Terminal prompter using standard input and standard error.
+func NewStdTerminal() *Terminal {
+	return NewTerminal(os.Stdin, os.Stderr)
+}
+
+// Write the prompt and read a line in response.
+func (t *Terminal) Prompt(p Prompt) (string, error) {
+	if p.Echo {
+		fmt.Fprintf(t.out, "%s: ", p.Text)
+		s, err := t.readLine()
+		if err != nil {
+			return "", fmt.Errorf("Error reading response to %v prompt: %v", p.Type, err)
+		}
+		return s, nil
+	}
+	fd := int(t.in.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("Error reading response to %v prompt: input is not a terminal so echo cannot be turned off", p.Type)
+	}
+	fmt.Fprintf(t.out, "%s: ", p.Text)
+	b, err := term.ReadPassword(fd)
+	// The newline entered was not echoed
+	fmt.Fprintln(t.out)
+	if err != nil {
+		return "", fmt.Errorf("Error reading response to %v prompt: %v", p.Type, err)
+	}
+	return string(b), nil
+}
+
+// Read a line from the input.
+// The input is not buffered so that nothing beyond the line is consumed before echo is next turned off.
+func (t *Terminal) readLine() (string, error) {
+	var s []byte
+	b := make([]byte, 1)
+	for {
+		n, err := t.in.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			s = append(s, b[0])
+		}
+		if err == io.EOF {
+			if len(s) == 0 {
+				return "", errors.New("no input")
+			}
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimRight(string(s), "\r"), nil
+}
@@ -0,0 +1,52 @@
+package spake
+
+import (
+	"crypto/rand"
+	"errors"
+	"filippo.io/edwards25519"
+	"fmt"
+)
+
+// Arithmetic for the edwards25519 group uses a constant time implementation as the client's private scalar and the
+// multiplier derived from its long term key are secret.
+
+// 2^248 mod the group order. As 2^248 is less than the order this is 2^248 itself.
+var ed25519Two248, _ = edwards25519.NewScalar().SetCanonicalBytes(append(make([]byte, 31), 1))
+
+// Get the scalar for a 32 byte little-endian integer, reducing it modulo the group order.
+// The integer is split as hi*2^248 + lo where both parts are less than the order.
+func edScalar(b []byte) (*edwards25519.Scalar, error) {
+	if len(b) != 32 {
+		return nil, errors.New("Invalid edwards25519 scalar length")
+	}
+	lo, err := edwards25519.NewScalar().SetCanonicalBytes(append(append([]byte{}, b[:31]...), 0))
+	if err != nil {
+		return nil, err
+	}
+	hiBytes := make([]byte, 32)
+	hiBytes[0] = b[31]
+	hi, err := edwards25519.NewScalar().SetCanonicalBytes(hiBytes)
+	if err != nil {
+		return nil, err
+	}
+	return edwards25519.NewScalar().MultiplyAdd(hi, ed25519Two248, lo), nil
+}
+
+// Generate a random scalar.
+func edRandomScalar() (*edwards25519.Scalar, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return nil, fmt.Errorf("Error generating SPAKE private value: %v", err)
+	}
+	return edScalar(b)
+}
+
+// Decode a point from its 32 byte encoding.
+func edDecode(b []byte) (*edwards25519.Point, error) {
+	p, err := edwards25519.NewIdentityPoint().SetBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid edwards25519 point encoding: %v", err)
+	}
+	return p, nil
+}
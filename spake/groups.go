@@ -0,0 +1,212 @@
+package spake
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"filippo.io/edwards25519"
+	"filippo.io/nistec"
+	"fmt"
+)
+
+// SPAKE group numbers.
+const (
+	GroupEdwards25519 = 1
+	GroupP256         = 2
+	GroupP384         = 3
+	GroupP521         = 4
+)
+
+// Groups offered to the KDC in order of preference.
+var SupportedGroups = []int{GroupEdwards25519, GroupP256, GroupP384, GroupP521}
+
+// A SPAKE group.
+// The client's public value is T = x*G + w*M and the KDC's is S = y*G + w*N.
+// Both sides arrive at the shared result K = x*(S - w*N) = y*(T - w*M).
+type group interface {
+	id() int
+	// Hash function used for the transcript hash.
+	hash() crypto.Hash
+	// Length in bytes of the multiplier w derived from the initial reply key.
+	multLen() int
+	// Generate the client's private scalar and public value from the multiplier bytes.
+	keygen(w []byte) (priv []byte, pub []byte, err error)
+	// Compute the shared result from the multiplier bytes, the client's private scalar and the KDC's public value.
+	result(w, priv, kdcPub []byte) ([]byte, error)
+}
+
+// Get the group for the group number.
+func getGroup(id int) (group, error) {
+	switch id {
+	case GroupEdwards25519:
+		return edwards25519Group{}, nil
+	case GroupP256:
+		return newNISTGroup(id, nistec.NewP256Point, elliptic.P256(), crypto.SHA256,
+			"02886e2f97ace46e55ba9dd7242579f2993b64e16ef3dcab95afd497333d8fa12f",
+			"03d8bbd6c639c62937b04d997f38c3770719c629d7014d49a24b4f98baa1292b49")
+	case GroupP384:
+		return newNISTGroup(id, nistec.NewP384Point, elliptic.P384(), crypto.SHA384,
+			"030ff0895ae5ebf6187080a82d82b42e2765e3b2f8749c7e05eba366434b363d3dc36f15314739074d2eb8613fceec2853",
+			"02c72cf2e390853a1c1c4ad816a62fd15824f56078918f43f922ca21518f9c543bb252c5490214cf9aa3f0baab4b665c10")
+	case GroupP521:
+		return newNISTGroup(id, nistec.NewP521Point, elliptic.P521(), crypto.SHA512,
+			"02003f06f38131b2ba2600791e82488e8d20ab889af753a41806c5db18d37d85608cfae06b82e4a72cd744c719193562a653ea1f119eef9356907edc9b56979962d7aa",
+			"0200c7924b9ec017f3094562894336a53c50167ba8c5963876880542bc669e494b2532d76c5b53dfb349fdf69154b9e0048c58a42e8ed04cef052a3bc349d95575cd25")
+	}
+	return nil, fmt.Errorf("Unsupported SPAKE group: %d", id)
+}
+
+// The NIST prime curve groups. Points are encoded in compressed form.
+type nistGroup[P nistPoint[P]] struct {
+	groupID  int
+	newPoint func() P
+	h        crypto.Hash
+	bitSize  int
+	order    []byte
+	m, n     P
+}
+
+func newNISTGroup[P nistPoint[P]](id int, newPoint func() P, curve elliptic.Curve, h crypto.Hash, m, n string) (group, error) {
+	params := curve.Params()
+	g := nistGroup[P]{groupID: id, newPoint: newPoint, h: h, bitSize: params.BitSize}
+	g.order = params.N.FillBytes(make([]byte, g.multLen()))
+	var err error
+	g.m, err = newPoint().SetBytes(mustDecodeHex(m))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid constants for SPAKE group %d", id)
+	}
+	g.n, err = newPoint().SetBytes(mustDecodeHex(n))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid constants for SPAKE group %d", id)
+	}
+	return g, nil
+}
+
+func (g nistGroup[P]) id() int {
+	return g.groupID
+}
+
+func (g nistGroup[P]) hash() crypto.Hash {
+	return g.h
+}
+
+func (g nistGroup[P]) multLen() int {
+	return (g.bitSize + 7) / 8
+}
+
+func (g nistGroup[P]) keygen(w []byte) ([]byte, []byte, error) {
+	priv, err := nistRandomScalar(g.order, g.bitSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, err := g.newPoint().ScalarBaseMult(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	wm, err := g.newPoint().ScalarMult(g.m, w)
+	if err != nil {
+		return nil, nil, err
+	}
+	t.Add(t, wm)
+	return priv, t.BytesCompressed(), nil
+}
+
+// K = x*(S - w*N)
+func (g nistGroup[P]) result(w, priv, kdcPub []byte) ([]byte, error) {
+	s, err := g.newPoint().SetBytes(kdcPub)
+	if err != nil {
+		return nil, errors.New("KDC's SPAKE public value is not a valid point")
+	}
+	wn, err := g.newPoint().ScalarMult(g.n, w)
+	if err != nil {
+		return nil, err
+	}
+	p := g.newPoint().Add(s, wn.Negate(wn))
+	k, err := g.newPoint().ScalarMult(p, priv)
+	if err != nil {
+		return nil, err
+	}
+	if k.IsInfinity() == 1 {
+		return nil, errors.New("SPAKE result is the identity")
+	}
+	return k.BytesCompressed(), nil
+}
+
+// The edwards25519 group. The private scalar is a multiple of the cofactor.
+type edwards25519Group struct{}
+
+var (
+	ed25519M = mustDecodeHex("d048032c6ea0b6d697ddc2e86bda85a33adac920f1bf18e1b0c6d166a5cecdaf")
+	ed25519N = mustDecodeHex("d3bfb518f44f3430f29d0c92af503865a1ed3281dc69b35dd868ba85f886c4ab")
+)
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (g edwards25519Group) id() int {
+	return GroupEdwards25519
+}
+
+func (g edwards25519Group) hash() crypto.Hash {
+	return crypto.SHA256
+}
+
+func (g edwards25519Group) multLen() int {
+	return 32
+}
+
+// The private scalar is x = 8*r for a random r, so T = 8*(r*G) + w*M. Only r is kept.
+func (g edwards25519Group) keygen(w []byte) ([]byte, []byte, error) {
+	m, err := edDecode(ed25519M)
+	if err != nil {
+		return nil, nil, err
+	}
+	ws, err := edScalar(w)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := edRandomScalar()
+	if err != nil {
+		return nil, nil, err
+	}
+	t := edwards25519.NewIdentityPoint().ScalarBaseMult(r)
+	t.MultByCofactor(t)
+	t.Add(t, edwards25519.NewIdentityPoint().ScalarMult(ws, m))
+	return r.Bytes(), t.Bytes(), nil
+}
+
+// K = 8*r*(S - w*N)
+func (g edwards25519Group) result(w, priv, kdcPub []byte) ([]byte, error) {
+	n, err := edDecode(ed25519N)
+	if err != nil {
+		return nil, err
+	}
+	s, err := edDecode(kdcPub)
+	if err != nil {
+		return nil, fmt.Errorf("KDC's SPAKE public value is not a valid point: %v", err)
+	}
+	ws, err := edScalar(w)
+	if err != nil {
+		return nil, err
+	}
+	r, err := edwards25519.NewScalar().SetCanonicalBytes(priv)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SPAKE private value: %v", err)
+	}
+	// The receiver of ScalarMult must not be the point multiplied
+	p := edwards25519.NewIdentityPoint().Subtract(s, edwards25519.NewIdentityPoint().ScalarMult(ws, n))
+	k := edwards25519.NewIdentityPoint().ScalarMult(r, p)
+	k.MultByCofactor(k)
+	if k.Equal(edwards25519.NewIdentityPoint()) == 1 {
+		return nil, errors.New("SPAKE result is the identity")
+	}
+	return k.Bytes(), nil
+}
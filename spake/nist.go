@@ -0,0 +1,54 @@
+package spake
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// Arithmetic for the NIST curve groups uses the constant time implementation in filippo.io/nistec. The multiplier is
+// passed to the scalar multiplications unreduced, as they accept any integer of the group's scalar length.
+
+// The point operations used from filippo.io/nistec.
+type nistPoint[P any] interface {
+	SetBytes(b []byte) (P, error)
+	BytesCompressed() []byte
+	Add(p1, p2 P) P
+	Negate(q P) P
+	IsInfinity() int
+	ScalarMult(q P, scalar []byte) (P, error)
+	ScalarBaseMult(scalar []byte) (P, error)
+}
+
+// Generate a random scalar in [1, order-1] by rejection sampling. The order is big-endian and of the scalar length.
+func nistRandomScalar(order []byte, bitSize int) ([]byte, error) {
+	b := make([]byte, len(order))
+	for {
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, fmt.Errorf("Error generating SPAKE private value: %v", err)
+		}
+		// Clear the bits above the order's bit length so few candidates are rejected.
+		b[0] &= 0xff >> uint(len(b)*8-bitSize)
+		if !nistIsZero(b) && nistIsLess(b, order) {
+			return b, nil
+		}
+	}
+}
+
+// Whether the big-endian integer is zero, in constant time.
+func nistIsZero(b []byte) bool {
+	var acc byte
+	for _, c := range b {
+		acc |= c
+	}
+	return acc == 0
+}
+
+// Whether big-endian a is less than b, in constant time. Both must be the same length.
+func nistIsLess(a, b []byte) bool {
+	var borrow int
+	for i := len(a) - 1; i >= 0; i-- {
+		borrow = ((int(a[i]) - int(b[i]) - borrow) >> 8) & 1
+	}
+	return borrow == 1
+}
@@ -0,0 +1,359 @@
+// SPAKE pre-authentication for Kerberos clients.
+// The password derived initial reply key is used as the shared secret of a SPAKE2 key exchange so that nothing sent
+// to the KDC can be used for an offline dictionary attack.
+// Ref: draft-ietf-kitten-krb-spake-preauth
+package spake
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/iana/patype"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/types"
+)
+
+// Second factor type for no second factor.
+const SFNone = 1
+
+// PA-SPAKE is a CHOICE of the messages of the exchange.
+type PASPAKE struct {
+	Support   *SPAKESupport
+	Challenge *SPAKEChallenge
+	Response  *SPAKEResponse
+	EncData   *types.EncryptedData
+}
+
+type SPAKESupport struct {
+	Groups []int `asn1:"explicit,tag:0"`
+}
+
+type SPAKEChallenge struct {
+	Group   int                 `asn1:"explicit,tag:0"`
+	PubKey  []byte              `asn1:"explicit,tag:1"`
+	Factors []SPAKESecondFactor `asn1:"explicit,tag:2"`
+}
+
+type SPAKESecondFactor struct {
+	Type int    `asn1:"explicit,tag:0"`
+	Data []byte `asn1:"explicit,optional,tag:1"`
+}
+
+type SPAKEResponse struct {
+	PubKey []byte              `asn1:"explicit,tag:0"`
+	Factor types.EncryptedData `asn1:"explicit,tag:1"`
+}
+
+// Unmarshal bytes b into the PASPAKE struct.
+func (p *PASPAKE) Unmarshal(b []byte) error {
+	var rv asn1.RawValue
+	_, err := asn1.Unmarshal(b, &rv)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling PA-SPAKE: %v", err)
+	}
+	if rv.Class != 2 {
+		return errors.New("PA-SPAKE is not a context specific choice")
+	}
+	switch rv.Tag {
+	case 0:
+		p.Support = new(SPAKESupport)
+		_, err = asn1.Unmarshal(rv.Bytes, p.Support)
+	case 1:
+		p.Challenge = new(SPAKEChallenge)
+		_, err = asn1.Unmarshal(rv.Bytes, p.Challenge)
+	case 2:
+		p.Response = new(SPAKEResponse)
+		_, err = asn1.Unmarshal(rv.Bytes, p.Response)
+	case 3:
+		p.EncData = new(types.EncryptedData)
+		_, err = asn1.Unmarshal(rv.Bytes, p.EncData)
+	default:
+		return fmt.Errorf("Unknown PA-SPAKE choice: %d", rv.Tag)
+	}
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling PA-SPAKE choice %d: %v", rv.Tag, err)
+	}
+	return nil
+}
+
+// Marshal the PASPAKE struct.
+func (p *PASPAKE) Marshal() ([]byte, error) {
+	var tag int
+	var v interface{}
+	switch {
+	case p.Support != nil:
+		tag, v = 0, *p.Support
+	case p.Challenge != nil:
+		tag, v = 1, *p.Challenge
+	case p.Response != nil:
+		tag, v = 2, *p.Response
+	case p.EncData != nil:
+		tag, v = 3, *p.EncData
+	default:
+		return nil, errors.New("PA-SPAKE has no message")
+	}
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling PA-SPAKE choice %d: %v", tag, err)
+	}
+	b, err = asn1.Marshal(asn1.RawValue{Class: 2, IsCompound: true, Tag: tag, Bytes: b})
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling PA-SPAKE: %v", err)
+	}
+	return b, nil
+}
+
+// A second factor for SPAKE pre-authentication.
+// Implementations provide the factor specific data sent to the KDC, which is encrypted under a key derived from the
+// SPAKE exchange.
+type SecondFactor interface {
+	// The SPAKE second factor type number.
+	Type() int
+	// Get the data to send to the KDC for the factor.
+	// challenge is the data offered by the KDC for the factor in the SPAKEChallenge or, where the factor needs more
+	// than one round trip, the data from the KDC's subsequent encdata message.
+	Respond(challenge []byte) ([]byte, error)
+}
+
+// The SF-NONE second factor, used when no other factor is required.
+type noneFactor struct{}
+
+func (f noneFactor) Type() int {
+	return SFNone
+}
+
+func (f noneFactor) Respond(challenge []byte) ([]byte, error) {
+	return nil, nil
+}
+
+// Get the PA-SPAKE padata for the support message listing the groups the client supports.
+// The bytes of the padata value must be passed to NewRequest as they form part of the transcript hash.
+func SupportPAData() (types.PAData, error) {
+	var pa types.PAData
+	p := PASPAKE{Support: &SPAKESupport{Groups: SupportedGroups}}
+	b, err := p.Marshal()
+	if err != nil {
+		return pa, err
+	}
+	pa = types.PAData{
+		PADataType:  patype.PA_SPAKE,
+		PADataValue: b,
+	}
+	return pa, nil
+}
+
+// The client's state of a SPAKE exchange.
+type Request struct {
+	PAData  types.PAData
+	group   group
+	key     types.EncryptionKey
+	w       []byte
+	result  []byte
+	thash   []byte
+	reqBody []byte
+	factor  SecondFactor
+	n       uint32
+}
+
+// Process the KDC's challenge and create the PA-SPAKE response.
+// key is the initial reply key derived from the client's long term key. support is the PA-SPAKE value of the support
+// message sent, or nil if the KDC sent the challenge without one. challenge is the PA-SPAKE value received from the KDC.
+// reqBody is the body of the AS_REQ that will carry the response.
+// The first of the factors provided that the KDC offers is used, falling back to SF-NONE.
+func NewRequest(key types.EncryptionKey, support, challenge []byte, reqBody messages.KDCReqBody, factors []SecondFactor) (*Request, error) {
+	var p PASPAKE
+	err := p.Unmarshal(challenge)
+	if err != nil {
+		return nil, err
+	}
+	if p.Challenge == nil {
+		return nil, errors.New("PA-SPAKE from KDC is not a challenge")
+	}
+	g, err := getGroup(p.Challenge.Group)
+	if err != nil {
+		return nil, err
+	}
+	r := &Request{
+		group: g,
+		key:   key,
+	}
+	r.reqBody, err = reqBody.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("Error marshalling request body: %v", err)
+	}
+	var fdata []byte
+	for _, f := range append(factors, noneFactor{}) {
+		for _, o := range p.Challenge.Factors {
+			if o.Type == f.Type() && r.factor == nil {
+				r.factor = f
+				fdata = o.Data
+			}
+		}
+	}
+	if r.factor == nil {
+		return nil, errors.New("KDC did not offer a supported SPAKE second factor")
+	}
+	r.w, err = r.multiplier()
+	if err != nil {
+		return nil, err
+	}
+	priv, pub, err := g.keygen(r.w)
+	if err != nil {
+		return nil, err
+	}
+	r.result, err = g.result(r.w, priv, p.Challenge.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	// Ref: draft-ietf-kitten-krb-spake-preauth Section 6.3
+	r.thash = make([]byte, g.hash().Size())
+	if support != nil {
+		r.updateTranscript(support)
+	}
+	r.updateTranscript(challenge, pub)
+	// The first factor is encrypted in K'[1]
+	r.n = 1
+	ed, err := r.encryptFactor(fdata)
+	if err != nil {
+		return nil, err
+	}
+	resp := PASPAKE{Response: &SPAKEResponse{PubKey: pub, Factor: ed}}
+	b, err := resp.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	r.PAData = types.PAData{
+		PADataType:  patype.PA_SPAKE,
+		PADataValue: b,
+	}
+	return r, nil
+}
+
+// Process an encdata message from the KDC for a second factor that needs more than one round trip.
+// The PAData of the request is updated with the client's next encdata message.
+func (r *Request) Continue(encdata []byte) error {
+	var p PASPAKE
+	err := p.Unmarshal(encdata)
+	if err != nil {
+		return err
+	}
+	if p.EncData == nil {
+		return errors.New("PA-SPAKE from KDC is not encdata")
+	}
+	r.n++
+	k, err := r.deriveKey(r.n)
+	if err != nil {
+		return err
+	}
+	et, err := crypto.GetEtype(k.KeyType)
+	if err != nil {
+		return fmt.Errorf("Error getting etype of SPAKE key: %v", err)
+	}
+	b, err := crypto.DecryptEncPart(k.KeyValue, *p.EncData, et, keyusage.KEY_USAGE_SPAKE)
+	if err != nil {
+		return fmt.Errorf("Error decrypting PA-SPAKE encdata from KDC: %v", err)
+	}
+	var sf SPAKESecondFactor
+	_, err = asn1.Unmarshal(b, &sf)
+	if err != nil {
+		return fmt.Errorf("Error unmarshalling SPAKE second factor from KDC: %v", err)
+	}
+	if sf.Type != r.factor.Type() {
+		return fmt.Errorf("SPAKE second factor type from KDC does not match that selected. Expected: %d; Actual: %d", r.factor.Type(), sf.Type)
+	}
+	r.n++
+	ed, err := r.encryptFactor(sf.Data)
+	if err != nil {
+		return err
+	}
+	resp := PASPAKE{EncData: &ed}
+	r.PAData.PADataValue, err = resp.Marshal()
+	return err
+}
+
+// Get the reply key, K'[0], that replaces the initial reply key for the AS_REP.
+func (r *Request) ReplyKey() (types.EncryptionKey, error) {
+	return r.deriveKey(0)
+}
+
+// Get the factor's data and encrypt it in K'[n].
+func (r *Request) encryptFactor(challenge []byte) (types.EncryptedData, error) {
+	var ed types.EncryptedData
+	d, err := r.factor.Respond(challenge)
+	if err != nil {
+		return ed, fmt.Errorf("Error getting SPAKE second factor data: %v", err)
+	}
+	b, err := asn1.Marshal(SPAKESecondFactor{Type: r.factor.Type(), Data: d})
+	if err != nil {
+		return ed, fmt.Errorf("Error marshalling SPAKE second factor: %v", err)
+	}
+	k, err := r.deriveKey(r.n)
+	if err != nil {
+		return ed, err
+	}
+	ed, err = crypto.GetEncryptedData(b, k, keyusage.KEY_USAGE_SPAKE, 0)
+	if err != nil {
+		return ed, fmt.Errorf("Error encrypting SPAKE second factor: %v", err)
+	}
+	return ed, nil
+}
+
+// Update the transcript hash: thash = H(thash || data...)
+func (r *Request) updateTranscript(data ...[]byte) {
+	h := r.group.hash().New()
+	h.Write(r.thash)
+	for _, d := range data {
+		h.Write(d)
+	}
+	r.thash = h.Sum(nil)
+}
+
+// Derive the multiplier w = PRF+(initial reply key, "SPAKEsecret" || group)
+func (r *Request) multiplier() ([]byte, error) {
+	et, err := crypto.GetEtype(r.key.KeyType)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting etype of initial reply key: %v", err)
+	}
+	b := append([]byte("SPAKEsecret"), be32(uint32(r.group.id()))...)
+	w, err := crypto.PRFPlus(r.key.KeyValue, b, r.group.multLen(), et)
+	if err != nil {
+		return nil, fmt.Errorf("Error deriving SPAKE multiplier: %v", err)
+	}
+	return w, nil
+}
+
+// Derive K'[n] = random-to-key(PRF+(initial reply key,
+// "SPAKEkey" || group || etype || w || K || thash || request body || n))
+func (r *Request) deriveKey(n uint32) (types.EncryptionKey, error) {
+	var key types.EncryptionKey
+	et, err := crypto.GetEtype(r.key.KeyType)
+	if err != nil {
+		return key, fmt.Errorf("Error getting etype of initial reply key: %v", err)
+	}
+	b := []byte("SPAKEkey")
+	b = append(b, be32(uint32(r.group.id()))...)
+	b = append(b, be32(uint32(r.key.KeyType))...)
+	b = append(b, r.w...)
+	b = append(b, r.result...)
+	b = append(b, r.thash...)
+	b = append(b, r.reqBody...)
+	b = append(b, be32(n)...)
+	kb, err := crypto.PRFPlus(r.key.KeyValue, b, et.GetKeySeedBitLength()/8, et)
+	if err != nil {
+		return key, fmt.Errorf("Error deriving SPAKE key: %v", err)
+	}
+	key = types.EncryptionKey{
+		KeyType:  r.key.KeyType,
+		KeyValue: et.RandomToKey(kb),
+	}
+	return key, nil
+}
+
+func be32(i uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, i)
+	return b
+}
@@ -0,0 +1,342 @@
+package spake
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"filippo.io/edwards25519"
+	"filippo.io/nistec"
+	"github.com/jcmturner/asn1"
+	"github.com/jcmturner/gokrb5/config"
+	krbcrypto "github.com/jcmturner/gokrb5/crypto"
+	"github.com/jcmturner/gokrb5/iana/etype"
+	"github.com/jcmturner/gokrb5/iana/keyusage"
+	"github.com/jcmturner/gokrb5/messages"
+	"github.com/jcmturner/gokrb5/testdata"
+	"github.com/jcmturner/gokrb5/types"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"testing"
+)
+
+type testFactor struct{}
+
+func (f testFactor) Type() int {
+	return 2
+}
+
+func (f testFactor) Respond(challenge []byte) ([]byte, error) {
+	return append([]byte("response to "), challenge...), nil
+}
+
+// The curve and encoded M and N constants of a NIST curve group.
+func testNISTCurve(t *testing.T, g group) (elliptic.Curve, []byte, []byte) {
+	switch g := g.(type) {
+	case nistGroup[*nistec.P256Point]:
+		return elliptic.P256(), g.m.BytesCompressed(), g.n.BytesCompressed()
+	case nistGroup[*nistec.P384Point]:
+		return elliptic.P384(), g.m.BytesCompressed(), g.n.BytesCompressed()
+	case nistGroup[*nistec.P521Point]:
+		return elliptic.P521(), g.m.BytesCompressed(), g.n.BytesCompressed()
+	}
+	t.Fatalf("Unknown group type")
+	return nil, nil, nil
+}
+
+// The multiplier bytes as a big-endian integer reduced modulo the group order.
+func testNISTReduce(curve elliptic.Curve, w []byte) []byte {
+	i := new(big.Int).SetBytes(w)
+	return i.Mod(i, curve.Params().N).Bytes()
+}
+
+// Generate the KDC's private scalar and public value S = y*G + w*N.
+func testKDCKeygen(t *testing.T, g group, w []byte) ([]byte, []byte) {
+	if _, ok := g.(edwards25519Group); ok {
+		n, _ := edDecode(ed25519N)
+		y, _ := edRandomScalar()
+		ws, _ := edScalar(w)
+		s := edwards25519.NewIdentityPoint().ScalarBaseMult(y)
+		s.MultByCofactor(s)
+		s.Add(s, edwards25519.NewIdentityPoint().ScalarMult(ws, n))
+		return y.Bytes(), s.Bytes()
+	}
+	curve, _, nb := testNISTCurve(t, g)
+	nx, ny := elliptic.UnmarshalCompressed(curve, nb)
+	y, _ := rand.Int(rand.Reader, curve.Params().N)
+	gx, gy := curve.ScalarBaseMult(y.Bytes())
+	wx, wy := curve.ScalarMult(nx, ny, testNISTReduce(curve, w))
+	sx, sy := curve.Add(gx, gy, wx, wy)
+	return y.Bytes(), elliptic.MarshalCompressed(curve, sx, sy)
+}
+
+// Compute the KDC's result K = y*(T - w*M).
+func testKDCResult(t *testing.T, g group, w, y, clientPub []byte) []byte {
+	if _, ok := g.(edwards25519Group); ok {
+		m, _ := edDecode(ed25519M)
+		tp, err := edDecode(clientPub)
+		if err != nil {
+			t.Fatalf("Client public value is not a valid point: %v", err)
+		}
+		ws, _ := edScalar(w)
+		ys, _ := edwards25519.NewScalar().SetCanonicalBytes(y)
+		p := edwards25519.NewIdentityPoint().Subtract(tp, edwards25519.NewIdentityPoint().ScalarMult(ws, m))
+		k := edwards25519.NewIdentityPoint().ScalarMult(ys, p)
+		return k.MultByCofactor(k).Bytes()
+	}
+	curve, mb, _ := testNISTCurve(t, g)
+	mx, my := elliptic.UnmarshalCompressed(curve, mb)
+	tx, ty := elliptic.UnmarshalCompressed(curve, clientPub)
+	if tx == nil {
+		t.Fatalf("Client public value is not a valid point")
+	}
+	wx, wy := curve.ScalarMult(mx, my, testNISTReduce(curve, w))
+	wy.Sub(curve.Params().P, wy)
+	px, py := curve.Add(tx, ty, wx, wy)
+	kx, ky := curve.ScalarMult(px, py, y)
+	return elliptic.MarshalCompressed(curve, kx, ky)
+}
+
+// The KDC's side of the key derivation, written out from the draft independently of the client's implementation.
+type testKDC struct {
+	g     group
+	key   types.EncryptionKey
+	w     []byte
+	k     []byte
+	thash []byte
+	body  []byte
+}
+
+func newTestKDC(t *testing.T, g group, key types.EncryptionKey) *testKDC {
+	et, _ := krbcrypto.GetEtype(key.KeyType)
+	gb := make([]byte, 4)
+	binary.BigEndian.PutUint32(gb, uint32(g.id()))
+	w, err := krbcrypto.PRFPlus(key.KeyValue, append([]byte("SPAKEsecret"), gb...), g.multLen(), et)
+	if err != nil {
+		t.Fatalf("Error deriving multiplier: %v", err)
+	}
+	return &testKDC{g: g, key: key, w: w, thash: make([]byte, g.hash().Size())}
+}
+
+// thash = H(thash || data) where data is the concatenation of the messages.
+func (k *testKDC) transcript(msgs ...[]byte) {
+	h := k.g.hash().New()
+	h.Write(k.thash)
+	h.Write(bytes.Join(msgs, nil))
+	k.thash = h.Sum(nil)
+}
+
+func (k *testKDC) replyKey(t *testing.T, n uint32) types.EncryptionKey {
+	et, _ := krbcrypto.GetEtype(k.key.KeyType)
+	var buf bytes.Buffer
+	buf.WriteString("SPAKEkey")
+	binary.Write(&buf, binary.BigEndian, uint32(k.g.id()))
+	binary.Write(&buf, binary.BigEndian, uint32(k.key.KeyType))
+	buf.Write(k.w)
+	buf.Write(k.k)
+	buf.Write(k.thash)
+	buf.Write(k.body)
+	binary.Write(&buf, binary.BigEndian, n)
+	b, err := krbcrypto.PRFPlus(k.key.KeyValue, buf.Bytes(), et.GetKeySeedBitLength()/8, et)
+	if err != nil {
+		t.Fatalf("Error deriving K'[%d]: %v", n, err)
+	}
+	return types.EncryptionKey{KeyType: k.key.KeyType, KeyValue: et.RandomToKey(b)}
+}
+
+func testReqBody(t *testing.T) messages.KDCReqBody {
+	c, err := config.NewConfigFromString(testdata.TEST_KRB5CONF)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	return messages.NewASReq(c, "testuser1").ReqBody
+}
+
+// Run a SPAKE exchange against a simulated KDC and check both sides derive the same keys.
+func testExchange(t *testing.T, groupID int, support bool, factors []SecondFactor) (*Request, *testKDC, SPAKESecondFactor) {
+	key, err := krbcrypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	body := testReqBody(t)
+	var sb []byte
+	if support {
+		pa, err := SupportPAData()
+		if err != nil {
+			t.Fatalf("Error creating support padata: %v", err)
+		}
+		sb = pa.PADataValue
+	}
+	g, err := getGroup(groupID)
+	if err != nil {
+		t.Fatalf("Error getting group: %v", err)
+	}
+	kdc := newTestKDC(t, g, key)
+	y, s := testKDCKeygen(t, g, kdc.w)
+	ch := PASPAKE{Challenge: &SPAKEChallenge{
+		Group:  groupID,
+		PubKey: s,
+		Factors: []SPAKESecondFactor{
+			{Type: SFNone},
+			{Type: 2, Data: []byte("challenge")},
+		},
+	}}
+	chb, err := ch.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling challenge: %v", err)
+	}
+	r, err := NewRequest(key, sb, chb, body, factors)
+	if err != nil {
+		t.Fatalf("Error creating SPAKE request: %v", err)
+	}
+	var resp PASPAKE
+	err = resp.Unmarshal(r.PAData.PADataValue)
+	if err != nil {
+		t.Fatalf("Error unmarshalling response: %v", err)
+	}
+	if resp.Response == nil {
+		t.Fatalf("PA-SPAKE from client is not a response")
+	}
+	kdc.k = testKDCResult(t, g, kdc.w, y, resp.Response.PubKey)
+	if support {
+		kdc.transcript(sb)
+	}
+	kdc.transcript(chb, resp.Response.PubKey)
+	kdc.body, _ = body.Marshal()
+	k1 := kdc.replyKey(t, 1)
+	et, _ := krbcrypto.GetEtype(k1.KeyType)
+	b, err := krbcrypto.DecryptEncPart(k1.KeyValue, resp.Response.Factor, et, keyusage.KEY_USAGE_SPAKE)
+	if err != nil {
+		t.Fatalf("KDC could not decrypt second factor: %v", err)
+	}
+	var sf SPAKESecondFactor
+	_, err = asn1.Unmarshal(b, &sf)
+	if err != nil {
+		t.Fatalf("Error unmarshalling second factor: %v", err)
+	}
+	return r, kdc, sf
+}
+
+func TestRequest_groups(t *testing.T) {
+	for _, id := range SupportedGroups {
+		r, kdc, sf := testExchange(t, id, true, nil)
+		assert.Equal(t, SFNone, sf.Type, "Second factor type not as expected for group %d", id)
+		assert.Equal(t, kdc.k, r.result, "SPAKE result not as expected for group %d", id)
+		assert.Equal(t, kdc.thash, r.thash, "Transcript hash not as expected for group %d", id)
+		ck, err := r.ReplyKey()
+		if err != nil {
+			t.Fatalf("Error getting client reply key: %v", err)
+		}
+		assert.Equal(t, kdc.replyKey(t, 0), ck, "Reply key not as expected for group %d", id)
+	}
+}
+
+func TestRequest_optimisticChallenge(t *testing.T) {
+	r, kdc, _ := testExchange(t, GroupP256, false, nil)
+	ck, _ := r.ReplyKey()
+	assert.Equal(t, kdc.replyKey(t, 0), ck, "Reply key not as expected")
+}
+
+func TestRequest_secondFactor(t *testing.T) {
+	_, _, sf := testExchange(t, GroupEdwards25519, true, []SecondFactor{testFactor{}})
+	assert.Equal(t, 2, sf.Type, "Second factor type not as expected")
+	assert.Equal(t, []byte("response to challenge"), sf.Data, "Second factor data not as expected")
+}
+
+func TestRequest_unsupportedGroup(t *testing.T) {
+	key, _ := krbcrypto.GenerateKey(etype.AES256_CTS_HMAC_SHA1_96)
+	ch := PASPAKE{Challenge: &SPAKEChallenge{Group: 99, PubKey: []byte{1}, Factors: []SPAKESecondFactor{{Type: SFNone}}}}
+	chb, _ := ch.Marshal()
+	_, err := NewRequest(key, nil, chb, testReqBody(t), nil)
+	assert.Error(t, err, "Unsupported group should not be accepted")
+}
+
+func TestRequest_eachGroup(t *testing.T) {
+	for _, id := range []int{GroupEdwards25519, GroupP256, GroupP384, GroupP521} {
+		r, kdc, _ := testExchange(t, id, false, nil)
+		assert.Equal(t, kdc.k, r.result, "SPAKE result not as expected for group %d", id)
+		ck, err := r.ReplyKey()
+		if err != nil {
+			t.Fatalf("Error getting client reply key for group %d: %v", id, err)
+		}
+		assert.Equal(t, kdc.replyKey(t, 0), ck, "Reply key not as expected for group %d", id)
+	}
+}
+
+func TestNISTIsLess(t *testing.T) {
+	assert.True(t, nistIsLess([]byte{0x01, 0xff}, []byte{0x02, 0x00}), "0x01ff should be less than 0x0200")
+	assert.False(t, nistIsLess([]byte{0x02, 0x00}, []byte{0x02, 0x00}), "Equal values should not be less")
+	assert.False(t, nistIsLess([]byte{0x02, 0x01}, []byte{0x02, 0x00}), "0x0201 should not be less than 0x0200")
+}
+
+func TestPASPAKE_Marshal(t *testing.T) {
+	p := PASPAKE{Support: &SPAKESupport{Groups: SupportedGroups}}
+	b, err := p.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling PA-SPAKE: %v", err)
+	}
+	var u PASPAKE
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshalling PA-SPAKE: %v", err)
+	}
+	assert.Equal(t, SupportedGroups, u.Support.Groups, "Groups not as expected")
+	assert.Nil(t, u.Challenge, "Challenge should not be set")
+}
+
+func TestGroupConstants(t *testing.T) {
+	for _, id := range SupportedGroups {
+		_, err := getGroup(id)
+		assert.NoError(t, err, "Constants for group %d not valid", id)
+	}
+	_, err := edDecode(ed25519M)
+	assert.NoError(t, err, "edwards25519 M not valid")
+	_, err = edDecode(ed25519N)
+	assert.NoError(t, err, "edwards25519 N not valid")
+}
+
+// Check the edwards25519 arithmetic against the public key derivation of crypto/ed25519.
+func TestEdwards25519(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	rand.Read(seed)
+	h := sha512.Sum512(seed)
+	h[0] &= 248
+	h[31] &= 127
+	h[31] |= 64
+	a, err := edScalar(h[:32])
+	if err != nil {
+		t.Fatalf("Error getting scalar: %v", err)
+	}
+	pub := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+	assert.Equal(t, []byte(pub), edwards25519.NewIdentityPoint().ScalarBaseMult(a).Bytes(), "Public key not as expected")
+	p, err := edDecode(pub)
+	if err != nil {
+		t.Fatalf("Error decoding point: %v", err)
+	}
+	assert.Equal(t, []byte(pub), p.Bytes(), "Encoding of decoded point not as expected")
+}
+
+// Check the reduction of 32 byte multipliers modulo the group order.
+func TestEdScalar(t *testing.T) {
+	l, _ := new(big.Int).SetString("7237005577332262213973186563042994240857116359379907606001950938285454250989", 10)
+	for _, b := range [][]byte{bytes.Repeat([]byte{0xff}, 32), make([]byte, 32), append(bytes.Repeat([]byte{0x11}, 31), 0xf0)} {
+		s, err := edScalar(b)
+		if err != nil {
+			t.Fatalf("Error getting scalar: %v", err)
+		}
+		// Little-endian to big-endian for big.Int
+		r := make([]byte, 32)
+		for i := range b {
+			r[31-i] = b[i]
+		}
+		e := new(big.Int).Mod(new(big.Int).SetBytes(r), l).Bytes()
+		for i, j := 0, len(e)-1; i < j; i, j = i+1, j-1 {
+			e[i], e[j] = e[j], e[i]
+		}
+		assert.Equal(t, append(e, make([]byte, 32-len(e))...), s.Bytes(), "Scalar not reduced as expected for %x", b)
+	}
+	_, err := edScalar(make([]byte, 31))
+	assert.Error(t, err, "Scalar of the wrong length should not be accepted")
+}
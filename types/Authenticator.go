@@ -5,7 +5,6 @@ import (
 	"github.com/jcmturner/asn1"
 	"github.com/jcmturner/gokrb5/iana"
 	"github.com/jcmturner/gokrb5/iana/asnAppTag"
-	"github.com/jcmturner/gokrb5/iana/nametype"
 	"time"
 	"github.com/jcmturner/gokrb5/asn1tools"
 )
@@ -42,21 +41,26 @@ type Authenticator struct {
 	AuthorizationData AuthorizationData `asn1:"explicit,optional,tag:8"`
 }
 
+// Create a new authenticator for the client. The username may have multiple components separated by '/'.
 func NewAuthenticator(realm, username string) Authenticator {
 	t := time.Now()
+	cname, _ := ParsePrincipalName(username)
 	return Authenticator{
 		AVNO:   iana.PVNO,
 		CRealm: realm,
-		CName: PrincipalName{
-			NameType:   nametype.KRB_NT_PRINCIPAL,
-			NameString: []string{username},
-		},
+		CName:  cname,
 		Cksum: Checksum{},
 		Cusec: int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
 		CTime: t,
 	}
 }
 
+// Set the client's time in the authenticator.
+func (a *Authenticator) SetTime(t time.Time) {
+	a.CTime = t
+	a.Cusec = int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6))
+}
+
 func (a *Authenticator) Unmarshal(b []byte) error {
 	_, err := asn1.UnmarshalWithParams(b, a, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.Authenticator))
 	return err
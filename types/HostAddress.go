@@ -4,7 +4,12 @@ package types
 // Section: 5.2.5
 
 import (
-	"github.com/jcmturner/asn1"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/jcmturner/gokrb5/iana/addrtype"
+	"net"
+	"strings"
 )
 
 /*
@@ -38,8 +43,127 @@ type HostAddress struct {
 	Address  []byte `asn1:"explicit,tag:1"`
 }
 
+// Create a new HostAddress for the IP address. IPv4 and IPv6 addresses are supported.
+func HostAddressFromNetIP(ip net.IP) (HostAddress, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return NewHostAddressIPv4(ip4)
+	}
+	return NewHostAddressIPv6(ip)
+}
+
+// Create a new HostAddress for the IPv4 address. The address is encoded as 4 octets. Ref: RFC 4120 Section 7.5.3
+func NewHostAddressIPv4(ip net.IP) (HostAddress, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return HostAddress{}, fmt.Errorf("%v is not an IPv4 address", ip)
+	}
+	return HostAddress{AddrType: addrtype.IPv4, Address: []byte(ip4)}, nil
+}
+
+// Create a new HostAddress for the IPv6 address. The address is encoded as 16 octets.
+// IPv4-mapped addresses must be encoded as IPv4 addresses.
+func NewHostAddressIPv6(ip net.IP) (HostAddress, error) {
+	if ip.To4() != nil || len(ip) != net.IPv6len {
+		return HostAddress{}, fmt.Errorf("%v is not an IPv6 address", ip)
+	}
+	return HostAddress{AddrType: addrtype.IPv6, Address: []byte(ip)}, nil
+}
+
+// Create a new HostAddress for the NetBIOS name.
+// The name of 1 to 15 characters is padded with spaces to 15 octets followed by a NUL octet.
+func NewHostAddressNetBios(name string) (HostAddress, error) {
+	if len(name) < 1 || len(name) > 15 {
+		return HostAddress{}, fmt.Errorf("Invalid NetBIOS name length: %s", name)
+	}
+	b := make([]byte, 16)
+	copy(b, []byte(fmt.Sprintf("%-15s", name)))
+	return HostAddress{AddrType: addrtype.NetBios, Address: b}, nil
+}
+
+// Create a new directional HostAddress. Ref: RFC 4120 Section 7.5.3
+// This is used in place of a network address where one is not available, such as through a proxy. The initiator
+// of the exchange uses 0 and the responder 1, encoded as 4 octets.
+func NewHostAddressDirectional(initiator bool) HostAddress {
+	b := make([]byte, 4)
+	if !initiator {
+		b[3] = 1
+	}
+	return HostAddress{AddrType: addrtype.Directional, Address: b}
+}
+
+// Get the HostAddresses for the IP addresses of the local host's interfaces. Loopback addresses are excluded.
+func LocalHostAddresses() (HostAddresses, error) {
+	var h HostAddresses
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return h, fmt.Errorf("Error getting local interface addresses: %v", err)
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() {
+			continue
+		}
+		ha, err := HostAddressFromNetIP(ipnet.IP)
+		if err != nil {
+			continue
+		}
+		h = append(h, ha)
+	}
+	return h, nil
+}
+
+// Get the address as a string.
+// IP addresses are returned in their usual text form and NetBIOS names without padding.
 func (h *HostAddress) GetAddress() (string, error) {
-	var b []byte
-	_, err := asn1.Unmarshal(h.Address, &b)
-	return string(b), err
+	switch h.AddrType {
+	case addrtype.IPv4:
+		if len(h.Address) != net.IPv4len {
+			return "", errors.New("Invalid IPv4 address length")
+		}
+		return net.IP(h.Address).String(), nil
+	case addrtype.IPv6:
+		if len(h.Address) != net.IPv6len {
+			return "", errors.New("Invalid IPv6 address length")
+		}
+		return net.IP(h.Address).String(), nil
+	case addrtype.NetBios:
+		if len(h.Address) != 16 {
+			return "", errors.New("Invalid NetBIOS address length")
+		}
+		return strings.TrimRight(string(h.Address[:15]), " "), nil
+	}
+	return "", fmt.Errorf("Unsupported address type: %d", h.AddrType)
+}
+
+// Query if the HostAddress is the same as that provided.
+func (h *HostAddress) Equal(a HostAddress) bool {
+	return h.AddrType == a.AddrType && bytes.Equal(h.Address, a.Address)
+}
+
+// Query if the HostAddresses contains the HostAddress.
+func HostAddressesContains(h HostAddresses, a HostAddress) bool {
+	for _, e := range h {
+		if e.Equal(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// Query if the two HostAddresses contain the same addresses, in any order.
+func HostAddressesEqual(h, a HostAddresses) bool {
+	if len(h) != len(a) {
+		return false
+	}
+	for _, e := range a {
+		if !HostAddressesContains(h, e) {
+			return false
+		}
+	}
+	for _, e := range h {
+		if !HostAddressesContains(a, e) {
+			return false
+		}
+	}
+	return true
 }
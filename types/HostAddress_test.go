@@ -0,0 +1,75 @@
+package types
+
+import (
+	"github.com/jcmturner/gokrb5/iana/addrtype"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+)
+
+func TestHostAddressFromNetIP(t *testing.T) {
+	var tests = []struct {
+		ip       string
+		addrType int
+		length   int
+	}{
+		{"10.80.88.88", addrtype.IPv4, 4},
+		{"::ffff:10.80.88.88", addrtype.IPv4, 4},
+		{"fe80::1", addrtype.IPv6, 16},
+	}
+	for _, test := range tests {
+		h, err := HostAddressFromNetIP(net.ParseIP(test.ip))
+		if err != nil {
+			t.Fatalf("Error creating host address for %s: %v", test.ip, err)
+		}
+		assert.Equal(t, test.addrType, h.AddrType, "Address type not as expected for %s", test.ip)
+		assert.Equal(t, test.length, len(h.Address), "Address length not as expected for %s", test.ip)
+		s, err := h.GetAddress()
+		if err != nil {
+			t.Fatalf("Error getting address for %s: %v", test.ip, err)
+		}
+		assert.Equal(t, net.ParseIP(test.ip).String(), s, "Address string not as expected")
+	}
+}
+
+func TestNewHostAddressIPv6_IPv4(t *testing.T) {
+	_, err := NewHostAddressIPv6(net.ParseIP("10.80.88.88"))
+	assert.Error(t, err, "IPv4 address should not be accepted as IPv6")
+	_, err = NewHostAddressIPv4(net.ParseIP("fe80::1"))
+	assert.Error(t, err, "IPv6 address should not be accepted as IPv4")
+}
+
+func TestNewHostAddressNetBios(t *testing.T) {
+	h, err := NewHostAddressNetBios("HOST1")
+	if err != nil {
+		t.Fatalf("Error creating NetBIOS host address: %v", err)
+	}
+	assert.Equal(t, addrtype.NetBios, h.AddrType, "Address type not as expected")
+	assert.Equal(t, []byte("HOST1          \x00"), h.Address, "Address not as expected")
+	s, err := h.GetAddress()
+	if err != nil {
+		t.Fatalf("Error getting address: %v", err)
+	}
+	assert.Equal(t, "HOST1", s, "Address string not as expected")
+	_, err = NewHostAddressNetBios("ANAMETHATISTOOLONG")
+	assert.Error(t, err, "NetBIOS name too long should not be accepted")
+}
+
+func TestHostAddressesEqual(t *testing.T) {
+	a, _ := NewHostAddressIPv4(net.ParseIP("10.80.88.88"))
+	b, _ := NewHostAddressIPv6(net.ParseIP("fe80::1"))
+	c, _ := NewHostAddressNetBios("HOST1")
+	assert.True(t, HostAddressesEqual(HostAddresses{a, b}, HostAddresses{b, a}), "Addresses in a different order should be equal")
+	assert.False(t, HostAddressesEqual(HostAddresses{a, b}, HostAddresses{a, c}), "Different addresses should not be equal")
+	assert.False(t, HostAddressesEqual(HostAddresses{a}, HostAddresses{a, b}), "Different numbers of addresses should not be equal")
+	assert.True(t, HostAddressesContains(HostAddresses{a, b}, b), "Address should be contained")
+	assert.False(t, HostAddressesContains(HostAddresses{a, b}, c), "Address should not be contained")
+}
+
+func TestNewHostAddressDirectional(t *testing.T) {
+	h := NewHostAddressDirectional(true)
+	assert.Equal(t, addrtype.Directional, h.AddrType, "Address type not as expected")
+	assert.Equal(t, []byte{0, 0, 0, 0}, h.Address, "Initiator address not as expected")
+	h = NewHostAddressDirectional(false)
+	assert.Equal(t, []byte{0, 0, 0, 1}, h.Address, "Responder address not as expected")
+}
@@ -78,11 +78,12 @@ const (
 	PreAuthent             = 10
 	HWAuthent              = 11
 	OptHardwareAuth        = 11
-	RequestAnonymous       = 12
 	TransitedPolicyChecked = 12
 	OKAsDelegate           = 13
 	EncPARep               = 15
 	Canonicalize           = 15
+	Anonymous              = 16
+	RequestAnonymous       = 16
 	DisableTransitedCheck  = 26
 	RenewableOK            = 27
 	EncTktInSkey           = 28
@@ -90,6 +91,13 @@ const (
 	Validate               = 31
 )
 
+// AP Options. Ref RFC 4120 Section 5.5.1
+const (
+	APOptionReserved       = 0
+	APOptionUseSessionKey  = 1
+	APOptionMutualRequired = 2
+)
+
 func NewKrbFlags() asn1.BitString {
 	f := asn1.BitString{}
 	f.Bytes = make([]byte, 4)
@@ -35,7 +35,12 @@ func (pas *PADataSequence) Contains(patype int) bool {
 }
 
 func GetPAEncTSEncAsnMarshalled() ([]byte, error) {
-	t := time.Now()
+	return GetPAEncTSEncAsnMarshalledAt(time.Now())
+}
+
+// Get the marshalled PA-ENC-TS-ENC for the time provided, for example the current time corrected by the offset of the
+// KDC's clock.
+func GetPAEncTSEncAsnMarshalledAt(t time.Time) ([]byte, error) {
 	p := PAEncTSEnc{
 		PATimestamp: t,
 		PAUSec:      int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
@@ -67,6 +72,59 @@ type PAReqEncPARep struct {
 	Chksum     []byte `asn1:"explicit,tag:1"`
 }
 
+// PA-PAC-REQUEST asks the KDC to include, or to leave out, the PAC in the ticket issued. Ref: MS-KILE 2.2.3
+type PAPACRequest struct {
+	IncludePAC bool `asn1:"explicit,tag:0"`
+}
+
+// Flags of the PA-PAC-OPTIONS. Ref: MS-KILE 2.2.10
+const (
+	PACOptionClaims                             = 0
+	PACOptionBranchAware                        = 1
+	PACOptionForwardToFullDC                    = 2
+	PACOptionResourceBasedConstrainedDelegation = 3
+)
+
+// PA-PAC-OPTIONS requests PAC related behaviour of the KDC on a TGS exchange. Ref: MS-KILE 2.2.10
+type PAPACOptions struct {
+	KerberosFlags asn1.BitString `asn1:"explicit,tag:0"`
+}
+
+// Create PA-PAC-REQUEST padata.
+func NewPACRequestPAData(includePAC bool) (PAData, error) {
+	b, err := asn1.Marshal(PAPACRequest{IncludePAC: includePAC})
+	if err != nil {
+		return PAData{}, fmt.Errorf("Error marshalling PA-PAC-REQUEST: %v", err)
+	}
+	return PAData{
+		PADataType:  patype.PA_PAC_REQUEST,
+		PADataValue: b,
+	}, nil
+}
+
+// Create PA-PAC-OPTIONS padata with the flags provided. The PACOption constants give the flag positions.
+func NewPACOptionsPAData(flags asn1.BitString) (PAData, error) {
+	b, err := asn1.Marshal(PAPACOptions{KerberosFlags: flags})
+	if err != nil {
+		return PAData{}, fmt.Errorf("Error marshalling PA-PAC-OPTIONS: %v", err)
+	}
+	return PAData{
+		PADataType:  patype.PA_PAC_OPTIONS,
+		PADataValue: b,
+	}, nil
+}
+
+// Set the padata in the sequence, replacing any existing padata of the same type.
+func (pas *PADataSequence) Set(pa PAData) {
+	for i := range *pas {
+		if (*pas)[i].PADataType == pa.PADataType {
+			(*pas)[i] = pa
+			return
+		}
+	}
+	*pas = append(*pas, pa)
+}
+
 func (pa *PAData) Unmarshal(b []byte) error {
 	_, err := asn1.Unmarshal(b, pa)
 	return err
@@ -82,6 +140,16 @@ func (pa *PAReqEncPARep) Unmarshal(b []byte) error {
 	return err
 }
 
+func (pa *PAPACRequest) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, pa)
+	return err
+}
+
+func (pa *PAPACOptions) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, pa)
+	return err
+}
+
 func (pa *PAEncTimestamp) Unmarshal(b []byte) error {
 	_, err := asn1.Unmarshal(b, pa)
 	return err
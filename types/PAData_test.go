@@ -3,6 +3,7 @@ package types
 import (
 	"encoding/hex"
 	"fmt"
+	"github.com/jcmturner/gokrb5/iana/patype"
 	"github.com/jcmturner/gokrb5/testdata"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -175,3 +176,37 @@ func TestUnmarshalETypeInfo2_only1(t *testing.T) {
 	assert.Equal(t, "Morton's #0", a[0].Salt, "Salt of first etype info2 entry not as expected")
 	assert.Equal(t, []byte("s2k: 0"), a[0].S2KParams, "String to key params of first etype info2 entry not as expected")
 }
+
+func TestNewPACOptionsPAData(t *testing.T) {
+	flags := NewKrbFlags()
+	SetFlag(&flags, PACOptionClaims)
+	SetFlag(&flags, PACOptionResourceBasedConstrainedDelegation)
+	pa, err := NewPACOptionsPAData(flags)
+	if err != nil {
+		t.Fatalf("Error creating PA-PAC-OPTIONS: %v", err)
+	}
+	assert.Equal(t, patype.PA_PAC_OPTIONS, pa.PADataType, "PAData type not as expected")
+	var o PAPACOptions
+	err = o.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("Error unmarshalling PA-PAC-OPTIONS: %v", err)
+	}
+	assert.True(t, IsFlagSet(&o.KerberosFlags, PACOptionClaims), "Claims flag not set")
+	assert.False(t, IsFlagSet(&o.KerberosFlags, PACOptionBranchAware), "Branch aware flag should not be set")
+	assert.True(t, IsFlagSet(&o.KerberosFlags, PACOptionResourceBasedConstrainedDelegation), "RBCD flag not set")
+}
+
+func TestPADataSequence_Set(t *testing.T) {
+	var pas PADataSequence
+	pa, _ := NewPACRequestPAData(true)
+	pas.Set(pa)
+	pa, _ = NewPACRequestPAData(false)
+	pas.Set(pa)
+	assert.Equal(t, 1, len(pas), "PA-PAC-REQUEST should have been replaced")
+	var r PAPACRequest
+	err := r.Unmarshal(pas[0].PADataValue)
+	if err != nil {
+		t.Fatalf("Error unmarshalling PA-PAC-REQUEST: %v", err)
+	}
+	assert.False(t, r.IncludePAC, "Include PAC not as expected")
+}
@@ -3,11 +3,67 @@ package types
 // Reference: https://www.ietf.org/rfc/rfc4120.txt
 // Section: 5.2.2
 
+import (
+	"github.com/jcmturner/gokrb5/iana/nametype"
+	"strings"
+)
+
+// Realm of the well-known anonymous principal. Ref: RFC 8062 Section 3
+const AnonymousRealm = "WELLKNOWN:ANONYMOUS"
+
 type PrincipalName struct {
 	NameType   int      `asn1:"explicit,tag:0"`
 	NameString []string `asn1:"generalstring,explicit,tag:1"`
 }
 
+// Parse a principal name string of the form component/component@REALM into the principal name and realm.
+// A backslash escapes the character following it, for example a '/' or '@' within a component. The realm is empty if
+// the string does not include one. The name type of the principal name is KRB_NT_PRINCIPAL.
+func ParsePrincipalName(s string) (PrincipalName, string) {
+	pn := PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL}
+	var c []byte
+	inRealm := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			c = append(c, s[i])
+		case s[i] == '/' && !inRealm:
+			pn.NameString = append(pn.NameString, string(c))
+			c = nil
+		case s[i] == '@' && !inRealm:
+			pn.NameString = append(pn.NameString, string(c))
+			c = nil
+			inRealm = true
+		default:
+			c = append(c, s[i])
+		}
+	}
+	if inRealm {
+		return pn, string(c)
+	}
+	pn.NameString = append(pn.NameString, string(c))
+	return pn, ""
+}
+
+// Get the principal name as a string with its components separated by '/'.
+func (pn *PrincipalName) PrincipalNameString() string {
+	return strings.Join(pn.NameString, "/")
+}
+
+// Query if the principal name has the same components as the one provided. The name type is not compared.
+func (pn *PrincipalName) Equal(p PrincipalName) bool {
+	if len(pn.NameString) != len(p.NameString) {
+		return false
+	}
+	for i := range pn.NameString {
+		if pn.NameString[i] != p.NameString[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func (pn *PrincipalName) GetSalt(realm string) string {
 	var sb []byte
 	sb = append(sb, realm...)
@@ -16,3 +72,17 @@ func (pn *PrincipalName) GetSalt(realm string) string {
 	}
 	return string(sb)
 }
+
+// Get the well-known anonymous principal name. Ref: RFC 8062 Section 3
+func NewAnonymousPrincipalName() PrincipalName {
+	return PrincipalName{
+		NameType:   nametype.KRB_NT_WELLKNOWN,
+		NameString: []string{"WELLKNOWN", "ANONYMOUS"},
+	}
+}
+
+// Query if the principal name is the well-known anonymous principal name.
+func (pn *PrincipalName) IsAnonymous() bool {
+	return pn.NameType == nametype.KRB_NT_WELLKNOWN && len(pn.NameString) == 2 &&
+		pn.NameString[0] == "WELLKNOWN" && pn.NameString[1] == "ANONYMOUS"
+}
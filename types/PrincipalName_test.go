@@ -12,4 +12,28 @@ func TestPrincipalName_GetSalt(t *testing.T) {
 		NameString: []string{"firststring", "secondstring"},
 	}
 	assert.Equal(t, "TEST.GOKRB5firststringsecondstring", pn.GetSalt("TEST.GOKRB5"), "Principal name default salt not as expected")
-}
\ No newline at end of file
+}
+
+func TestParsePrincipalName(t *testing.T) {
+	var tests = []struct {
+		s      string
+		name   []string
+		realm  string
+	}{
+		{"user", []string{"user"}, ""},
+		{"user@TEST.GOKRB5", []string{"user"}, "TEST.GOKRB5"},
+		{"user/admin@TEST.GOKRB5", []string{"user", "admin"}, "TEST.GOKRB5"},
+		{"host/app01.test.gokrb5", []string{"host", "app01.test.gokrb5"}, ""},
+		{`a\/b\@c@TEST.GOKRB5`, []string{"a/b@c"}, "TEST.GOKRB5"},
+	}
+	for _, test := range tests {
+		pn, realm := ParsePrincipalName(test.s)
+		assert.Equal(t, test.name, pn.NameString, "Name string not as expected for %s", test.s)
+		assert.Equal(t, test.realm, realm, "Realm not as expected for %s", test.s)
+		assert.Equal(t, 1, pn.NameType, "Name type not as expected for %s", test.s)
+	}
+	pn, _ := ParsePrincipalName("user/admin")
+	assert.Equal(t, "user/admin", pn.PrincipalNameString(), "Principal name string not as expected")
+	assert.True(t, pn.Equal(PrincipalName{NameType: 3, NameString: []string{"user", "admin"}}), "Principal names should be equal")
+	assert.False(t, pn.Equal(PrincipalName{NameString: []string{"user"}}), "Principal names should not be equal")
+}
@@ -64,9 +64,15 @@ func UnmarshalTicket(b []byte) (t Ticket, err error) {
 func UnmarshalTicketsSequence(in asn1.RawValue) ([]Ticket, error) {
 	//This is a workaround to a asn1 decoding issue in golang - https://github.com/golang/go/issues/17321. It's not pretty I'm afraid
 	//We pull out raw values from the larger raw value (that is actually the data of the sequence of raw values) and track our position moving along the data.
-	b := in.Bytes
-	// Ignore the head of the asn1 stream (3bytes) as this is what tells us its a sequence but we're handling it ourselves
-	p := 3
+	// Strip the head of the asn1 stream as this is what tells us its a sequence but we're handling it ourselves.
+	// The length of the head varies with the length of the sequence.
+	var seq asn1.RawValue
+	_, err := asn1.Unmarshal(in.Bytes, &seq)
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshalling sequence of tickets failed: %v", err)
+	}
+	b := seq.Bytes
+	p := 0
 	var tkts []Ticket
 	var raw asn1.RawValue
 	for p < (len(b)) {